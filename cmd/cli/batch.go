@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/NeowayLabs/neosearch/cmd/cli/parser"
 	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/parser"
 )
 
 func batch(ng *engine.Engine, filePath string) error {
@@ -15,16 +15,33 @@ func batch(ng *engine.Engine, filePath string) error {
 		panic(err)
 	}
 
+	defer file.Close()
+
 	commands := []engine.Command{}
 
 	err = parser.FromReader(file, &commands)
 
+	if err != nil {
+		return err
+	}
+
+	// the file is executed with one batch per store, then the batch
+	// commands of older files are useless
+	writes := commands[:0]
+
 	for _, cmd := range commands {
-		d, err := ng.Execute(cmd)
-		if err != nil {
-			fmt.Println(err)
+		if cmd.Command != "batch" && cmd.Command != "flushbatch" {
+			writes = append(writes, cmd)
+		}
+	}
+
+	results, _ := ng.ExecuteAll(writes)
+
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Println(result.Err)
 		} else {
-			fmt.Println("Data: ", d)
+			fmt.Println("Data: ", result.Value)
 		}
 	}
 
@@ -6,22 +6,24 @@ import (
 	"os"
 	"strings"
 
-	"github.com/NeowayLabs/neosearch/cmd/cli/parser"
 	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
-	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/parser"
+	"github.com/NeowayLabs/neosearch/service/neosearch/protocol"
 	"github.com/peterh/liner"
 )
 
 var (
 	historyFile = "cli.history.txt"
-	keywords    = []string{"using", "set", "get", "mergeset", "delete"}
+	keywords    = []string{"using", "set", "get", "mergeset", "mergedel", "delete", "scan", "prefix", "limit", "count", "first", "last"}
 )
 
 func setupNeosearchDir(homePath string) error {
 	return os.Mkdir(homePath+"/.neosearch/", 0755)
 }
 
-func cli(ng *engine.Engine, homePath string) error {
+// cli executes the commands typed with the engine `ng`, or with the
+// neosearch server of `client` if not nil.
+func cli(ng *engine.Engine, client *protocol.Client, homePath string) error {
 	var cmdline string
 	var err error
 	var enableHistory bool
@@ -37,6 +39,20 @@ func cli(ng *engine.Engine, homePath string) error {
 	line := liner.NewLiner()
 	defer line.Close()
 
+	// the batches of the commands batch and flushbatch, kept by the
+	// server in remote mode
+	var session *engine.Session
+
+	if client == nil {
+		session = ng.NewSession()
+
+		defer func() {
+			if err := session.Close(); err != nil {
+				fmt.Println("ERROR: ", err)
+			}
+		}()
+	}
+
 	line.SetCompleter(func(line string) (c []string) {
 		for _, n := range keywords {
 			if strings.HasPrefix(n, strings.ToLower(line)) {
@@ -75,23 +91,27 @@ func cli(ng *engine.Engine, homePath string) error {
 		err = parser.FromString(cmdline, &command)
 		if err != nil {
 			fmt.Println(err)
+		} else if client != nil {
+			remote(client, command)
 		} else {
 			for _, cmd := range command {
-				data, err := ng.Execute(cmd)
+				if cmd.IsQuery() {
+					pairs, err := ng.Query(cmd)
+					if err != nil {
+						fmt.Println("ERROR: ", err)
+					} else {
+						renderPairs(cmd, pairs)
+					}
+
+					continue
+				}
+
+				data, err := session.Execute(cmd)
 				if err != nil {
 					fmt.Println("ERROR: ", err)
 				} else {
 					fmt.Printf("%s: Success\n", cmd.Command)
-
-					if data != nil {
-						ext := cmd.Index[len(cmd.Index)-3 : len(cmd.Index)]
-						if ext == "idx" {
-							uints := utils.GetUint64Array(data)
-							fmt.Printf("Result[%s]: %v\n", ext, uints)
-						} else {
-							fmt.Printf("Result: %s\n", string(data))
-						}
-					}
+					renderValue(cmd, data)
 				}
 
 			}
@@ -1,15 +1,17 @@
 package main
 
 import (
+	"log"
 	"os"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
 	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+	"github.com/NeowayLabs/neosearch/service/neosearch/protocol"
 	"github.com/jteeuwen/go-pkg-optarg"
 )
 
 func main() {
-	var fileOpt, dataDirOpt, homeOpt string
+	var fileOpt, dataDirOpt, homeOpt, remoteOpt string
 	var helpOpt, debugOpt bool
 
 	optarg.Add("f", "from-file", "Read NeoSearch low-level instructions from file", "")
@@ -17,6 +19,7 @@ func main() {
 	optarg.Add("t", "trace-debug", "Enable trace for debug", false)
 	optarg.Add("h", "help", "Display this help", false)
 	optarg.Add("m", "home", "User home for store command history", "")
+	optarg.Add("r", "remote", "Execute the commands in the neosearch server listening commands on host:port", "")
 
 	for opt := range optarg.Parse() {
 		switch opt.ShortName {
@@ -29,6 +32,9 @@ func main() {
 		case "m":
 			homeOpt = opt.String()
 			break
+		case "r":
+			remoteOpt = opt.String()
+			break
 		case "t":
 			debugOpt = true
 			break
@@ -49,6 +55,28 @@ func main() {
 		}
 	}
 
+	if remoteOpt != "" {
+		client, err := protocol.Dial(remoteOpt)
+
+		if err != nil {
+			log.Fatalf("Failed to connect to %s: %s", remoteOpt, err)
+		}
+
+		defer client.Close()
+
+		if fileOpt != "" {
+			err = remoteBatch(client, fileOpt)
+		} else {
+			err = cli(nil, client, homeOpt)
+		}
+
+		if err != nil {
+			log.Print(err)
+		}
+
+		return
+	}
+
 	if dataDirOpt == "" {
 		dataDirOpt, _ = os.Getwd()
 	}
@@ -65,6 +93,6 @@ func main() {
 	if fileOpt != "" {
 		batch(ng, fileOpt)
 	} else {
-		cli(ng, homeOpt)
+		cli(ng, nil, homeOpt)
 	}
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/parser"
+	"github.com/NeowayLabs/neosearch/service/neosearch/protocol"
+)
+
+// remote executes the commands with the neosearch server of `client` and
+// prints the replies like the local commands. It returns false if the
+// connection failed.
+func remote(client *protocol.Client, commands []engine.Command) bool {
+	replies, err := client.Execute(commands)
+
+	for i, reply := range replies {
+		renderReply(commands[i], reply)
+	}
+
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		return false
+	}
+
+	return true
+}
+
+// remoteBatch executes the commands of the file `filePath` with the
+// neosearch server of `client`. The batch commands of the file are
+// executed too, in the batches of the connection.
+func remoteBatch(client *protocol.Client, filePath string) error {
+	file, err := os.Open(filePath)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	commands := []engine.Command{}
+
+	if err = parser.FromReader(file, &commands); err != nil {
+		return err
+	}
+
+	remote(client, commands)
+	return nil
+}
+
+func renderReply(cmd engine.Command, reply protocol.Reply) {
+	switch reply.Type {
+	case protocol.ReplyError:
+		fmt.Println("ERROR: ", reply.Str)
+	case protocol.ReplyArray:
+		pairs, err := reply.Pairs()
+
+		if err != nil {
+			fmt.Println("ERROR: ", err)
+			return
+		}
+
+		renderPairs(cmd, pairs)
+	case protocol.ReplyInteger:
+		fmt.Printf("%s: Success\n", cmd.Command)
+		fmt.Printf("Result: %d\n", reply.Int)
+	default:
+		fmt.Printf("%s: Success\n", cmd.Command)
+		renderValue(cmd, reply.Bulk)
+	}
+}
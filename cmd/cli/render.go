@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+// renderValue prints the value returned by the command `cmd`. The values
+// of the .idx databases are sets of document ids.
+func renderValue(cmd engine.Command, data []byte) {
+	if data == nil {
+		return
+	}
+
+	switch {
+	case cmd.Command == "count":
+		fmt.Printf("Result: %d\n", utils.BytesToUint64(data))
+	case strings.HasSuffix(cmd.Database, ".idx"):
+		fmt.Printf("Result[idx]: %v\n", utils.GetUint64Array(data))
+	default:
+		fmt.Printf("Result: %s\n", string(data))
+	}
+}
+
+// renderPairs prints the key/value pairs returned by the query `cmd`.
+// The keys have the type of the keys of the command, or the type of the
+// keys of the database for first and last: the document ids of
+// document.db and strings otherwise.
+func renderPairs(cmd engine.Command, pairs []engine.KeyValue) {
+	keyType := cmd.KeyType
+
+	if keyType == 0 {
+		if cmd.Database == "document.db" {
+			keyType = engine.TypeUint
+		} else {
+			keyType = engine.TypeString
+		}
+	}
+
+	for _, pair := range pairs {
+		key := engine.Literal(pair.Key, keyType)
+
+		// the key hasn't the size of the type
+		if key == "" || (keyType != engine.TypeString && keyType != engine.TypeBool && len(pair.Key) != 8) {
+			key = engine.Literal(pair.Key, engine.TypeString)
+		}
+
+		if strings.HasSuffix(cmd.Database, ".idx") {
+			fmt.Printf("%s: %v\n", key, utils.GetUint64Array(pair.Value))
+		} else {
+			fmt.Printf("%s: %s\n", key, string(pair.Value))
+		}
+	}
+
+	fmt.Printf("(%d keys)\n", len(pairs))
+}
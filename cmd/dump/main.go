@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch"
+	"github.com/jteeuwen/go-pkg-optarg"
+)
+
+func main() {
+	var (
+		dataDirOpt, nameOpt, outputOpt string
+		helpOpt, debugOpt              bool
+		output                         io.Writer = os.Stdout
+	)
+
+	optarg.Header("General options")
+	optarg.Add("n", "name", "Name of index database (Required)", "")
+	optarg.Add("o", "output", "Write the dump to file instead of stdout", "")
+	optarg.Add("d", "data-dir", "Data directory", "")
+	optarg.Add("t", "trace-debug", "Enable trace for debug", false)
+	optarg.Add("h", "help", "Display this help", false)
+
+	for opt := range optarg.Parse() {
+		switch opt.ShortName {
+		case "n":
+			nameOpt = opt.String()
+		case "o":
+			outputOpt = opt.String()
+		case "d":
+			dataDirOpt = opt.String()
+		case "t":
+			debugOpt = true
+		case "h":
+			helpOpt = true
+		}
+	}
+
+	if helpOpt {
+		optarg.Usage()
+		os.Exit(0)
+	}
+
+	if nameOpt == "" {
+		optarg.Usage()
+		os.Exit(1)
+	}
+
+	if dataDirOpt == "" {
+		dataDirOpt, _ = os.Getwd()
+	}
+
+	cfg := neosearch.NewConfig()
+
+	cfg.Option(neosearch.DataDir(dataDirOpt))
+	cfg.Option(neosearch.Debug(debugOpt))
+
+	neo := neosearch.New(cfg)
+
+	defer neo.Close()
+
+	index, err := neo.OpenIndex(nameOpt)
+
+	if err != nil {
+		log.Fatalf("Failed to open index '%s': %s", nameOpt, err)
+		return
+	}
+
+	if outputOpt != "" {
+		file, err := os.Create(outputOpt)
+
+		if err != nil {
+			log.Fatalf("Unable to create file: %s", err)
+			return
+		}
+
+		defer file.Close()
+
+		output = file
+	}
+
+	if err = index.Dump(output); err != nil {
+		log.Fatalf("Failed to dump index '%s': %s", nameOpt, err)
+	}
+}
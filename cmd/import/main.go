@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"runtime"
 	"runtime/pprof"
+	"sync"
 	"time"
 
 	"launchpad.net/gommap"
@@ -28,13 +29,14 @@ func main() {
 		helpOpt, newIndex, debugOpt bool
 		err                         error
 		index                       *index.Index
-		batchSize                   int
+		batchSize, workers          int
 	)
 
 	optarg.Header("General options")
 	optarg.Add("f", "file", "Read NeoSearch JSON database from file. (Required)", "")
 	optarg.Add("c", "create", "Create new index database", false)
 	optarg.Add("b", "batch-size", "Batch size", 1000)
+	optarg.Add("w", "workers", "Number of parallel writers", runtime.NumCPU())
 	optarg.Add("n", "name", "Name of index database", "")
 	optarg.Add("d", "data-dir", "Data directory", "")
 	optarg.Add("t", "trace-debug", "Enable trace for debug", false)
@@ -48,6 +50,8 @@ func main() {
 			fileOpt = opt.String()
 		case "b":
 			batchSize = opt.Int()
+		case "w":
+			workers = opt.Int()
 		case "d":
 			dataDirOpt = opt.String()
 		case "n":
@@ -145,8 +149,6 @@ func main() {
 
 	startTime := time.Now()
 
-	index.Batch()
-	var count int
 	totalResults := len(data)
 
 	runtime.GC()
@@ -180,42 +182,88 @@ func main() {
 
 	fmt.Println("Importing ", len(data), " records")
 
-	for idx := range data {
-		dataEntry := data[idx]
+	if workers < 1 {
+		workers = 1
+	}
 
-		if dataEntry["_id"] == nil {
-			dataEntry["_id"] = idx
-		}
+	var (
+		jobs     = make(chan int)
+		wg       sync.WaitGroup
+		errMutex sync.Mutex
+		firstErr error
+	)
 
-		entryJSON, err := json.Marshal(&dataEntry)
-		if err != nil {
-			log.Println(err)
-			return
-		}
+	setError := func(err error) {
+		errMutex.Lock()
+		defer errMutex.Unlock()
 
-		err = index.Add(uint64(idx), entryJSON, metadata)
-		if err != nil {
-			panic(err)
+		if firstErr == nil {
+			firstErr = err
 		}
+	}
+
+	failed := func() bool {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+
+		return firstErr != nil
+	}
+
+	// every writer fills and commits its own batches
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
 
-		if count == batchSize {
-			count = 0
+		go func() {
+			defer wg.Done()
 
-			fmt.Println("Flushing batch: ", idx, " from ", totalResults)
-			index.FlushBatch()
-			if idx != (totalResults - 1) {
-				index.Batch()
+			batch := index.NewBatch()
+
+			for idx := range jobs {
+				dataEntry := data[idx]
+				data[idx] = nil
+
+				// skips the records left after an error
+				if failed() {
+					continue
+				}
+
+				entryJSON, err := json.Marshal(&dataEntry)
+
+				if err == nil {
+					// documents without _id get the next id of the index
+					// sequence, numeric _id are used as is and strings are
+					// external ids.
+					_, err = batch.AddDocument(entryJSON, metadata)
+				}
+
+				if err == nil && batch.Len() >= batchSize {
+					fmt.Println("Flushing batch: ", idx, " from ", totalResults)
+					err = batch.Commit()
+				}
+
+				if err != nil {
+					setError(err)
+					batch.Discard()
+				}
 			}
 
-			runtime.GC()
-		} else {
-			count = count + 1
-		}
+			if err := batch.Commit(); err != nil {
+				setError(err)
+			}
+		}()
+	}
+
+	for idx := range data {
+		jobs <- idx
+	}
+
+	close(jobs)
+	wg.Wait()
 
-		data[idx] = nil
+	if firstErr != nil {
+		panic(firstErr)
 	}
 
-	index.FlushBatch()
 	index.Close()
 	neo.Close()
 
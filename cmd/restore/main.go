@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/index"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/parser"
+	"github.com/jteeuwen/go-pkg-optarg"
+)
+
+func main() {
+	var (
+		fileOpt, dataDirOpt, nameOpt string
+		helpOpt, newIndex, debugOpt  bool
+		input                        io.Reader = os.Stdin
+		ncommands                    int
+		idx                          *index.Index
+		restorer                     *index.Restorer
+		err                          error
+	)
+
+	optarg.Header("General options")
+	optarg.Add("f", "file", "Read the dump from file instead of stdin", "")
+	optarg.Add("n", "name", "Name of index database (default: index of the dump)", "")
+	optarg.Add("c", "create", "Create new index database", false)
+	optarg.Add("d", "data-dir", "Data directory", "")
+	optarg.Add("t", "trace-debug", "Enable trace for debug", false)
+	optarg.Add("h", "help", "Display this help", false)
+
+	for opt := range optarg.Parse() {
+		switch opt.ShortName {
+		case "f":
+			fileOpt = opt.String()
+		case "n":
+			nameOpt = opt.String()
+		case "c":
+			newIndex = true
+		case "d":
+			dataDirOpt = opt.String()
+		case "t":
+			debugOpt = true
+		case "h":
+			helpOpt = true
+		}
+	}
+
+	if helpOpt {
+		optarg.Usage()
+		os.Exit(0)
+	}
+
+	if dataDirOpt == "" {
+		dataDirOpt, _ = os.Getwd()
+	}
+
+	if fileOpt != "" {
+		file, err := os.Open(fileOpt)
+
+		if err != nil {
+			log.Fatalf("Unable to open file: %s", err)
+			return
+		}
+
+		defer file.Close()
+
+		input = file
+	}
+
+	cfg := neosearch.NewConfig()
+
+	cfg.Option(neosearch.DataDir(dataDirOpt))
+	cfg.Option(neosearch.Debug(debugOpt))
+
+	neo := neosearch.New(cfg)
+
+	defer neo.Close()
+
+	openIndex := func() {
+		if newIndex {
+			log.Printf("Creating index %s\n", nameOpt)
+			idx, err = neo.CreateIndex(nameOpt)
+		} else {
+			log.Printf("Opening index %s ...\n", nameOpt)
+			idx, err = neo.OpenIndex(nameOpt)
+		}
+
+		if err != nil {
+			log.Fatalf("Failed to open index '%s': %s", nameOpt, err)
+		}
+
+		restorer = idx.NewRestorer()
+	}
+
+	startTime := time.Now()
+
+	// the commands are restored as they are parsed
+	err = parser.FromReaderFunc(input, func(cmd engine.Command) error {
+		if restorer == nil {
+			if nameOpt == "" {
+				nameOpt = cmd.Index
+			}
+
+			openIndex()
+		}
+
+		ncommands++
+		return restorer.Execute(cmd)
+	})
+
+	if restorer == nil {
+		if nameOpt == "" {
+			log.Fatal("Empty dump and no index name supplied")
+			return
+		}
+
+		openIndex()
+	}
+
+	if closeErr := restorer.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to restore index '%s': %s", nameOpt, err)
+		return
+	}
+
+	log.Printf("%d commands restored in %v\n", ncommands, time.Since(startTime))
+}
@@ -2,6 +2,8 @@ package cache
 
 type OnRemoveCb func(key string, value interface{})
 
+// Cache is a key/value cache of limited size. Implementations are safe
+// for concurrent use.
 type Cache interface {
 	// Add new entry to cache
 	Add(key string, value interface{})
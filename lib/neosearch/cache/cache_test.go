@@ -1,6 +1,10 @@
 package cache
 
-import "testing"
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
 
 func TestLRUCreate(t *testing.T) {
 	lru := NewLRUCache(1)
@@ -151,3 +155,70 @@ func TestLRUOnRemoveCallback(t *testing.T) {
 		t.Error("OnRemove callback not invoked OR called concurrently")
 	}
 }
+
+func TestLRUClean(t *testing.T) {
+	lru := NewLRUCache(10)
+	removed := make(map[string]int)
+
+	lru.OnRemove(func(key string, value interface{}) {
+		removed[key]++
+	})
+
+	lru.Add("a", 1)
+	lru.Add("b", 2)
+	lru.Add("c", 3)
+
+	lru.Clean()
+
+	if lru.Len() != 0 {
+		t.Errorf("Cache should be empty, but have %d entries", lru.Len())
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if removed[key] != 1 {
+			t.Errorf("OnRemove called %d times for key %s", removed[key], key)
+		}
+	}
+}
+
+func TestLRUConcurrent(t *testing.T) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		removed int
+	)
+
+	lru := NewLRUCache(10)
+
+	lru.OnRemove(func(key string, value interface{}) {
+		mu.Lock()
+		removed++
+		mu.Unlock()
+	})
+
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				key := strconv.Itoa(g*100 + i)
+
+				lru.Add(key, i)
+				lru.Get(key)
+				lru.Len()
+			}
+		}(g)
+	}
+
+	wg.Wait()
+
+	if lru.Len() != 10 {
+		t.Errorf("Cache should have 10 entries, but have %d", lru.Len())
+	}
+
+	if removed != 8*100-10 {
+		t.Errorf("OnRemove called %d times", removed)
+	}
+}
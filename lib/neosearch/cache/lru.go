@@ -1,8 +1,15 @@
 package cache
 
-import "container/list"
-
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUCache is a Cache that removes the least recently used entries when
+// full. It's safe for concurrent use. The OnRemove callback is executed
+// after the cache is unlocked, then it can use the cache.
 type LRUCache struct {
+	mu  sync.Mutex
 	max int
 
 	onRemove OnRemoveCb
@@ -30,35 +37,47 @@ func NewLRUCache(max int) *LRUCache {
 }
 
 func (lru *LRUCache) OnRemove(cb OnRemoveCb) {
+	lru.mu.Lock()
 	lru.onRemove = cb
+	lru.mu.Unlock()
 }
 
 // MaxEntries update the max allowed entries in cache
 func (lru *LRUCache) MaxEntries(max int) {
+	lru.mu.Lock()
 	lru.max = max
+	lru.mu.Unlock()
 }
 
 func (lru *LRUCache) Len() int {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
 	return lru.ll.Len()
 }
 
 // Add new interface{} value to LRUCache.
 func (lru *LRUCache) Add(key string, value interface{}) {
 	var (
-		elem *list.Element
-		ok   bool
+		elem    *list.Element
+		ok      bool
+		removed []*entry
 	)
 
+	lru.mu.Lock()
+
 	if elem, ok = lru.cache[key]; ok {
-		lru.removeElement(elem)
+		removed = append(removed, lru.removeElement(elem))
 	}
 
 	elem = lru.ll.PushFront(&entry{key, value})
 	lru.cache[key] = elem
 
 	if lru.ll.Len() > lru.max {
-		lru.removeOldest()
+		removed = append(removed, lru.removeElement(lru.ll.Back()))
 	}
+
+	lru.unlock(removed)
 }
 
 // Get the given `key` from cache. If the key exists, it will be ranked
@@ -69,6 +88,9 @@ func (lru *LRUCache) Get(key string) (interface{}, bool) {
 		ok   bool
 	)
 
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
 	if lru.cache == nil || len(lru.cache) == 0 {
 		return nil, false
 	}
@@ -89,41 +111,48 @@ func (lru *LRUCache) Remove(key string) bool {
 		ok   bool
 	)
 
+	lru.mu.Lock()
+
 	if lru.cache == nil || len(lru.cache) == 0 {
+		lru.mu.Unlock()
 		return false
 	}
 
 	elem, ok = lru.cache[key]
 
 	if ok {
-		lru.removeElement(elem)
+		lru.unlock([]*entry{lru.removeElement(elem)})
 		return true
 	}
 
+	lru.mu.Unlock()
 	return false
 }
 
-func (lru *LRUCache) removeOldest() {
-	var elem *list.Element
+// removeElement unlinks `elem` and returns its entry. The caller must
+// hold the lock.
+func (lru *LRUCache) removeElement(elem *list.Element) *entry {
+	lru.ll.Remove(elem)
 
-	if lru.cache == nil || len(lru.cache) == 0 {
-		return
-	}
+	kv := elem.Value.(*entry)
+	delete(lru.cache, kv.key)
 
-	elem = lru.ll.Back()
-	if elem != nil {
-		lru.removeElement(elem)
-	}
+	return kv
 }
 
-func (lru *LRUCache) removeElement(elem *list.Element) {
-	lru.ll.Remove(elem)
+// unlock releases the lock and executes the OnRemove callback for the
+// `removed` entries.
+func (lru *LRUCache) unlock(removed []*entry) {
+	onRemove := lru.onRemove
 
-	kv := elem.Value.(*entry)
-	delete(lru.cache, kv.key)
+	lru.mu.Unlock()
 
-	if lru.onRemove != nil {
-		lru.onRemove(kv.key, kv.value)
+	if onRemove == nil {
+		return
+	}
+
+	for _, kv := range removed {
+		onRemove(kv.key, kv.value)
 	}
 }
 
@@ -131,25 +160,17 @@ func (lru *LRUCache) removeElement(elem *list.Element) {
 // when needed!
 func (lru *LRUCache) Clean() {
 	var (
-		cacheLen int = len(lru.cache)
-		elem     *list.Element
-		key      string
-		value    interface{}
+		elem    *list.Element
+		removed []*entry
 	)
 
-	if lru.cache == nil || cacheLen == 0 {
-		return
-	}
-
-	for elem = lru.ll.Front(); elem != nil; elem = elem.Next() {
-		ee := elem.Value.(*entry)
-		key = ee.key
-		value = ee.value
-
-		if lru.onRemove != nil {
-			lru.onRemove(key, value)
-		}
+	lru.mu.Lock()
 
-		lru.removeElement(elem)
+	// removeElement unlinks elem from the list (elem.Next() is nil
+	// after it), then always remove the current front.
+	for elem = lru.ll.Front(); elem != nil; elem = lru.ll.Front() {
+		removed = append(removed, lru.removeElement(elem))
 	}
+
+	lru.unlock(removed)
 }
@@ -1,10 +1,12 @@
 package neosearch
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
 	"gopkg.in/yaml.v2"
 )
 
@@ -32,6 +34,29 @@ type Config struct {
 
 	// EnableCache enable/disable cache support
 	EnableCache bool `yaml:"enableCache"`
+
+	// MaxTermExpansion is the maximum number of terms that wildcard and
+	// regex queries can expand to. Default is 1024. The queries visit at
+	// most 64 times this number of terms
+	MaxTermExpansion int `yaml:"maxTermExpansion"`
+
+	// MaxSuggestScan is the maximum number of terms visited by the
+	// suggestions. Default is 10000. Suggestions are ranked among the
+	// terms visited, then they're approximate when the limit is reached
+	MaxSuggestScan int `yaml:"maxSuggestScan"`
+
+	// Storage is the tuning of the storage engine (compression, block
+	// size, write buffer, bloom filters, ...). The options not set use
+	// the defaults of the store package.
+	Storage store.Tuning `yaml:"storage"`
+
+	// IndexStorage overrides the options of Storage for the indices
+	// in the map
+	IndexStorage map[string]store.Tuning `yaml:"indexStorage"`
+
+	// Changes enables the change stream of the indices (see
+	// index.Index.Changes)
+	Changes bool `yaml:"changes"`
 }
 
 // NewConfig creates new config
@@ -39,6 +64,30 @@ func NewConfig() *Config {
 	return &Config{}
 }
 
+// Validate returns an error if the storage tuning is invalid.
+func (c *Config) Validate() error {
+	if err := c.Storage.Validate(); err != nil {
+		return err
+	}
+
+	for name, tuning := range c.IndexStorage {
+		if err := tuning.Validate(); err != nil {
+			return fmt.Errorf("Index '%s': %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// IndexTuning returns the storage tuning of the index `name`.
+func (c *Config) IndexTuning(name string) store.Tuning {
+	if tuning, ok := c.IndexStorage[name]; ok {
+		return c.Storage.Override(tuning)
+	}
+
+	return c.Storage
+}
+
 // Option configures the config struct
 func (c *Config) Option(opts ...Option) (previous Option) {
 	for _, opt := range opts {
@@ -102,6 +151,48 @@ func MaxIndicesOpen(size int) Option {
 	}
 }
 
+// MaxTermExpansion set the maximum number of terms that wildcard and
+// regex queries can expand to
+func MaxTermExpansion(max int) Option {
+	return func(c *Config) Option {
+		previous := c.MaxTermExpansion
+		c.MaxTermExpansion = max
+
+		return MaxTermExpansion(previous)
+	}
+}
+
+// MaxSuggestScan set the maximum number of terms visited by the
+// suggestions
+func MaxSuggestScan(max int) Option {
+	return func(c *Config) Option {
+		previous := c.MaxSuggestScan
+		c.MaxSuggestScan = max
+
+		return MaxSuggestScan(previous)
+	}
+}
+
+// Changes enable/disable the change stream of the indices
+func Changes(enable bool) Option {
+	return func(c *Config) Option {
+		previous := c.Changes
+		c.Changes = enable
+
+		return Changes(previous)
+	}
+}
+
+// Storage set the tuning of the storage engine
+func Storage(tuning store.Tuning) Option {
+	return func(c *Config) Option {
+		previous := c.Storage
+		c.Storage = tuning
+
+		return Storage(previous)
+	}
+}
+
 // ConfigFromFile loads configuration from YAML file
 func ConfigFromFile(filename string) (*Config, error) {
 	// Load config from file
@@ -119,6 +210,9 @@ func ConfigFromFile(filename string) (*Config, error) {
 
 	cfg := NewConfig()
 
-	err = yaml.Unmarshal(fileContent, &cfg)
-	return cfg, err
+	if err = yaml.Unmarshal(fileContent, &cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, cfg.Validate()
 }
@@ -0,0 +1,71 @@
+package neosearch
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+)
+
+func TestConfigFromFile(t *testing.T) {
+	file, err := ioutil.TempFile("/tmp", "neosearch-config-")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer os.Remove(file.Name())
+
+	file.WriteString(`dataDir: /data
+maxTermExpansion: 100
+changes: true
+storage:
+  compression: none
+  blockSize: 8192
+  syncWrites: true
+indexStorage:
+  logs:
+    writeBufferSize: 16777216
+    bloomFilterBits: -1
+  cache:
+    syncWrites: false
+`)
+	file.Close()
+
+	cfg, err := ConfigFromFile(file.Name())
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if cfg.DataDir != "/data" || cfg.MaxTermExpansion != 100 || !cfg.Changes {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	tuning := cfg.IndexTuning("users")
+
+	if tuning.Compression != "none" || tuning.BlockSize != 8192 || tuning.SyncWrites == nil || !*tuning.SyncWrites || tuning.WriteBufferSize != 0 {
+		t.Errorf("Unexpected tuning: %+v", tuning)
+	}
+
+	tuning = cfg.IndexTuning("logs")
+
+	if tuning.Compression != "none" || tuning.WriteBufferSize != 16777216 || tuning.BloomFilterBits != -1 || tuning.SyncWrites == nil || !*tuning.SyncWrites {
+		t.Errorf("Unexpected tuning of logs: %+v", tuning)
+	}
+
+	tuning = cfg.IndexTuning("cache")
+
+	if tuning.Compression != "none" || tuning.SyncWrites == nil || *tuning.SyncWrites {
+		t.Errorf("Unexpected tuning of cache: %+v", tuning)
+	}
+
+	cfg.IndexStorage["logs"] = store.Tuning{Compression: "lz4"}
+
+	if err = cfg.Validate(); err == nil {
+		t.Error("Invalid compression of logs should fail")
+	}
+}
@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+// Batch is a group of set, mergeset, mergedel and delete commands executed
+// at once by Commit, with one store.Batch per store. The stores of the
+// batch are acquired until Commit or Discard. A Batch isn't safe for
+// concurrent use, but many batches can be filled in parallel.
+type Batch struct {
+	engine  *Engine
+	stores  []*storeRef
+	batches []store.Batch
+
+	// commands of each store, for the hooks and the change stream
+	commands [][]Command
+
+	size int
+}
+
+// NewBatch returns an empty batch of the engine.
+func (ng *Engine) NewBatch() *Batch {
+	return &Batch{engine: ng}
+}
+
+// Execute adds the command `cmd` to the batch. Only set, mergeset,
+// mergedel and delete commands are accepted.
+func (b *Batch) Execute(cmd Command) error {
+	_, err := b.add(cmd)
+	return err
+}
+
+// add adds the command `cmd` to the batch and returns the position of
+// its store in b.stores.
+func (b *Batch) add(cmd Command) (int, error) {
+	switch cmd.Command {
+	case "set", "mergeset", "mergedel", "delete":
+	default:
+		return 0, fmt.Errorf("Command %s can't be batched", cmd.Command)
+	}
+
+	if err := b.engine.preExecute(cmd); err != nil {
+		return 0, err
+	}
+
+	if b.engine.config.KVCfg.Debug {
+		cmd.Println()
+	}
+
+	n, err := b.storeBatch(cmd.Index, cmd.Database)
+
+	if err != nil {
+		return 0, err
+	}
+
+	batch := b.batches[n]
+
+	switch cmd.Command {
+	case "set":
+		batch.Put(cmd.Key, cmd.Value)
+	case "mergeset":
+		batch.Merge(cmd.Key, utils.BytesToUint64(cmd.Value))
+	case "mergedel":
+		batch.MergeDel(cmd.Key, utils.BytesToUint64(cmd.Value))
+	case "delete":
+		batch.Delete(cmd.Key)
+	}
+
+	b.commands[n] = append(b.commands[n], cmd)
+	b.size++
+	return n, nil
+}
+
+// storeBatch returns the position in b.batches of the batch of the store
+// `databaseName` of index `indexName`, acquiring the store on first use.
+func (b *Batch) storeBatch(indexName, databaseName string) (int, error) {
+	name := indexName + "." + databaseName
+
+	for n, ref := range b.stores {
+		if ref.name == name {
+			return n, nil
+		}
+	}
+
+	ref, err := b.engine.open(indexName, databaseName)
+
+	if err != nil {
+		return 0, err
+	}
+
+	b.stores = append(b.stores, ref)
+	b.batches = append(b.batches, ref.NewBatch())
+	b.commands = append(b.commands, nil)
+
+	return len(b.batches) - 1, nil
+}
+
+// Len returns the number of commands in the batch.
+func (b *Batch) Len() int {
+	return b.size
+}
+
+// Commit writes the commands of the batch, one store at a time, and
+// empties the batch. Every store is written, even after an error, and
+// the first error is returned.
+func (b *Batch) Commit() error {
+	for _, err := range b.commit() {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// commit writes the commands of the batch and returns the errors of the
+// stores, by their position in b.stores, then empties the batch. The
+// post-execute hooks are called for each command.
+func (b *Batch) commit() []error {
+	errs := b.write()
+	commands := b.commands
+
+	b.release()
+
+	for n := range commands {
+		for _, cmd := range commands[n] {
+			b.engine.postExecute(cmd, nil, errs[n])
+		}
+	}
+
+	return errs
+}
+
+// write commits the batches of the stores and appends the commands of the
+// stores written to the change stream, if enabled. The error of a store
+// is the error of the append, if it fails.
+func (b *Batch) write() []error {
+	var (
+		changes = b.engine.changes
+		errs    = make([]error, len(b.batches))
+		written []Command
+	)
+
+	if changes != nil {
+		changes.mu.Lock()
+		defer changes.mu.Unlock()
+	}
+
+	for n, batch := range b.batches {
+		if err := batch.Commit(); err != nil {
+			errs[n] = fmt.Errorf("Failed to commit the batch of %s: %s", b.stores[n].name, err)
+		} else {
+			written = append(written, b.commands[n]...)
+		}
+	}
+
+	if changes == nil {
+		return errs
+	}
+
+	if err := changes.append(written); err != nil {
+		for n := range errs {
+			if errs[n] == nil {
+				errs[n] = fmt.Errorf("Failed to append the changes of %s: %s", b.stores[n].name, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+// Discard empties the batch without writing the commands.
+func (b *Batch) Discard() {
+	for _, batch := range b.batches {
+		batch.Discard()
+	}
+
+	b.release()
+}
+
+func (b *Batch) release() {
+	for _, ref := range b.stores {
+		b.engine.ReleaseStore(ref)
+	}
+
+	b.stores = nil
+	b.batches = nil
+	b.commands = nil
+	b.size = 0
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+func TestBatchCommit(t *testing.T) {
+	var (
+		indexName = "batch-commit"
+		indexDir  = DataDirTmp + "/" + indexName
+		data      []byte
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+	})
+
+	first, second := ng.NewBatch(), ng.NewBatch()
+
+	for n, batch := range []*Batch{first, second} {
+		for _, cmd := range []Command{
+			{Database: "document.db", Command: "set", Key: utils.Uint64ToBytes(uint64(n + 1)), Value: []byte("doc")},
+			{Database: "name.idx", Command: "mergeset", Key: []byte("neoway"), Value: utils.Uint64ToBytes(uint64(n + 1))},
+		} {
+			cmd.Index = indexName
+
+			if err = batch.Execute(cmd); err != nil {
+				t.Error(err)
+				goto cleanup
+			}
+		}
+	}
+
+	if err = first.Execute(Command{Index: indexName, Database: "name.idx", Command: "get"}); err == nil {
+		t.Error("Get command batched")
+	}
+
+	if first.Len() != 2 {
+		t.Errorf("Batch with %d commands, expected 2", first.Len())
+	}
+
+	second.Discard()
+
+	if err = first.Commit(); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	data, err = ng.Execute(Command{Index: indexName, Database: "name.idx", Command: "get", Key: []byte("neoway")})
+
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(utils.GetUint64Array(data), []uint64{1}) {
+		t.Errorf("Unexpected postings: %v", utils.GetUint64Array(data))
+	}
+
+	data, err = ng.Execute(Command{Index: indexName, Database: "document.db", Command: "get", Key: utils.Uint64ToBytes(2)})
+
+	if err != nil || data != nil {
+		t.Errorf("Discarded batch written: %v (%v)", data, err)
+	}
+
+cleanup:
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
@@ -0,0 +1,268 @@
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Change is a write executed by the engine and its sequence number in
+// the change stream.
+type Change struct {
+	Seq     uint64
+	Command Command
+}
+
+// changeStream is the change stream of the engine (see
+// NGConfig.ChangesPath). The writes executed are appended to the stream
+// after written in the stores, with consecutive sequence numbers
+// starting at 1. The stream has the records of the log (see commandLog),
+// where the payload of a record is the sequence number of its first
+// change followed by the commands.
+type changeStream struct {
+	// serializes the writes of the stores with the appends, then the
+	// changes are in the order of the writes
+	mu sync.Mutex
+
+	path string
+	file *os.File
+
+	// sequence number of the last change
+	seq uint64
+}
+
+// open opens (or creates) the stream, if not open, discarding a torn
+// record at the end. The caller must hold s.mu.
+func (s *changeStream) open() error {
+	if s.file != nil {
+		return nil
+	}
+
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	var (
+		reader = bufio.NewReader(file)
+		size   int64
+		seq    uint64
+	)
+
+	for {
+		payload, err := readRecord(reader)
+
+		if err == io.EOF || err == errTornRecord {
+			break
+		}
+
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		first, commands, err := decodeChanges(payload)
+
+		if err != nil {
+			break
+		}
+
+		size += int64(8 + len(payload))
+		seq = first + uint64(len(commands)) - 1
+	}
+
+	if err = file.Truncate(size); err == nil {
+		_, err = file.Seek(size, os.SEEK_SET)
+	}
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.seq = seq
+
+	return nil
+}
+
+// append appends the changes `commands` to the stream and syncs it to
+// disk. The caller must hold s.mu.
+func (s *changeStream) append(commands []Command) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	payload := appendUvarint(nil, s.seq+1)
+	payload = encodeCommands(payload, commands)
+
+	if _, err := s.file.Write(frameRecord(payload)); err != nil {
+		return err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	s.seq += uint64(len(commands))
+	return nil
+}
+
+// close closes the stream file. Closing a closed stream does nothing.
+func (s *changeStream) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// decodeChanges decodes the sequence number of the first change and the
+// commands of the record payload `payload`.
+func decodeChanges(payload []byte) (uint64, []Command, error) {
+	d := &commandDecoder{data: payload}
+	first := d.uvarint()
+
+	if d.err != nil || first == 0 {
+		return 0, nil, errInvalidRecord
+	}
+
+	commands, err := d.commands()
+
+	if err != nil || len(commands) == 0 {
+		return 0, nil, errInvalidRecord
+	}
+
+	return first, commands, nil
+}
+
+// ChangeReader reads the change stream written by an engine, from a
+// sequence number. The stream can be read while written, by the engine
+// of the same or of another process. A ChangeReader isn't safe for
+// concurrent use.
+//
+//	reader, err := engine.OpenChanges(path, offset)
+//
+//	for {
+//	    change, err := reader.Next()
+//
+//	    if err == io.EOF {
+//	        time.Sleep(time.Second)
+//	        continue
+//	    }
+//
+//	    ...
+//	}
+type ChangeReader struct {
+	file   *os.File
+	reader *bufio.Reader
+
+	// position of the next record in the file
+	pos int64
+
+	// sequence number of the next change
+	next uint64
+
+	// changes of the last record read, not returned yet
+	pending []Change
+}
+
+// OpenChanges opens the change stream at `path` to read the changes from
+// the sequence number `offset`. The offset zero is the first change.
+func OpenChanges(path string, offset uint64) (*ChangeReader, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if offset == 0 {
+		offset = 1
+	}
+
+	return &ChangeReader{
+		file:   file,
+		reader: bufio.NewReader(file),
+		next:   offset,
+	}, nil
+}
+
+// Next returns the next change of the stream or io.EOF if there are no
+// more changes yet. Next can be called again after io.EOF to tail the
+// stream.
+func (r *ChangeReader) Next() (Change, error) {
+	for len(r.pending) == 0 {
+		payload, err := readRecord(r.reader)
+
+		if err == io.EOF || err == errTornRecord {
+			// the record is read again when written completely
+			if _, err = r.file.Seek(r.pos, os.SEEK_SET); err != nil {
+				return Change{}, err
+			}
+
+			r.reader.Reset(r.file)
+			return Change{}, io.EOF
+		}
+
+		if err != nil {
+			return Change{}, err
+		}
+
+		first, commands, err := decodeChanges(payload)
+
+		if err != nil {
+			return Change{}, err
+		}
+
+		r.pos += int64(8 + len(payload))
+
+		for n, cmd := range commands {
+			if seq := first + uint64(n); seq >= r.next {
+				r.pending = append(r.pending, Change{Seq: seq, Command: cmd})
+			}
+		}
+	}
+
+	change := r.pending[0]
+	r.pending = r.pending[1:]
+	r.next = change.Seq + 1
+
+	return change, nil
+}
+
+// Close closes the reader.
+func (r *ChangeReader) Close() error {
+	return r.file.Close()
+}
+
+// Changes opens the change stream of the engine (see NGConfig.ChangesPath)
+// to read the changes from the sequence number `offset`, like
+// OpenChanges.
+func (ng *Engine) Changes(offset uint64) (*ChangeReader, error) {
+	if ng.changes == nil {
+		return nil, errors.New("Change stream not enabled")
+	}
+
+	ng.changes.mu.Lock()
+	err := ng.changes.open()
+	ng.changes.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenChanges(ng.config.ChangesPath, offset)
+}
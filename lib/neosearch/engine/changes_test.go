@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+// readChanges returns the keys of the changes of `reader` until io.EOF
+// and the sequence number of the last change.
+func readChanges(t *testing.T, reader *ChangeReader) ([]string, uint64) {
+	var (
+		keys []string
+		seq  uint64
+	)
+
+	for {
+		change, err := reader.Next()
+
+		if err == io.EOF {
+			return keys, seq
+		}
+
+		if err != nil {
+			t.Error(err)
+			return keys, seq
+		}
+
+		if change.Seq != seq+1 && seq != 0 {
+			t.Errorf("Change %d after change %d", change.Seq, seq)
+		}
+
+		keys = append(keys, string(change.Command.Key))
+		seq = change.Seq
+	}
+}
+
+func TestEngineChanges(t *testing.T) {
+	var (
+		indexName = "engine-changes"
+		indexDir  = DataDirTmp + "/" + indexName
+		path      = indexDir + "/changes.log"
+		reader    *ChangeReader
+		keys      []string
+		seq       uint64
+		file      *os.File
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+		ChangesPath: path,
+	}
+
+	ng := New(cfg)
+
+	reader, err = ng.Changes(0)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if keys, _ = readChanges(t, reader); len(keys) != 0 {
+		t.Errorf("Changes in an empty stream: %v", keys)
+	}
+
+	execSequence(t, ng, []Command{
+		{Index: indexName, Database: "name.idx", Command: "set", Key: []byte("a"), Value: []byte("1")},
+		{Index: indexName, Database: "name.idx", Command: "get", Key: []byte("a")},
+		{Index: indexName, Database: "name.idx", Command: "mergeset", Key: []byte("b"), Value: utils.Uint64ToBytes(1)},
+	})
+
+	// the reader tails the stream
+	keys, seq = readChanges(t, reader)
+
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" || seq != 2 {
+		t.Errorf("Unexpected changes: %v (last %d)", keys, seq)
+	}
+
+	if _, err = ng.ExecuteAll([]Command{
+		{Index: indexName, Database: "name.idx", Command: "delete", Key: []byte("c")},
+		{Index: indexName, Database: "document.db", Command: "set", Key: []byte("d"), Value: []byte("2")},
+	}); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if keys, seq = readChanges(t, reader); len(keys) != 2 || seq != 4 {
+		t.Errorf("Unexpected changes: %v (last %d)", keys, seq)
+	}
+
+	reader.Close()
+	ng.Close()
+
+	// a torn record at the end is discarded when the stream is opened
+	// again, and the sequence continues
+	if file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	file.Write([]byte{0, 0, 0, 10, 1})
+	file.Close()
+
+	ng = New(cfg)
+
+	execSequence(t, ng, []Command{
+		{Index: indexName, Database: "name.idx", Command: "set", Key: []byte("e"), Value: []byte("3")},
+	})
+
+	if reader, err = ng.Changes(3); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	defer reader.Close()
+
+	if keys, seq = readChanges(t, reader); len(keys) != 3 || keys[0] != "c" || keys[2] != "e" || seq != 5 {
+		t.Errorf("Unexpected changes from 3: %v (last %d)", keys, seq)
+	}
+
+cleanup:
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
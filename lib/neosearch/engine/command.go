@@ -1,9 +1,14 @@
 package engine
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
 )
@@ -17,7 +22,12 @@ import (
 //   - KeyType
 //   - Value
 //   - ValueType
+//   - Limit
 //   - Batch
+//
+// The scan command reads the keys from Key (inclusive) to Value
+// (exclusive) and the scan and prefix commands return at most Limit
+// key/value pairs, if Limit isn't zero.
 type Command struct {
 	Index     string
 	Database  string
@@ -26,16 +36,49 @@ type Command struct {
 	KeyType   uint8
 	Value     []byte
 	ValueType uint8
+	Limit     uint64
 
 	Batch bool
 }
 
+// IsQuery returns true if the command returns many key/value pairs and is
+// executed by Engine.Query.
+func (c Command) IsQuery() bool {
+	switch c.Command {
+	case "scan", "prefix", "first", "last":
+		return true
+	}
+
+	return false
+}
+
 func (c Command) Println() {
-	line := c.Reverse()
+	line, err := c.ReverseErr()
+
+	if err != nil {
+		line = err.Error()
+	}
+
 	fmt.Println(line)
 }
 
+// Reverse is like ReverseErr, but panics if the command is invalid.
 func (c Command) Reverse() string {
+	line, err := c.ReverseErr()
+
+	if err != nil {
+		panic(err)
+	}
+
+	return line
+}
+
+// ReverseErr returns the command in the syntax of neosearch-cli. Strings
+// are single quoted with the quote, the backslash and the bytes that
+// aren't printable UTF-8 escaped, then any key or value is read back
+// unchanged by the cli parser. Commands or types of keys and values
+// unknown return an error.
+func (c Command) ReverseErr() (string, error) {
 	var (
 		keyStr string
 		valStr string
@@ -43,48 +86,112 @@ func (c Command) Reverse() string {
 	)
 
 	if c.Key != nil {
-		if c.KeyType == TypeString {
-			keyStr = `'` + string(c.Key) + `'`
-		} else if c.KeyType == TypeUint {
-			keyStr = `uint(` + strconv.Itoa(int(utils.BytesToUint64(c.Key))) + `)`
-		} else if c.KeyType == TypeInt {
-			keyStr = `int(` + strconv.Itoa(int(utils.BytesToInt64(c.Key))) + `)`
-		} else if c.KeyType == TypeFloat {
-			keyStr = `float(` + strconv.FormatFloat(utils.BytesToFloat64(c.Key), 'f', -1, 64) + `)`
-		} else if c.KeyType == TypeBool {
-			keyStr = `bool(` + string(c.Key) + `)`
-		} else {
-			fmt.Printf("Command error: %+v", c)
-			panic(fmt.Errorf("Invalid command key type: %d - %+v", c.KeyType, string(c.Key)))
+		keyStr = reverseLiteral(c.Key, c.KeyType)
+
+		if keyStr == "" {
+			return "", fmt.Errorf("Invalid command key type: %d - %+v", c.KeyType, string(c.Key))
 		}
 	}
 
 	if c.Value != nil {
-		if c.ValueType == TypeString {
-			valStr = `'` + string(c.Value) + `'`
-		} else if c.ValueType == TypeUint {
-			valStr = `uint(` + strconv.Itoa(int(utils.BytesToUint64(c.Value))) + `)`
-		} else if c.ValueType == TypeInt {
-			valStr = `int(` + strconv.Itoa(int(utils.BytesToInt64(c.Value))) + `)`
-		} else if c.ValueType == TypeFloat {
-			valStr = `float(` + strconv.FormatFloat(utils.BytesToFloat64(c.Value), 'f', -1, 64) + `)`
-		} else if c.ValueType == TypeBool {
-			valStr = `bool(` + string(c.Value) + `)`
-		} else {
-			panic(fmt.Errorf("Invalid command key type: %d", c.ValueType))
+		valStr = reverseLiteral(c.Value, c.ValueType)
+
+		if valStr == "" {
+			return "", fmt.Errorf("Invalid command value type: %d", c.ValueType)
 		}
 	}
 
 	switch strings.ToUpper(c.Command) {
-	case "SET", "MERGESET":
+	case "SET", "MERGESET", "MERGEDEL":
 		line = fmt.Sprintf("USING %s.%s %s %s %s;", c.Index, c.Database, strings.ToUpper(c.Command), keyStr, valStr)
-	case "BATCH", "flushbatch":
+	case "BATCH", "FLUSHBATCH", "COUNT", "FIRST", "LAST":
 		line = fmt.Sprintf("USING %s.%s %s;", c.Index, c.Database, strings.ToUpper(c.Command))
 	case "GET", "DELETE":
 		line = fmt.Sprintf("USING %s.%s %s %s;", c.Index, c.Database, strings.ToUpper(c.Command), keyStr)
+	case "SCAN":
+		line = fmt.Sprintf("USING %s.%s SCAN %s %s%s;", c.Index, c.Database, keyStr, valStr, c.reverseLimit())
+	case "PREFIX":
+		line = fmt.Sprintf("USING %s.%s PREFIX %s%s;", c.Index, c.Database, keyStr, c.reverseLimit())
 	default:
-		panic(fmt.Errorf("Invalid command: %s: %v", strings.ToUpper(c.Command), c))
+		return "", fmt.Errorf("Invalid command: %s: %v", strings.ToUpper(c.Command), c)
 	}
 
-	return line
+	return line, nil
+}
+
+// reverseLimit returns the LIMIT clause of the command, if any.
+func (c Command) reverseLimit() string {
+	if c.Limit == 0 {
+		return ""
+	}
+
+	return " LIMIT " + strconv.FormatUint(c.Limit, 10)
+}
+
+// Literal returns the literal of `data` of type `kvType` in the syntax of
+// neosearch-cli, like Reverse, or an empty string if the type isn't
+// supported.
+func Literal(data []byte, kvType uint8) string {
+	return reverseLiteral(data, kvType)
+}
+
+// reverseLiteral returns the literal of `data` of type `kvType` or an
+// empty string if the type isn't supported.
+func reverseLiteral(data []byte, kvType uint8) string {
+	switch kvType {
+	case TypeString:
+		return quoteString(data)
+	case TypeUint:
+		return `uint(` + strconv.FormatUint(utils.BytesToUint64(data), 10) + `)`
+	case TypeInt:
+		return `int(` + strconv.FormatInt(utils.BytesToInt64(data), 10) + `)`
+	case TypeFloat:
+		return `float(` + strconv.FormatFloat(utils.BytesToFloat64(data), 'f', -1, 64) + `)`
+	case TypeBool:
+		return `bool(` + strconv.FormatBool(utils.BytesToBool(data)) + `)`
+	case TypeDate:
+		nsec := utils.BytesToInt64(data)
+		return `date(` + time.Unix(0, nsec).UTC().Format(time.RFC3339Nano) + `)`
+	case TypeBinary:
+		return `hex(` + hex.EncodeToString(data) + `)`
+	}
+
+	return ""
+}
+
+// quoteString returns `data` single quoted in the syntax of neosearch-cli.
+// Backslash, single quote, line breaks and tabs are escaped with a
+// backslash and the other bytes that aren't printable UTF-8 with \xHH.
+func quoteString(data []byte) string {
+	var buf bytes.Buffer
+
+	buf.WriteByte('\'')
+
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+
+		switch {
+		case r == '\\' || r == '\'':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == utf8.RuneError || !unicode.IsPrint(r):
+			for _, b := range data[:size] {
+				fmt.Fprintf(&buf, `\x%02x`, b)
+			}
+		default:
+			buf.Write(data[:size])
+		}
+
+		data = data[size:]
+	}
+
+	buf.WriteByte('\'')
+
+	return buf.String()
 }
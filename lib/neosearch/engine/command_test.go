@@ -47,6 +47,50 @@ func TestCommand(t *testing.T) {
 			},
 			expected: `USING empresas.name.idx GET 'teste';`,
 		},
+		{
+			cmd: Command{
+				Database:  "name.idx",
+				Index:     "empresas",
+				Command:   "set",
+				Key:       []byte("it's\n\\ \x00"),
+				KeyType:   TypeString,
+				Value:     utils.Uint64ToBytes(18446744073709551615),
+				ValueType: TypeUint,
+			},
+			expected: `USING empresas.name.idx SET 'it\'s\n\\ \x00' uint(18446744073709551615);`,
+		},
+		{
+			cmd: Command{
+				Database: "name.idx",
+				Index:    "empresas",
+				Command:  "flushbatch",
+			},
+			expected: `USING empresas.name.idx FLUSHBATCH;`,
+		},
+		{
+			cmd: Command{
+				Database:  "blob.db",
+				Index:     "empresas",
+				Command:   "set",
+				Key:       []byte{0, 0xff, 0x10},
+				KeyType:   TypeBinary,
+				Value:     []byte{},
+				ValueType: TypeBinary,
+			},
+			expected: `USING empresas.blob.db SET hex(00ff10) hex();`,
+		},
+		{
+			cmd: Command{
+				Database:  "born.idx",
+				Index:     "empresas",
+				Command:   "mergeset",
+				Key:       utils.Int64ToBytes(57974400000000001),
+				KeyType:   TypeDate,
+				Value:     utils.Uint64ToBytes(1),
+				ValueType: TypeUint,
+			},
+			expected: `USING empresas.born.idx MERGESET date(1971-11-03T00:00:00.000000001Z) uint(1);`,
+		},
 	} {
 		cmdRev := testTable.cmd.Reverse()
 
@@ -55,3 +99,34 @@ func TestCommand(t *testing.T) {
 		}
 	}
 }
+
+func TestCommandReverseErr(t *testing.T) {
+	for _, cmd := range []Command{
+		{
+			Database: "test.db",
+			Index:    "empresas",
+			Command:  "set",
+			Key:      []byte("a"),
+			KeyType:  TypeNil,
+			Value:    []byte("b"),
+		},
+		{
+			Database:  "test.db",
+			Index:     "empresas",
+			Command:   "set",
+			Key:       []byte("a"),
+			KeyType:   TypeString,
+			Value:     []byte("b"),
+			ValueType: 255,
+		},
+		{
+			Database: "test.db",
+			Index:    "empresas",
+			Command:  "drop",
+		},
+	} {
+		if line, err := cmd.ReverseErr(); err == nil {
+			t.Errorf("Invalid command reversed: %s", line)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EncodingVersion is the version of the binary encoding of commands
+// written by Command.MarshalBinary and MarshalCommands.
+//
+// The encoding starts with the version byte, followed by one command
+// (MarshalBinary) or by the number of commands and the commands
+// (MarshalCommands). A command is encoded as:
+//
+//	index | database | command | key | key type | value | value type | limit
+//
+// where the strings and byte slices are the uvarint of their length plus
+// one (zero is nil) followed by the bytes, the types are one byte and
+// the limit is an uvarint. The Batch field isn't encoded.
+const EncodingVersion uint8 = 1
+
+var errInvalidEncoding = errors.New("Invalid command encoding")
+
+// MarshalBinary returns the binary encoding of the command (see
+// EncodingVersion).
+func (c Command) MarshalBinary() ([]byte, error) {
+	buf := []byte{EncodingVersion}
+	return encodeCommandV1(buf, c), nil
+}
+
+// UnmarshalBinary decodes the binary encoding `data` of a command, written
+// by MarshalBinary.
+func (c *Command) UnmarshalBinary(data []byte) error {
+	d, err := versionDecoder(data)
+
+	if err != nil {
+		return err
+	}
+
+	cmd := d.commandV1()
+
+	if d.err != nil || len(d.data) != 0 {
+		return errInvalidEncoding
+	}
+
+	*c = cmd
+	return nil
+}
+
+// MarshalCommands returns the binary encoding of the batch of commands
+// `commands` (see EncodingVersion).
+func MarshalCommands(commands []Command) []byte {
+	buf := []byte{EncodingVersion}
+	buf = appendUvarint(buf, uint64(len(commands)))
+
+	for _, cmd := range commands {
+		buf = encodeCommandV1(buf, cmd)
+	}
+
+	return buf
+}
+
+// UnmarshalCommands decodes the binary encoding `data` of a batch of
+// commands, written by MarshalCommands.
+func UnmarshalCommands(data []byte) ([]Command, error) {
+	d, err := versionDecoder(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	count := d.uvarint()
+
+	if d.err != nil || count > uint64(len(d.data)) {
+		return nil, errInvalidEncoding
+	}
+
+	commands := make([]Command, 0, count)
+
+	for n := uint64(0); n < count; n++ {
+		cmd := d.commandV1()
+
+		if d.err != nil {
+			return nil, errInvalidEncoding
+		}
+
+		commands = append(commands, cmd)
+	}
+
+	if len(d.data) != 0 {
+		return nil, errInvalidEncoding
+	}
+
+	return commands, nil
+}
+
+// versionDecoder checks the version of the encoding `data` and returns a
+// decoder of the data after the version.
+func versionDecoder(data []byte) (*commandDecoder, error) {
+	if len(data) == 0 {
+		return nil, errInvalidEncoding
+	}
+
+	if data[0] != EncodingVersion {
+		return nil, fmt.Errorf("Unsupported command encoding version: %d", data[0])
+	}
+
+	return &commandDecoder{data: data[1:]}, nil
+}
+
+// encodeCommandV1 appends the fields of `cmd` to `buf`, in the version 1
+// of the encoding.
+func encodeCommandV1(buf []byte, cmd Command) []byte {
+	buf = encodeCommand(buf, cmd)
+	return appendUvarint(buf, cmd.Limit)
+}
+
+// commandV1 decodes a command in the version 1 of the encoding.
+func (d *commandDecoder) commandV1() Command {
+	cmd := d.command()
+	cmd.Limit = d.uvarint()
+
+	return cmd
+}
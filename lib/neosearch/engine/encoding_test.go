@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+func TestCommandBinaryEncoding(t *testing.T) {
+	commands := []Command{
+		{
+			Index:     "sample",
+			Database:  "document.db",
+			Command:   "set",
+			Key:       utils.Uint64ToBytes(1),
+			KeyType:   TypeUint,
+			Value:     []byte(`{"name": "neoway"}`),
+			ValueType: TypeString,
+		},
+		{
+			Index:     "sample",
+			Database:  "blob.idx",
+			Command:   "mergeset",
+			Key:       []byte{0, 0xff, '\n', 0},
+			KeyType:   TypeBinary,
+			Value:     utils.Uint64ToBytes(7),
+			ValueType: TypeUint,
+		},
+		{
+			Index:    "sample",
+			Database: "name.idx",
+			Command:  "scan",
+			Key:      []byte{},
+			KeyType:  TypeString,
+			Value:    []byte("z"),
+			Limit:    1 << 40,
+		},
+		{
+			Index:    "sample",
+			Database: "name.idx",
+			Command:  "count",
+		},
+	}
+
+	for _, cmd := range commands {
+		data, err := cmd.MarshalBinary()
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		var decoded Command
+
+		if err = decoded.UnmarshalBinary(data); err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if !reflect.DeepEqual(decoded, cmd) {
+			t.Errorf("Decoded %+v != %+v", decoded, cmd)
+		}
+	}
+
+	data := MarshalCommands(commands)
+	decoded, err := UnmarshalCommands(data)
+
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(decoded, commands) {
+		t.Errorf("Decoded batch %+v != %+v", decoded, commands)
+	}
+
+	if decoded, err = UnmarshalCommands(MarshalCommands(nil)); err != nil || len(decoded) != 0 {
+		t.Errorf("Decoded empty batch: %v (%v)", decoded, err)
+	}
+
+	for _, invalid := range [][]byte{
+		nil,
+		{2, 0},
+		data[:len(data)-1],
+		append(append([]byte{}, data...), 0),
+	} {
+		if _, err = UnmarshalCommands(invalid); err == nil {
+			t.Errorf("Invalid encoding decoded: %v", invalid)
+		}
+	}
+
+	var cmd Command
+
+	if err = cmd.UnmarshalBinary(data); err == nil {
+		t.Error("Batch decoded as a command")
+	}
+}
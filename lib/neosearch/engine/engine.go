@@ -2,10 +2,15 @@ package engine
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch/cache"
 	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
 	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -30,12 +35,52 @@ type NGConfig struct {
 
 	// Default batch write size
 	BatchSize int
+
+	// LogPath is the path of the coordinating log of ExecuteAll. If
+	// set, ExecuteAll is all-or-nothing and Recover completes the
+	// executions interrupted by a crash.
+	LogPath string
+
+	// ChangesPath is the path of the change stream. If set, the writes
+	// executed (set, mergeset, mergedel and delete) are appended to the
+	// stream, with sequence numbers, and can be read with Changes.
+	ChangesPath string
 }
 
-// Engine type
+// Engine type. The Engine is safe for concurrent use.
 type Engine struct {
+	// serializes the open and close of stores
+	mu sync.Mutex
+
 	stores cache.Cache
 	config NGConfig
+
+	// stores removed from the cache, but still acquired
+	evicted map[string]*storeRef
+
+	// serializes the all-or-nothing executions, that share the log.
+	// logPending is true if the log has groups of commands not written
+	// in the stores yet.
+	logMu      sync.Mutex
+	log        *commandLog
+	logPending bool
+
+	// nil if NGConfig.ChangesPath isn't set
+	changes *changeStream
+
+	hooksMu   sync.RWMutex
+	preHooks  []PreExecuteHook
+	postHooks []PostExecuteHook
+}
+
+// storeRef is an open store and the number of users that acquired it.
+// The fields are guarded by Engine.mu.
+type storeRef struct {
+	store.KVStore
+
+	// <index>.<database>
+	name string
+	refs int
 }
 
 const (
@@ -45,9 +90,9 @@ const (
 	TypeInt
 	TypeFloat
 	TypeString
-	TypeDate
+	TypeDate // nanoseconds since the Unix epoch, like TypeInt
 	TypeBool
-	TypeBinary // TODO: TBD
+	TypeBinary
 )
 
 // New creates a new Engine instance
@@ -64,63 +109,137 @@ func New(config NGConfig) *Engine {
 	}
 
 	ng := &Engine{
-		config: config,
-		stores: cache.NewLRUCache(config.OpenCacheSize),
+		config:  config,
+		stores:  cache.NewLRUCache(config.OpenCacheSize),
+		evicted: make(map[string]*storeRef),
+	}
+
+	if config.ChangesPath != "" {
+		ng.changes = &changeStream{path: config.ChangesPath}
 	}
 
+	// the cache is only changed with ng.mu held
 	ng.stores.OnRemove(func(key string, value interface{}) {
-		storekv, ok := value.(store.KVStore)
+		ref, ok := value.(*storeRef)
 
 		if !ok {
 			panic("Unexpected value in cache")
 		}
 
-		if storekv.IsOpen() {
-			storekv.Close()
+		if ref.refs > 0 {
+			ng.evicted[key] = ref
+			return
 		}
+
+		ref.Close()
 	})
 
 	return ng
 }
 
-// Open the index and cache then for future uses
-func (ng *Engine) open(indexName, databaseName string) (store.KVStore, error) {
+// Open the index and cache then for future uses. The store returned is
+// acquired and must be released with ReleaseStore.
+func (ng *Engine) open(indexName, databaseName string) (*storeRef, error) {
 	var (
 		err     error
 		storekv store.KVStore
+		ref     *storeRef
 		ok      bool
 		value   interface{}
+		key     = indexName + "." + databaseName
 	)
 
-	value, ok = ng.stores.Get(indexName + "." + databaseName)
+	ng.mu.Lock()
+	defer ng.mu.Unlock()
+
+	value, ok = ng.stores.Get(key)
 
-	if ok == false || value == nil {
+	if ok && value != nil {
+		ref, ok = value.(*storeRef)
+
+		if !ok {
+			return nil, errors.New("Failed to convert cache entry to KVStore")
+		}
+	} else if ref, ok = ng.evicted[key]; ok {
+		// still in use, then it's cached again instead of reopened
+		delete(ng.evicted, key)
+		ng.stores.Add(key, ref)
+	} else {
 		storekv, err = store.New(ng.config.KVCfg)
 
 		if err != nil {
 			return nil, err
 		}
 
-		ng.stores.Add(indexName+"."+databaseName, storekv)
 		err = storekv.Open(indexName, databaseName)
 
-		return storekv, err
+		if err != nil {
+			return nil, err
+		}
+
+		ref = &storeRef{KVStore: storekv, name: key}
+		ng.stores.Add(key, ref)
+	}
+
+	ref.refs++
+	return ref, nil
+}
+
+// Execute the given command. The hooks of the engine are called before
+// and after the command and the writes are appended to the change
+// stream, if enabled.
+func (ng *Engine) Execute(cmd Command) ([]byte, error) {
+	return ng.ExecuteContext(context.Background(), cmd)
+}
+
+// ExecuteContext is like Execute, but the command isn't executed if `ctx`
+// is done, and count stops when `ctx` is done. The error returned is the
+// error of `ctx`.
+func (ng *Engine) ExecuteContext(ctx context.Context, cmd Command) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = ng.preExecute(cmd); err != nil {
+		return nil, err
 	}
 
-	storekv, ok = value.(store.KVStore)
+	if ng.changes != nil && isWrite(cmd.Command) {
+		ng.changes.mu.Lock()
+
+		if data, err = ng.execute(ctx, cmd); err == nil {
+			err = ng.changes.append([]Command{cmd})
+		}
 
-	if ok {
-		return storekv, nil
+		ng.changes.mu.Unlock()
+	} else {
+		data, err = ng.execute(ctx, cmd)
 	}
 
-	return nil, errors.New("Failed to convert cache entry to KVStore")
+	ng.postExecute(cmd, data, err)
+	return data, err
 }
 
-// Execute the given command
-func (ng *Engine) Execute(cmd Command) ([]byte, error) {
+// isWrite returns true if the command `command` changes the store.
+func isWrite(command string) bool {
+	switch command {
+	case "set", "mergeset", "mergedel", "delete":
+		return true
+	}
+
+	return false
+}
+
+// execute executes the command in its store, without the hooks.
+func (ng *Engine) execute(ctx context.Context, cmd Command) ([]byte, error) {
 	var err error
 
-	store, err := ng.GetStore(cmd.Index, cmd.Database)
+	store, err := ng.AcquireStore(cmd.Index, cmd.Database)
 
 	if ng.config.KVCfg.Debug {
 		cmd.Println()
@@ -130,13 +249,11 @@ func (ng *Engine) Execute(cmd Command) ([]byte, error) {
 		return nil, err
 	}
 
+	defer ng.ReleaseStore(store)
+
 	switch cmd.Command {
-	case "batch":
-		store.StartBatch()
-		return nil, nil
-	case "flushbatch":
-		err = store.FlushBatch()
-		return nil, err
+	case "batch", "flushbatch":
+		return nil, errors.New("Batches are executed by a Session or a Batch")
 	case "set":
 		err = store.Set(cmd.Key, cmd.Value)
 		return nil, err
@@ -145,34 +262,131 @@ func (ng *Engine) Execute(cmd Command) ([]byte, error) {
 	case "mergeset":
 		v := utils.BytesToUint64(cmd.Value)
 		return nil, store.MergeSet(cmd.Key, v)
+	case "mergedel":
+		v := utils.BytesToUint64(cmd.Value)
+		return nil, store.MergeDel(cmd.Key, v)
 	case "delete":
 		err = store.Delete(cmd.Key)
 		return nil, err
+	case "count":
+		n, err := count(ctx, store)
+		return utils.Uint64ToBytes(n), err
+	case "scan", "prefix", "first", "last":
+		return nil, fmt.Errorf("Command %s returns key/value pairs, use Query", cmd.Command)
 	}
 
 	return nil, errors.New("Failed to execute command.")
 }
 
-// GetStore returns a instance of KVStore for the given index name
-// If the given index name isn't open, then this method will open
-// and cache the index for next use.
-func (ng *Engine) GetStore(indexName string, databaseName string) (store.KVStore, error) {
-	var (
-		err     error
-		storekv store.KVStore
-	)
-
-	storekv, err = ng.open(indexName, databaseName)
+// AcquireStore returns the store `databaseName` of index `indexName`,
+// opening and caching it if needed. The store isn't closed until
+// released with ReleaseStore, even if removed from the cache of open
+// stores in the meantime.
+func (ng *Engine) AcquireStore(indexName, databaseName string) (store.KVStore, error) {
+	ref, err := ng.open(indexName, databaseName)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return storekv, nil
+	return ref, nil
+}
+
+// ReleaseStore releases a store acquired with AcquireStore. The store is
+// closed if it was removed from the cache and this was the last user.
+func (ng *Engine) ReleaseStore(storekv store.KVStore) error {
+	ref, ok := storekv.(*storeRef)
+
+	if !ok {
+		return errors.New("Store not acquired with AcquireStore")
+	}
+
+	ng.mu.Lock()
+	defer ng.mu.Unlock()
+
+	if ref.refs <= 0 {
+		return errors.New("Store released more times than acquired")
+	}
+
+	ref.refs--
+
+	if ref.refs > 0 {
+		return nil
+	}
+
+	if evicted, ok := ng.evicted[ref.name]; ok && evicted == ref {
+		delete(ng.evicted, ref.name)
+		ref.Close()
+	}
+
+	return nil
+}
+
+// CloseStore closes the database `databaseName` of index `indexName`, if
+// open. The next use will open it again. If the store is acquired, it's
+// closed when released.
+func (ng *Engine) CloseStore(indexName, databaseName string) {
+	ng.mu.Lock()
+	defer ng.mu.Unlock()
+
+	ng.stores.Remove(indexName + "." + databaseName)
+}
+
+// RemoveStore closes the database `databaseName` of index `indexName` and
+// removes its files. It fails if the store is acquired, by AcquireStore or
+// by the batches not committed yet, then the files of a store in use are
+// never removed.
+func (ng *Engine) RemoveStore(indexName, databaseName string) error {
+	key := indexName + "." + databaseName
+
+	ng.mu.Lock()
+	defer ng.mu.Unlock()
+
+	ref, ok := ng.evicted[key]
+
+	if !ok {
+		if value, cached := ng.stores.Get(key); cached && value != nil {
+			ref, ok = value.(*storeRef)
+		}
+	}
+
+	if ok && ref.refs > 0 {
+		return fmt.Errorf("Database '%s' is in use", key)
+	}
+
+	ng.stores.Remove(key)
+
+	return os.RemoveAll(ng.config.KVCfg.DataDir + string(filepath.Separator) +
+		indexName + string(filepath.Separator) + databaseName)
 }
 
-// Close all of the open databases
-func (ng *Engine) Close() {
+// Close all of the open databases, the log of ExecuteAll and the change
+// stream. The stores acquired, by AcquireStore or by the batches not
+// committed yet, are closed when released.
+func (ng *Engine) Close() error {
+	var err error
+
+	ng.mu.Lock()
+
 	// Clean will un-ref and Close the databases
 	ng.stores.Clean()
+	ng.mu.Unlock()
+
+	if ng.changes != nil {
+		err = ng.changes.close()
+	}
+
+	ng.logMu.Lock()
+	defer ng.logMu.Unlock()
+
+	if ng.log == nil {
+		return err
+	}
+
+	if e := ng.log.close(); e != nil && err == nil {
+		err = e
+	}
+
+	ng.log = nil
+	return err
 }
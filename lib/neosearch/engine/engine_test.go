@@ -3,6 +3,9 @@ package engine
 import (
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
@@ -34,12 +37,15 @@ func execSequence(t *testing.T, ng *Engine, cmds []Command) {
 }
 
 func cmpIterator(t *testing.T, itReturns []map[int64]string, ng *Engine, seek []byte, index, database string) {
-	storekv, err := ng.GetStore(index, database)
+	storekv, err := ng.AcquireStore(index, database)
 
 	if err != nil {
 		t.Error(err)
+		return
 	}
 
+	defer ng.ReleaseStore(storekv)
+
 	it := storekv.GetIterator()
 
 	it.Seek(seek)
@@ -167,3 +173,327 @@ func TestEngineIntegerKeyOrder(t *testing.T) {
 	defer ng.Close()
 	os.RemoveAll(DataDirTmp)
 }
+
+func TestEngineConcurrentExecute(t *testing.T) {
+	var (
+		indexName = "concurrent"
+		indexDir  = DataDirTmp + "/" + indexName
+		wg        sync.WaitGroup
+	)
+
+	if err := os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+	})
+
+	// every goroutine opens the same stores and merges ids in the
+	// same key
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < 50; i++ {
+				database := "test" + strconv.Itoa(i%5) + ".idx"
+
+				_, err := ng.Execute(Command{
+					Index:     indexName,
+					Database:  database,
+					Command:   "mergeset",
+					Key:       []byte("ids"),
+					KeyType:   TypeString,
+					Value:     utils.Uint64ToBytes(uint64(g*50 + i)),
+					ValueType: TypeUint,
+				})
+
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				_, err = ng.Execute(Command{
+					Index:    indexName,
+					Database: database,
+					Command:  "get",
+					Key:      []byte("ids"),
+					KeyType:  TypeString,
+				})
+
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+
+	for i := 0; i < 5; i++ {
+		data, err := ng.Execute(Command{
+			Index:    indexName,
+			Database: "test" + strconv.Itoa(i) + ".idx",
+			Command:  "get",
+			Key:      []byte("ids"),
+			KeyType:  TypeString,
+		})
+
+		if err != nil {
+			t.Error(err)
+		} else if len(data) != 8*10*8 {
+			t.Errorf("Store test%d.idx should have 80 ids, but have %d", i, len(data)/8)
+		}
+	}
+
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestEngineAcquireStoreEviction(t *testing.T) {
+	var (
+		indexName = "eviction"
+		indexDir  = DataDirTmp + "/" + indexName
+		storeA    store.KVStore
+		storeB    store.KVStore
+		batch     *Batch
+		data      []byte
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+		OpenCacheSize: 1,
+	})
+
+	storeA, err = ng.AcquireStore(indexName, "a.idx")
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	// the batch acquires a.idx too
+	batch = ng.NewBatch()
+
+	err = batch.Execute(Command{
+		Index:    indexName,
+		Database: "a.idx",
+		Command:  "set",
+		Key:      []byte("key"),
+		Value:    []byte("value"),
+	})
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	// evicts a.idx from the cache
+	if storeB, err = ng.AcquireStore(indexName, "b.idx"); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	ng.ReleaseStore(storeB)
+
+	if !storeA.IsOpen() {
+		t.Error("Acquired store closed on eviction")
+		goto cleanup
+	}
+
+	// still usable while acquired
+	if err = storeA.Set([]byte("key2"), []byte("value2")); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if err = ng.ReleaseStore(storeA); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !storeA.IsOpen() {
+		t.Error("Store closed with a batch pending")
+		goto cleanup
+	}
+
+	if err = batch.Commit(); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if storeA.IsOpen() {
+		t.Error("Evicted store not closed on release")
+		goto cleanup
+	}
+
+	for key, value := range map[string]string{"key": "value", "key2": "value2"} {
+		data, err = ng.Execute(Command{
+			Index:    indexName,
+			Database: "a.idx",
+			Command:  "get",
+			Key:      []byte(key),
+			KeyType:  TypeString,
+		})
+
+		if err != nil {
+			t.Error(err)
+		} else if string(data) != value {
+			t.Errorf("Write lost on eviction: '%s'", string(data))
+		}
+	}
+
+	if err = ng.ReleaseStore(storeA); err == nil {
+		t.Error("Store released twice")
+	}
+
+cleanup:
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestEngineMergeDel(t *testing.T) {
+	var (
+		indexName = "engine-mergedel"
+		indexDir  = DataDirTmp + "/" + indexName
+		data      []byte
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+	})
+
+	defer func() {
+		ng.Close()
+		os.RemoveAll(indexDir)
+	}()
+
+	for _, v := range []uint64{1, 2, 3} {
+		execSequence(t, ng, []Command{
+			{Index: indexName, Database: "mergedel.idx", Command: "mergeset", Key: []byte("neoway"), Value: utils.Uint64ToBytes(v)},
+		})
+	}
+
+	execSequence(t, ng, []Command{
+		{Index: indexName, Database: "mergedel.idx", Command: "mergedel", Key: []byte("neoway"), Value: utils.Uint64ToBytes(2)},
+	})
+
+	data, err = ng.Execute(Command{Index: indexName, Database: "mergedel.idx", Command: "get", Key: []byte("neoway")})
+
+	if err != nil || !reflect.DeepEqual(utils.GetUint64Array(data), []uint64{1, 3}) {
+		t.Errorf("Unexpected postings after mergedel: %v (%v)", utils.GetUint64Array(data), err)
+	}
+
+	// the key is deleted with the last id
+	batch := ng.NewBatch()
+
+	for _, v := range []uint64{1, 3} {
+		err = batch.Execute(Command{Index: indexName, Database: "mergedel.idx", Command: "mergedel", Key: []byte("neoway"), Value: utils.Uint64ToBytes(v)})
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if err = batch.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	data, err = ng.Execute(Command{Index: indexName, Database: "mergedel.idx", Command: "count"})
+
+	if err != nil || utils.BytesToUint64(data) != 0 {
+		t.Errorf("Empty set not deleted: %d keys (%v)", utils.BytesToUint64(data), err)
+	}
+}
+
+func TestEngineRemoveStore(t *testing.T) {
+	var (
+		indexName = "remove-store"
+		indexDir  = DataDirTmp + "/" + indexName
+		storekv   store.KVStore
+		data      []byte
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+	})
+
+	if _, err = ng.Execute(Command{
+		Index:    indexName,
+		Database: "a.idx",
+		Command:  "set",
+		Key:      []byte("key"),
+		Value:    []byte("value"),
+	}); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if storekv, err = ng.AcquireStore(indexName, "a.idx"); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if err = ng.RemoveStore(indexName, "a.idx"); err == nil {
+		t.Error("Acquired store removed")
+	}
+
+	if data, err = storekv.Get([]byte("key")); err != nil || string(data) != "value" {
+		t.Errorf("Acquired store changed: '%s' (%v)", data, err)
+	}
+
+	ng.ReleaseStore(storekv)
+
+	if err = ng.RemoveStore(indexName, "a.idx"); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if _, err = os.Stat(indexDir + "/a.idx"); !os.IsNotExist(err) {
+		t.Errorf("Store files not removed: %v", err)
+	}
+
+	data, err = ng.Execute(Command{
+		Index:    indexName,
+		Database: "a.idx",
+		Command:  "get",
+		Key:      []byte("key"),
+		KeyType:  TypeString,
+	})
+
+	if err != nil || data != nil {
+		t.Errorf("Removed store returned '%s' (%v)", data, err)
+	}
+
+cleanup:
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
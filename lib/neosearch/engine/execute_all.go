@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAborted is the error of the commands not executed because an
+// all-or-nothing execution of ExecuteAll failed.
+var ErrAborted = errors.New("Command not executed: the execution was aborted")
+
+// Result is the result of a command executed by ExecuteAll: the value
+// returned by a get command, or the error of the command.
+type Result struct {
+	Value []byte
+	Err   error
+}
+
+// ExecuteAll executes the set, mergeset, mergedel, delete, get and count
+// commands `commands` and returns the result of each command, in the same
+// order, and the first error. The writes are grouped by store and written
+// with one batch per store, then the get and count commands read the
+// values written.
+//
+// If NGConfig.LogPath is set the execution is all-or-nothing: when any
+// command fails before the writes, nothing is written and the other
+// commands fail with ErrAborted. The writes are appended to the log
+// before the batches are written, then the writes interrupted by a
+// crash are completed by Recover. Otherwise the stores are written
+// independently and the error of a store is the error of its commands
+// only.
+func (ng *Engine) ExecuteAll(commands []Command) ([]Result, error) {
+	var (
+		results = make([]Result, len(commands))
+		batch   = ng.NewBatch()
+		writes  []Command
+		stores  = make([]int, len(commands))
+		reads   []int
+		err     error
+	)
+
+	for n, cmd := range commands {
+		switch cmd.Command {
+		case "get", "count":
+			reads = append(reads, n)
+		case "set", "mergeset", "mergedel", "delete":
+			stores[n], results[n].Err = batch.add(cmd)
+			writes = append(writes, cmd)
+		default:
+			results[n].Err = fmt.Errorf("Command %s can't be executed by ExecuteAll", cmd.Command)
+		}
+
+		if results[n].Err != nil && err == nil {
+			err = results[n].Err
+		}
+	}
+
+	if ng.config.LogPath != "" {
+		if err != nil {
+			batch.Discard()
+			return abort(results), err
+		}
+
+		if err = ng.commitAll(batch, writes, commands, stores, results); err != nil {
+			return results, err
+		}
+	} else if e := storeErrors(batch.commit(), commands, stores, results); err == nil {
+		err = e
+	}
+
+	for _, n := range reads {
+		results[n].Value, results[n].Err = ng.Execute(commands[n])
+
+		if results[n].Err != nil && err == nil {
+			err = results[n].Err
+		}
+	}
+
+	return results, err
+}
+
+// commitAll commits `batch` after appending its commands `writes` to the
+// log. The log is kept when a store fails, to write the commands again
+// on Recover or before the next commit: the log is reset after each
+// commit, then the groups not written are never left behind.
+func (ng *Engine) commitAll(batch *Batch, writes, commands []Command, stores []int, results []Result) error {
+	var err error
+
+	ng.logMu.Lock()
+	defer ng.logMu.Unlock()
+
+	if err = ng.openLog(); err == nil && ng.logPending {
+		err = ng.replayLog()
+	}
+
+	if err == nil {
+		err = ng.log.append(writes, true)
+	}
+
+	if err != nil {
+		batch.Discard()
+
+		for n := range results {
+			results[n].Err = err
+		}
+
+		return err
+	}
+
+	if err = storeErrors(batch.commit(), commands, stores, results); err != nil {
+		ng.logPending = true
+		return err
+	}
+
+	return ng.log.reset()
+}
+
+// storeErrors sets the errors committing the stores `errs` as the results
+// of their writes and returns the first one. stores[n] is the position of
+// the store of commands[n] in `errs`.
+func storeErrors(errs []error, commands []Command, stores []int, results []Result) error {
+	var err error
+
+	for n, cmd := range commands {
+		if cmd.Command == "get" || cmd.Command == "count" || results[n].Err != nil || errs[stores[n]] == nil {
+			continue
+		}
+
+		results[n].Err = errs[stores[n]]
+
+		if err == nil {
+			err = results[n].Err
+		}
+	}
+
+	return err
+}
+
+// abort sets ErrAborted as the result of the commands without errors.
+func abort(results []Result) []Result {
+	for n := range results {
+		if results[n].Err == nil {
+			results[n].Err = ErrAborted
+		}
+	}
+
+	return results
+}
+
+// openLog opens the log of NGConfig.LogPath, if not open. The caller
+// must hold ng.logMu.
+func (ng *Engine) openLog() error {
+	if ng.log != nil {
+		return nil
+	}
+
+	log, err := openLog(ng.config.LogPath)
+
+	if err != nil {
+		return err
+	}
+
+	// the groups left by a crash are pending until recovered
+	groups, err := log.records()
+
+	if err != nil {
+		log.close()
+		return err
+	}
+
+	ng.log = log
+	ng.logPending = len(groups) > 0
+	return nil
+}
+
+// Recover executes again the commands of the executions of ExecuteAll
+// interrupted by a crash, committed to the log of NGConfig.LogPath, and
+// resets the log. The groups of commands are executed again in order and
+// the commands are idempotent (set, mergeset, mergedel and delete), then
+// the commands already in the stores are executed again safely.
+func (ng *Engine) Recover() error {
+	if ng.config.LogPath == "" {
+		return nil
+	}
+
+	ng.logMu.Lock()
+	defer ng.logMu.Unlock()
+
+	if err := ng.openLog(); err != nil {
+		return err
+	}
+
+	return ng.replayLog()
+}
+
+// replayLog executes again the groups of commands of the log and resets
+// it. The caller must hold ng.logMu.
+func (ng *Engine) replayLog() error {
+	groups, err := ng.log.records()
+
+	if err != nil {
+		return err
+	}
+
+	for _, commands := range groups {
+		batch := ng.NewBatch()
+
+		for _, cmd := range commands {
+			// logs written by older versions have batch commands
+			if cmd.Command == "batch" || cmd.Command == "flushbatch" {
+				continue
+			}
+
+			if err = batch.Execute(cmd); err != nil {
+				batch.Discard()
+				return err
+			}
+		}
+
+		if err = batch.Commit(); err != nil {
+			return err
+		}
+	}
+
+	if err = ng.log.reset(); err != nil {
+		return err
+	}
+
+	ng.logPending = false
+	return nil
+}
@@ -0,0 +1,275 @@
+package engine
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+func TestExecuteAll(t *testing.T) {
+	var (
+		indexName = "execute-all"
+		indexDir  = DataDirTmp + "/" + indexName
+		results   []Result
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+	})
+
+	results, err = ng.ExecuteAll([]Command{
+		{Index: indexName, Database: "document.db", Command: "set", Key: utils.Uint64ToBytes(1), Value: []byte("doc")},
+		{Index: indexName, Database: "name.idx", Command: "mergeset", Key: []byte("neoway"), Value: utils.Uint64ToBytes(2)},
+		{Index: indexName, Database: "name.idx", Command: "mergeset", Key: []byte("neoway"), Value: utils.Uint64ToBytes(1)},
+		{Index: indexName, Database: "document.db", Command: "batch"},
+		{Index: indexName, Database: "document.db", Command: "get", Key: utils.Uint64ToBytes(1)},
+		{Index: indexName, Database: "name.idx", Command: "get", Key: []byte("neoway")},
+	})
+
+	if err == nil {
+		t.Error("Batch command executed by ExecuteAll")
+	}
+
+	if len(results) != 6 {
+		t.Errorf("%d results != 6", len(results))
+		goto cleanup
+	}
+
+	for _, n := range []int{0, 1, 2, 4, 5} {
+		if results[n].Err != nil {
+			t.Errorf("Command %d failed: %s", n, results[n].Err)
+		}
+	}
+
+	if results[3].Err == nil {
+		t.Error("Batch command without error")
+	}
+
+	// the writes are independent of the failed command
+	if string(results[4].Value) != "doc" {
+		t.Errorf("Get returned %q", results[4].Value)
+	}
+
+	if !reflect.DeepEqual(results[5].Value, append(utils.Uint64ToBytes(1), utils.Uint64ToBytes(2)...)) {
+		t.Errorf("Get returned %v", results[5].Value)
+	}
+
+cleanup:
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestExecuteAllAtomic(t *testing.T) {
+	var (
+		indexName = "execute-all-atomic"
+		indexDir  = DataDirTmp + "/" + indexName
+		logPath   = indexDir + "/commands.log"
+		results   []Result
+		data      []byte
+		info      os.FileInfo
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+		LogPath: logPath,
+	})
+
+	set := Command{Index: indexName, Database: "document.db", Command: "set", Key: utils.Uint64ToBytes(1), Value: []byte("doc")}
+	get := Command{Index: indexName, Database: "document.db", Command: "get", Key: utils.Uint64ToBytes(1)}
+
+	results, err = ng.ExecuteAll([]Command{set, {Index: indexName, Database: "name.idx", Command: "flushbatch"}})
+
+	if err == nil {
+		t.Error("Flushbatch command executed by ExecuteAll")
+	}
+
+	if len(results) != 2 || results[0].Err != ErrAborted || results[1].Err == nil || results[1].Err == ErrAborted {
+		t.Errorf("Unexpected results of an aborted execution: %+v", results)
+	}
+
+	data, err = ng.Execute(get)
+
+	if err != nil || len(data) != 0 {
+		t.Errorf("Aborted execution written: %q (%v)", data, err)
+	}
+
+	results, err = ng.ExecuteAll([]Command{set, get})
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if string(results[1].Value) != "doc" {
+		t.Errorf("Get returned %q", results[1].Value)
+	}
+
+	// the log is reset after each execution
+	info, err = os.Stat(logPath)
+
+	if err != nil || info.Size() != 0 {
+		t.Errorf("Log should be empty after ExecuteAll: %v (%v)", info, err)
+	}
+
+cleanup:
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestEngineRecover(t *testing.T) {
+	var (
+		indexName = "engine-recover"
+		indexDir  = DataDirTmp + "/" + indexName
+		logPath   = indexDir + "/commands.log"
+		data      []byte
+		info      os.FileInfo
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+		LogPath: logPath,
+	}
+
+	ng := New(cfg)
+
+	commands := []Command{
+		{Index: indexName, Database: "document.db", Command: "set", Key: utils.Uint64ToBytes(1), Value: []byte("doc")},
+		{Index: indexName, Database: "name.idx", Command: "mergeset", Key: []byte("neoway"), Value: utils.Uint64ToBytes(1)},
+	}
+
+	// simulates a crash after the commands were committed to the log,
+	// executing only the first command (document.db)
+	ng.logMu.Lock()
+
+	if err = ng.openLog(); err == nil {
+		err = ng.log.append(commands, true)
+	}
+
+	ng.logMu.Unlock()
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if _, err = ng.Execute(commands[0]); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	ng.Close()
+
+	ng = New(cfg)
+
+	if err = ng.Recover(); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	data, err = ng.Execute(Command{Index: indexName, Database: "name.idx", Command: "get", Key: []byte("neoway")})
+
+	if err != nil || !reflect.DeepEqual(data, utils.Uint64ToBytes(1)) {
+		t.Errorf("Log not recovered: %v (%v)", data, err)
+	}
+
+	info, err = os.Stat(logPath)
+
+	if err != nil || info.Size() != 0 {
+		t.Errorf("Log should be empty after Recover: %v (%v)", info, err)
+	}
+
+cleanup:
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestExecuteAllFailedStore(t *testing.T) {
+	var (
+		indexName = "execute-all-failed"
+		indexDir  = DataDirTmp + "/" + indexName
+		logPath   = indexDir + "/commands.log"
+		storekv   store.KVStore
+		data      []byte
+		info      os.FileInfo
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+		LogPath: logPath,
+	})
+
+	commands := []Command{
+		{Index: indexName, Database: "document.db", Command: "set", Key: utils.Uint64ToBytes(1), Value: []byte("doc")},
+		{Index: indexName, Database: "name.idx", Command: "mergeset", Key: []byte("neoway"), Value: utils.Uint64ToBytes(1)},
+	}
+
+	// the commit of name.idx fails: its store is closed under the engine
+	if storekv, err = ng.AcquireStore(indexName, "name.idx"); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	storekv.Close()
+
+	if _, err = ng.ExecuteAll(commands); err == nil {
+		t.Error("Commit of a closed store succeeded")
+	}
+
+	ng.CloseStore(indexName, "name.idx")
+	ng.ReleaseStore(storekv)
+
+	// the next execution writes the group not written before its own
+	if _, err = ng.ExecuteAll([]Command{
+		{Index: indexName, Database: "document.db", Command: "set", Key: utils.Uint64ToBytes(2), Value: []byte("doc2")},
+	}); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	data, err = ng.Execute(Command{Index: indexName, Database: "name.idx", Command: "get", Key: []byte("neoway")})
+
+	if err != nil || !reflect.DeepEqual(data, utils.Uint64ToBytes(1)) {
+		t.Errorf("Failed group lost: %v (%v)", data, err)
+	}
+
+	info, err = os.Stat(logPath)
+
+	if err != nil || info.Size() != 0 {
+		t.Errorf("Log should be empty after ExecuteAll: %v (%v)", info, err)
+	}
+
+cleanup:
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
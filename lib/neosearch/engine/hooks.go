@@ -0,0 +1,57 @@
+package engine
+
+// PreExecuteHook is called before a command is executed. An error
+// cancels the command and is returned as its error.
+type PreExecuteHook func(cmd Command) error
+
+// PostExecuteHook is called after a command is executed, with the value
+// returned and the error of the command.
+type PostExecuteHook func(cmd Command, value []byte, err error)
+
+// OnPreExecute registers a hook called before each command executed by
+// Execute or added to a Batch (and then by Session and ExecuteAll). The
+// hooks are called in the order registered and the first error cancels
+// the command.
+func (ng *Engine) OnPreExecute(hook PreExecuteHook) {
+	ng.hooksMu.Lock()
+	defer ng.hooksMu.Unlock()
+
+	ng.preHooks = append(ng.preHooks, hook)
+}
+
+// OnPostExecute registers a hook called after each command executed by
+// Execute, or by the commit of a Batch with the error of the store of
+// the command. The hooks are called in the order registered, outside of
+// the locks of the engine, then they can execute other commands.
+func (ng *Engine) OnPostExecute(hook PostExecuteHook) {
+	ng.hooksMu.Lock()
+	defer ng.hooksMu.Unlock()
+
+	ng.postHooks = append(ng.postHooks, hook)
+}
+
+// preExecute calls the pre-execute hooks and returns the first error.
+func (ng *Engine) preExecute(cmd Command) error {
+	ng.hooksMu.RLock()
+	hooks := ng.preHooks
+	ng.hooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// postExecute calls the post-execute hooks.
+func (ng *Engine) postExecute(cmd Command, value []byte, err error) {
+	ng.hooksMu.RLock()
+	hooks := ng.postHooks
+	ng.hooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(cmd, value, err)
+	}
+}
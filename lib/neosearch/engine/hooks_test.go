@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+)
+
+func TestEngineHooks(t *testing.T) {
+	var (
+		indexName = "engine-hooks"
+		indexDir  = DataDirTmp + "/" + indexName
+		pre, post []string
+		data      []byte
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+	})
+
+	defer func() {
+		ng.Close()
+		os.RemoveAll(indexDir)
+	}()
+
+	ng.OnPreExecute(func(cmd Command) error {
+		if string(cmd.Key) == "forbidden" {
+			return errors.New("Forbidden key")
+		}
+
+		pre = append(pre, cmd.Command+" "+string(cmd.Key))
+		return nil
+	})
+
+	ng.OnPostExecute(func(cmd Command, value []byte, err error) {
+		post = append(post, cmd.Command+" "+string(cmd.Key)+" "+string(value))
+	})
+
+	execSequence(t, ng, []Command{
+		{Index: indexName, Database: "name.idx", Command: "set", Key: []byte("a"), Value: []byte("1")},
+		{Index: indexName, Database: "name.idx", Command: "get", Key: []byte("a")},
+	})
+
+	// the pre-execute hooks cancel the command
+	if _, err = ng.Execute(Command{Index: indexName, Database: "name.idx", Command: "set", Key: []byte("forbidden"), Value: []byte("1")}); err == nil {
+		t.Error("Command not canceled by the hook")
+	}
+
+	data, err = ng.Execute(Command{Index: indexName, Database: "name.idx", Command: "count"})
+
+	if err != nil || len(data) != 8 || data[7] != 1 {
+		t.Errorf("Canceled command executed: %v (%v)", data, err)
+	}
+
+	batch := ng.NewBatch()
+
+	if err = batch.Execute(Command{Index: indexName, Database: "name.idx", Command: "delete", Key: []byte("a")}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = batch.Execute(Command{Index: indexName, Database: "name.idx", Command: "delete", Key: []byte("forbidden")}); err == nil {
+		t.Error("Batched command not canceled by the hook")
+	}
+
+	if err = batch.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	expectedPre := []string{"set a", "get a", "count ", "delete a"}
+	expectedPost := []string{"set a ", "get a 1", "count  " + string(data), "delete a "}
+
+	if !reflect.DeepEqual(pre, expectedPre) {
+		t.Errorf("Pre-execute hooks called with %q != %q", pre, expectedPre)
+	}
+
+	if !reflect.DeepEqual(post, expectedPost) {
+		t.Errorf("Post-execute hooks called with %q != %q", post, expectedPost)
+	}
+}
@@ -0,0 +1,312 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// commandLog is the coordinating log of ExecuteAll in all-or-nothing
+// mode. Every group of commands is appended to the log before executed
+// and the log is reset when the commands are in the stores. After a
+// crash, the groups committed to the log are executed again by Recover,
+// then each group is all-or-nothing across stores.
+//
+// The log is a sequence of records:
+//
+//	length (uint32) | crc32 of payload (uint32) | payload
+//
+// where payload is the number of commands followed by the commands (see
+// encodeCommand). A torn record at the end of the log is a group that
+// was never committed and is discarded.
+type commandLog struct {
+	file *os.File
+}
+
+// openLog opens (or creates) the log at `path`.
+func openLog(path string) (*commandLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &commandLog{file: file}, nil
+}
+
+// append writes the group of commands `commands` to the log, syncing the
+// file to disk if `sync` is true.
+func (w *commandLog) append(commands []Command, sync bool) error {
+	record := frameRecord(encodeCommands(nil, commands))
+
+	if _, err := w.file.Write(record); err != nil {
+		return err
+	}
+
+	if sync {
+		return w.file.Sync()
+	}
+
+	return nil
+}
+
+// sync commits the records appended to disk.
+func (w *commandLog) sync() error {
+	return w.file.Sync()
+}
+
+// reset discards every record of the log.
+func (w *commandLog) reset() error {
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+
+	_, err := w.file.Seek(0, os.SEEK_SET)
+	return err
+}
+
+// records returns the groups of commands committed to the log.
+func (w *commandLog) records() ([][]Command, error) {
+	if _, err := w.file.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+
+	groups, err := readRecords(bufio.NewReader(w.file))
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.file.Seek(0, os.SEEK_END)
+	return groups, err
+}
+
+// close closes the log file. Closing a closed log does nothing.
+func (w *commandLog) close() error {
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+
+	return err
+}
+
+// readRecords reads the records of the log from `r`, stopping at the
+// first torn or corrupted record.
+func readRecords(r io.Reader) ([][]Command, error) {
+	var groups [][]Command
+
+	for {
+		payload, err := readRecord(r)
+
+		if err == io.EOF || err == errTornRecord {
+			return groups, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		commands, err := decodeCommands(payload)
+
+		if err != nil {
+			return groups, nil
+		}
+
+		groups = append(groups, commands)
+	}
+}
+
+// frameRecord returns the record of `payload`, with its length and crc.
+func frameRecord(payload []byte) []byte {
+	record := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+
+	return append(record, payload...)
+}
+
+// readRecord reads the payload of the next record from `r`. It returns
+// io.EOF at the end of the records and errTornRecord if the record is
+// torn or corrupted. The size of the record is 8 bytes plus the payload.
+func readRecord(r io.Reader) ([]byte, error) {
+	header := make([]byte, 8)
+
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errTornRecord
+		}
+
+		return nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTornRecord
+		}
+
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errTornRecord
+	}
+
+	return payload, nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, v)
+	return append(buf, tmp[:n]...)
+}
+
+// appendBytes appends the length of `data` plus one (zero is nil) and
+// the data.
+func appendBytes(buf []byte, data []byte) []byte {
+	if data == nil {
+		return appendUvarint(buf, 0)
+	}
+
+	buf = appendUvarint(buf, uint64(len(data))+1)
+	return append(buf, data...)
+}
+
+// encodeCommands appends the number of commands and the commands
+// `commands` to `buf`.
+func encodeCommands(buf []byte, commands []Command) []byte {
+	buf = appendUvarint(buf, uint64(len(commands)))
+
+	for _, cmd := range commands {
+		buf = encodeCommand(buf, cmd)
+	}
+
+	return buf
+}
+
+// encodeCommand appends the fields of `cmd` to `buf`.
+func encodeCommand(buf []byte, cmd Command) []byte {
+	buf = appendBytes(buf, []byte(cmd.Index))
+	buf = appendBytes(buf, []byte(cmd.Database))
+	buf = appendBytes(buf, []byte(cmd.Command))
+	buf = appendBytes(buf, cmd.Key)
+	buf = append(buf, cmd.KeyType)
+	buf = appendBytes(buf, cmd.Value)
+	return append(buf, cmd.ValueType)
+}
+
+var (
+	errInvalidRecord = errors.New("Invalid log record")
+	errTornRecord    = errors.New("Torn log record")
+)
+
+// commandDecoder decodes the commands of a record payload.
+type commandDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *commandDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data)
+
+	if n <= 0 {
+		d.err = errInvalidRecord
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *commandDecoder) bytes() []byte {
+	size := d.uvarint()
+
+	if d.err != nil || size == 0 {
+		return nil
+	}
+
+	if uint64(len(d.data)) < size-1 {
+		d.err = errInvalidRecord
+		return nil
+	}
+
+	data := make([]byte, size-1)
+	copy(data, d.data)
+	d.data = d.data[size-1:]
+
+	return data
+}
+
+func (d *commandDecoder) byte() uint8 {
+	if d.err != nil {
+		return 0
+	}
+
+	if len(d.data) == 0 {
+		d.err = errInvalidRecord
+		return 0
+	}
+
+	b := d.data[0]
+	d.data = d.data[1:]
+
+	return b
+}
+
+// decodeCommands decodes the commands of the record payload `payload`.
+func decodeCommands(payload []byte) ([]Command, error) {
+	d := &commandDecoder{data: payload}
+	return d.commands()
+}
+
+// commands decodes the number of commands and the commands, until the
+// end of the payload.
+func (d *commandDecoder) commands() ([]Command, error) {
+	count := d.uvarint()
+
+	if d.err != nil || count > uint64(len(d.data)) {
+		return nil, errInvalidRecord
+	}
+
+	commands := make([]Command, 0, count)
+
+	for n := uint64(0); n < count; n++ {
+		cmd := d.command()
+
+		if d.err != nil {
+			return nil, d.err
+		}
+
+		commands = append(commands, cmd)
+	}
+
+	if len(d.data) != 0 {
+		return nil, errInvalidRecord
+	}
+
+	return commands, nil
+}
+
+// command decodes the fields of a command (see encodeCommand).
+func (d *commandDecoder) command() Command {
+	return Command{
+		Index:     string(d.bytes()),
+		Database:  string(d.bytes()),
+		Command:   string(d.bytes()),
+		Key:       d.bytes(),
+		KeyType:   d.byte(),
+		Value:     d.bytes(),
+		ValueType: d.byte(),
+	}
+}
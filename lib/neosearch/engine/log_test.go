@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+func TestLogRecords(t *testing.T) {
+	var buf bytes.Buffer
+
+	groups := [][]Command{
+		{
+			{
+				Index:     "test",
+				Database:  "document.db",
+				Command:   "set",
+				Key:       utils.Uint64ToBytes(1),
+				KeyType:   TypeUint,
+				Value:     []byte(`{"name": "neoway"}`),
+				ValueType: TypeString,
+			},
+			{
+				Index:     "test",
+				Database:  "name_string.idx",
+				Command:   "mergeset",
+				Key:       []byte("neoway"),
+				KeyType:   TypeString,
+				Value:     utils.Uint64ToBytes(1),
+				ValueType: TypeUint,
+			},
+		},
+		{
+			{
+				Index:    "test",
+				Database: "document.db",
+				Command:  "batch",
+				Key:      nil,
+				KeyType:  TypeNil,
+			},
+			{
+				Index:    "test",
+				Database: "name_string.idx",
+				Command:  "delete",
+				Key:      []byte{},
+				KeyType:  TypeString,
+			},
+		},
+	}
+
+	file, err := os.Create(DataDirTmp + "/test-log.log")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	w := &commandLog{file: file}
+
+	defer func() {
+		w.close()
+		os.Remove(DataDirTmp + "/test-log.log")
+	}()
+
+	for _, commands := range groups {
+		if err = w.append(commands, true); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	records, err := w.records()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(records, groups) {
+		t.Errorf("Log records %+v != %+v", records, groups)
+	}
+
+	// torn and corrupted records are discarded
+	if _, err = file.Seek(0, os.SEEK_SET); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = buf.ReadFrom(file); err != nil {
+		t.Error(err)
+		return
+	}
+
+	data := buf.Bytes()
+
+	for _, table := range []struct {
+		data     []byte
+		expected int
+	}{
+		{data[:len(data)-1], 1},
+		{data[:10], 0},
+		{append(append([]byte{}, data...), 0, 0, 0), 2},
+		{append(append([]byte{}, data[:len(data)-1]...), data[len(data)-1]^0xff), 1},
+	} {
+		records, err = readRecords(bytes.NewReader(table.data))
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if len(records) != table.expected {
+			t.Errorf("Read %d records != %d", len(records), table.expected)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+	"golang.org/x/net/context"
+)
+
+// KeyValue is a key/value pair returned by Query.
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// Query executes the commands that return many key/value pairs (see
+// Command.IsQuery) and returns the pairs in key order:
+//   - scan: the keys from cmd.Key (inclusive) to cmd.Value (exclusive)
+//   - prefix: the keys starting with cmd.Key
+//   - first, last: the first or the last key of the store
+//
+// The scan and prefix commands return at most cmd.Limit pairs, if not
+// zero. An empty store returns no pairs.
+func (ng *Engine) Query(cmd Command) ([]KeyValue, error) {
+	return ng.QueryContext(context.Background(), cmd)
+}
+
+// QueryContext is like Query, but stops iterating the store when `ctx` is
+// done and returns the error of `ctx`.
+func (ng *Engine) QueryContext(ctx context.Context, cmd Command) ([]KeyValue, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if !cmd.IsQuery() {
+		return nil, fmt.Errorf("Command %s isn't a query", cmd.Command)
+	}
+
+	if ng.config.KVCfg.Debug {
+		cmd.Println()
+	}
+
+	storekv, err := ng.AcquireStore(cmd.Index, cmd.Database)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer ng.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	var (
+		pairs []KeyValue
+		until func(key []byte) bool
+	)
+
+	switch cmd.Command {
+	case "scan":
+		it.Seek(cmd.Key)
+
+		until = func(key []byte) bool {
+			return bytes.Compare(key, cmd.Value) >= 0
+		}
+	case "prefix":
+		it.Seek(cmd.Key)
+
+		until = func(key []byte) bool {
+			return !bytes.HasPrefix(key, cmd.Key)
+		}
+	case "first", "last":
+		if cmd.Command == "first" {
+			it.SeekToFirst()
+		} else {
+			it.SeekToLast()
+		}
+
+		if it.Valid() {
+			pairs = append(pairs, KeyValue{Key: it.Key(), Value: it.Value()})
+		}
+
+		return pairs, it.GetError()
+	}
+
+	for ; it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		key := it.Key()
+
+		// keys are sorted, then no more keys in the range
+		if until(key) {
+			break
+		}
+
+		pairs = append(pairs, KeyValue{Key: key, Value: it.Value()})
+
+		if cmd.Limit > 0 && uint64(len(pairs)) >= cmd.Limit {
+			break
+		}
+	}
+
+	return pairs, it.GetError()
+}
+
+// count returns the number of keys of the store, or the error of `ctx`
+// if done while counting.
+func count(ctx context.Context, storekv store.KVStore) (uint64, error) {
+	var n uint64
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		n++
+	}
+
+	return n, it.GetError()
+}
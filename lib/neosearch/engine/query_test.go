@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"os"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"golang.org/x/net/context"
+)
+
+func TestEngineQuery(t *testing.T) {
+	var (
+		indexName = "engine-query"
+		indexDir  = DataDirTmp + "/" + indexName
+		pairs     []KeyValue
+		data      []byte
+		ctx       context.Context
+		cancel    context.CancelFunc
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+	})
+
+	for _, key := range []string{"neo", "neoway", "neosearch", "google", "apple"} {
+		_, err = ng.Execute(Command{
+			Index:    indexName,
+			Database: "name.idx",
+			Command:  "set",
+			Key:      []byte(key),
+			Value:    []byte(key + " value"),
+		})
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	for _, table := range []struct {
+		cmd      Command
+		expected []string
+	}{
+		{Command{Command: "scan", Key: []byte("b"), Value: []byte("neosearch")}, []string{"google", "neo"}},
+		{Command{Command: "scan", Key: []byte(""), Value: []byte("z"), Limit: 2}, []string{"apple", "google"}},
+		{Command{Command: "scan", Key: []byte("z"), Value: []byte("zz")}, []string{}},
+		{Command{Command: "prefix", Key: []byte("neo")}, []string{"neo", "neosearch", "neoway"}},
+		{Command{Command: "prefix", Key: []byte("neo"), Limit: 1}, []string{"neo"}},
+		{Command{Command: "first"}, []string{"apple"}},
+		{Command{Command: "last"}, []string{"neoway"}},
+	} {
+		table.cmd.Index = indexName
+		table.cmd.Database = "name.idx"
+
+		pairs, err = ng.Query(table.cmd)
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if len(pairs) != len(table.expected) {
+			t.Errorf("%s returned %d pairs, expected %v", table.cmd.Command, len(pairs), table.expected)
+			continue
+		}
+
+		for n, pair := range pairs {
+			if string(pair.Key) != table.expected[n] || string(pair.Value) != table.expected[n]+" value" {
+				t.Errorf("%s returned %q=%q, expected %s", table.cmd.Command, pair.Key, pair.Value, table.expected[n])
+			}
+		}
+	}
+
+	data, err = ng.Execute(Command{Index: indexName, Database: "name.idx", Command: "count"})
+
+	if err != nil || utils.BytesToUint64(data) != 5 {
+		t.Errorf("Count returned %v (%v)", data, err)
+	}
+
+	if _, err = ng.Execute(Command{Index: indexName, Database: "name.idx", Command: "scan"}); err == nil {
+		t.Error("Scan executed by Execute")
+	}
+
+	if _, err = ng.Query(Command{Index: indexName, Database: "name.idx", Command: "get"}); err == nil {
+		t.Error("Get executed by Query")
+	}
+
+	// an empty store
+	pairs, err = ng.Query(Command{Index: indexName, Database: "empty.idx", Command: "last"})
+
+	if err != nil || len(pairs) != 0 {
+		t.Errorf("Last of an empty store returned %v (%v)", pairs, err)
+	}
+
+	// canceled queries and commands return the error of the context
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	if pairs, err = ng.QueryContext(ctx, Command{Index: indexName, Database: "name.idx", Command: "prefix", Key: []byte("neo")}); err != context.Canceled {
+		t.Errorf("Canceled prefix returned %v (%v)", pairs, err)
+	}
+
+	if data, err = ng.ExecuteContext(ctx, Command{Index: indexName, Database: "name.idx", Command: "set", Key: []byte("ibm"), Value: []byte("1")}); err != context.Canceled {
+		t.Errorf("Canceled set returned %v (%v)", data, err)
+	}
+
+	if data, err = ng.ExecuteContext(context.Background(), Command{Index: indexName, Database: "name.idx", Command: "count"}); err != nil || utils.BytesToUint64(data) != 5 {
+		t.Errorf("Canceled set executed: count %v (%v)", data, err)
+	}
+
+cleanup:
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
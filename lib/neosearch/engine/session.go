@@ -0,0 +1,73 @@
+package engine
+
+// Session executes commands like Engine.Execute, but keeps the batches
+// started by the batch command, one per store, until the flushbatch
+// command of the store commits it. The writes of a store with a batch
+// pending are added to the batch. The batches of a session are
+// independent of the batches of other sessions, like the sessions of
+// neosearch-cli. A Session isn't safe for concurrent use.
+type Session struct {
+	engine  *Engine
+	batches map[string]*Batch
+}
+
+// NewSession returns a session of the engine.
+func (ng *Engine) NewSession() *Session {
+	return &Session{
+		engine:  ng,
+		batches: make(map[string]*Batch),
+	}
+}
+
+// Execute the given command
+func (s *Session) Execute(cmd Command) ([]byte, error) {
+	name := cmd.Index + "." + cmd.Database
+	batch, pending := s.batches[name]
+
+	switch cmd.Command {
+	case "batch":
+		// starts the batch again, like a new batch of the store
+		if pending {
+			batch.Discard()
+		}
+
+		s.batches[name] = s.engine.NewBatch()
+		return nil, nil
+	case "flushbatch":
+		if !pending {
+			return nil, nil
+		}
+
+		delete(s.batches, name)
+		return nil, batch.Commit()
+	case "set", "mergeset", "mergedel", "delete":
+		if pending {
+			return nil, batch.Execute(cmd)
+		}
+	}
+
+	return s.engine.Execute(cmd)
+}
+
+// Close commits the batches pending and returns the first error.
+func (s *Session) Close() error {
+	var err error
+
+	for name, batch := range s.batches {
+		if e := batch.Commit(); e != nil && err == nil {
+			err = e
+		}
+
+		delete(s.batches, name)
+	}
+
+	return err
+}
+
+// Discard empties the batches pending without writing the commands.
+func (s *Session) Discard() {
+	for name, batch := range s.batches {
+		batch.Discard()
+		delete(s.batches, name)
+	}
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"os"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+)
+
+func TestSessionBatch(t *testing.T) {
+	var (
+		indexName = "session-batch"
+		indexDir  = DataDirTmp + "/" + indexName
+		data      []byte
+		err       error
+	)
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := New(NGConfig{
+		KVCfg: &store.KVConfig{
+			DataDir: DataDirTmp,
+		},
+	})
+
+	session, other := ng.NewSession(), ng.NewSession()
+
+	get := func(key string) []byte {
+		data, err := ng.Execute(Command{Index: indexName, Database: "test.db", Command: "get", Key: []byte(key)})
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		return data
+	}
+
+	if _, err = ng.Execute(Command{Index: indexName, Database: "test.db", Command: "batch"}); err == nil {
+		t.Error("Engine executed a batch command")
+	}
+
+	for _, cmd := range []Command{
+		{Command: "batch"},
+		{Command: "set", Key: []byte("a"), Value: []byte("1")},
+	} {
+		cmd.Index, cmd.Database = indexName, "test.db"
+
+		if _, err = session.Execute(cmd); err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	// the other session isn't batching
+	_, err = other.Execute(Command{Index: indexName, Database: "test.db", Command: "set", Key: []byte("b"), Value: []byte("2")})
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if data = get("a"); data != nil {
+		t.Errorf("Batched write visible before flushbatch: %s", string(data))
+	}
+
+	if data = get("b"); string(data) != "2" {
+		t.Errorf("Write of other session batched: %s", string(data))
+	}
+
+	if _, err = session.Execute(Command{Index: indexName, Database: "test.db", Command: "flushbatch"}); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if data = get("a"); string(data) != "1" {
+		t.Errorf("Batch not flushed: %s", string(data))
+	}
+
+	// pending batches are committed on close
+	session.Execute(Command{Index: indexName, Database: "test.db", Command: "batch"})
+	session.Execute(Command{Index: indexName, Database: "test.db", Command: "delete", Key: []byte("a")})
+
+	if err = session.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if data = get("a"); data != nil {
+		t.Errorf("Pending batch not committed on close: %s", string(data))
+	}
+
+	// or dropped by discard
+	session.Execute(Command{Index: indexName, Database: "test.db", Command: "batch"})
+	session.Execute(Command{Index: indexName, Database: "test.db", Command: "delete", Key: []byte("b")})
+	session.Discard()
+
+	if data = get("b"); string(data) != "2" {
+		t.Errorf("Discarded batch committed: %s", string(data))
+	}
+
+	if err = session.Close(); err != nil {
+		t.Error(err)
+	}
+
+cleanup:
+	ng.Close()
+	os.RemoveAll(indexDir)
+}
@@ -76,12 +76,21 @@
 //
 //   - Create/Delete index
 //   - Index JSON documents (No schema)
-//   - Bulk writes
+//   - Bulk writes (parallel analysis with AddBulk)
+//   - Dump and restore (Dump and Restore of index.Index)
 //   - Analysers
 //     - Tokenizer
+//     - N-gram and edge n-gram token filters
 //   - Search
 //     - MatchPrefix
+//     - MatchWildcard
+//     - MatchRegex
+//     - Contains (n-gram indexed fields)
 //     - FilterTerm
+//     - FilterKeyword (exact match of keyword fields)
+//     - GeoDistance and GeoBoundingBox (geo_point fields)
+//     - Exists (documents with or missing a field)
+//     - ElemMatch (conditions on the same array element)
 //
 // This project is in active development stage, it is not recommended for
 // production environments.
@@ -92,6 +101,7 @@ import (
 	"expvar"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch/cache"
 	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
@@ -107,9 +117,21 @@ const maxIndicesOpen = 50
 // NeoSearch is the core of the neosearch package.
 // This structure handles all of the user's interactions with the indices,
 // like CreateIndex, DeleteIndex, UpdateIndex and others.
+// NeoSearch is safe for concurrent use.
 type NeoSearch struct {
+	// serializes the open, create and delete of indices
+	mu      sync.Mutex
 	indices cache.Cache
 
+	// number of users of each acquired index
+	refs map[*index.Index]int
+
+	// indices removed from the cache, but still acquired
+	evicted map[string]*index.Index
+
+	// first error closing an index, returned by Close
+	closeErr error
+
 	config *Config
 	engine *engine.Engine
 }
@@ -136,14 +158,24 @@ func New(cfg *Config) *NeoSearch {
 	neo := &NeoSearch{
 		config:  cfg,
 		indices: cache.NewLRUCache(cfg.MaxIndicesOpen),
+		refs:    make(map[*index.Index]int),
+		evicted: make(map[string]*index.Index),
 	}
 
+	// the cache is only changed with neo.mu held
 	neo.indices.OnRemove(func(key string, value interface{}) {
 		v, ok := value.(*index.Index)
 
-		if ok {
-			v.Close()
+		if !ok {
+			return
+		}
+
+		if neo.refs[v] > 0 {
+			neo.evicted[key] = v
+			return
 		}
+
+		neo.closeIndex(v)
 	})
 
 	return neo
@@ -154,16 +186,27 @@ func (neo *NeoSearch) GetIndices() cache.Cache {
 	return neo.indices
 }
 
+func (neo *NeoSearch) indexConfig(name string) index.Config {
+	return index.Config{
+		DataDir:          neo.config.DataDir,
+		Debug:            neo.config.Debug,
+		CacheSize:        neo.config.KVCacheSize,
+		EnableCache:      neo.config.EnableCache,
+		MaxTermExpansion: neo.config.MaxTermExpansion,
+		MaxSuggestScan:   neo.config.MaxSuggestScan,
+		Storage:          neo.config.IndexTuning(name),
+		Changes:          neo.config.Changes,
+	}
+}
+
 // CreateIndex creates and setup a new index
 func (neo *NeoSearch) CreateIndex(name string) (*index.Index, error) {
+	neo.mu.Lock()
+	defer neo.mu.Unlock()
+
 	indx, err := index.New(
 		name,
-		index.Config{
-			DataDir:     neo.config.DataDir,
-			Debug:       neo.config.Debug,
-			CacheSize:   neo.config.KVCacheSize,
-			EnableCache: neo.config.EnableCache,
-		},
+		neo.indexConfig(name),
 		true,
 	)
 
@@ -176,8 +219,16 @@ func (neo *NeoSearch) CreateIndex(name string) (*index.Index, error) {
 	return indx, nil
 }
 
-// DeleteIndex does exactly what the name says.
+// DeleteIndex does exactly what the name says. Indices acquired with
+// AcquireIndex can't be deleted until released.
 func (neo *NeoSearch) DeleteIndex(name string) error {
+	neo.mu.Lock()
+	defer neo.mu.Unlock()
+
+	if neo.inUse(name) {
+		return fmt.Errorf("Index '%s' is in use.", name)
+	}
+
 	// closes the index on remove
 	neo.indices.Remove(name)
 	idxLen := neo.indices.Len()
@@ -192,7 +243,96 @@ func (neo *NeoSearch) DeleteIndex(name string) error {
 }
 
 // OpenIndex open a existing index for read/write operations.
+//
+// The index isn't acquired, then it can be closed when removed from the
+// cache of open indices. Use AcquireIndex when the index is used while
+// other indices are opened, like in concurrent requests.
 func (neo *NeoSearch) OpenIndex(name string) (*index.Index, error) {
+	neo.mu.Lock()
+	defer neo.mu.Unlock()
+
+	return neo.open(name)
+}
+
+// AcquireIndex opens the index `name` like OpenIndex, but the index isn't
+// closed until released with ReleaseIndex, even if removed from the cache
+// of open indices in the meantime.
+func (neo *NeoSearch) AcquireIndex(name string) (*index.Index, error) {
+	neo.mu.Lock()
+	defer neo.mu.Unlock()
+
+	indx, err := neo.open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	neo.refs[indx]++
+	return indx, nil
+}
+
+// ReleaseIndex releases an index acquired with AcquireIndex. The index is
+// closed if it was removed from the cache and this was the last user.
+func (neo *NeoSearch) ReleaseIndex(indx *index.Index) error {
+	neo.mu.Lock()
+	defer neo.mu.Unlock()
+
+	refs, ok := neo.refs[indx]
+
+	if !ok {
+		return errors.New("Index not acquired with AcquireIndex")
+	}
+
+	if refs > 1 {
+		neo.refs[indx] = refs - 1
+		return nil
+	}
+
+	delete(neo.refs, indx)
+
+	if evicted, ok := neo.evicted[indx.Name]; ok && evicted == indx {
+		delete(neo.evicted, indx.Name)
+		return neo.closeIndex(indx)
+	}
+
+	return nil
+}
+
+// inUse returns true if the index `name` is acquired. The caller must
+// hold neo.mu.
+func (neo *NeoSearch) inUse(name string) bool {
+	if _, ok := neo.evicted[name]; ok {
+		return true
+	}
+
+	if value, ok := neo.indices.Get(name); ok {
+		if indx, ok := value.(*index.Index); ok {
+			return neo.refs[indx] > 0
+		}
+	}
+
+	return false
+}
+
+// closeIndex closes `indx`. The caller must hold neo.mu. The first error
+// is also returned by Close.
+func (neo *NeoSearch) closeIndex(indx *index.Index) error {
+	err := indx.Close()
+
+	if err != nil {
+		err = fmt.Errorf("Failed to close index '%s': %s", indx.Name, err)
+
+		if neo.closeErr == nil {
+			neo.closeErr = err
+		}
+	}
+
+	return err
+}
+
+// open returns the index `name` from the cache, opening it if needed.
+// The caller must hold neo.mu.
+func (neo *NeoSearch) open(name string) (*index.Index, error) {
 	var (
 		ok         bool
 		cacheIndex interface{}
@@ -212,6 +352,14 @@ func (neo *NeoSearch) OpenIndex(name string) (*index.Index, error) {
 		return indx, nil
 	}
 
+	if indx, ok = neo.evicted[name]; ok {
+		// still in use, then it's cached again instead of reopened
+		delete(neo.evicted, name)
+		neo.indices.Add(name, indx)
+		cachedIndices.Set(int64(neo.indices.Len()))
+		return indx, nil
+	}
+
 	ok, err = neo.IndexExists(name)
 
 	if err == nil && !ok {
@@ -222,12 +370,7 @@ func (neo *NeoSearch) OpenIndex(name string) (*index.Index, error) {
 
 	indx, err = index.New(
 		name,
-		index.Config{
-			DataDir:     neo.config.DataDir,
-			Debug:       neo.config.Debug,
-			CacheSize:   neo.config.KVCacheSize,
-			EnableCache: neo.config.EnableCache,
-		},
+		neo.indexConfig(name),
 		false,
 	)
 
@@ -256,8 +399,18 @@ func (neo *NeoSearch) IndexExists(name string) (bool, error) {
 	return false, err
 }
 
-// Close all of the open indices
-func (neo *NeoSearch) Close() {
+// Close all of the open indices. The indices acquired are closed when
+// released. The first error closing the indices since the last Close is
+// returned.
+func (neo *NeoSearch) Close() error {
+	neo.mu.Lock()
+	defer neo.mu.Unlock()
+
 	neo.indices.Clean()
 	cachedIndices.Set(int64(neo.indices.Len()))
+
+	err := neo.closeErr
+	neo.closeErr = nil
+
+	return err
 }
@@ -0,0 +1,140 @@
+package index
+
+import (
+	"errors"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+)
+
+// Batch is a group of documents written in the index at once by Commit.
+// The documents are analysed when added, then many batches of the same
+// index can be filled in parallel and only the commits are serialized.
+// A Batch isn't safe for concurrent use.
+//
+//	batch := index.NewBatch()
+//
+//	for id, doc := range docs {
+//	    if err := batch.Add(id, doc, nil); err != nil {
+//	        batch.Discard()
+//	        return err
+//	    }
+//	}
+//
+//	return batch.Commit()
+type Batch struct {
+	index *Index
+
+	commands []engine.Command
+	docs     int
+
+	// external ids mapped by the batch
+	extIDs []string
+}
+
+// NewBatch returns an empty batch of the index.
+func (i *Index) NewBatch() *Batch {
+	return &Batch{
+		index: i,
+	}
+}
+
+// Add analyses the document `doc` and adds its commands to the batch.
+func (b *Batch) Add(id uint64, doc []byte, metadata map[string]interface{}) error {
+	if metadata == nil {
+		metadata = Metadata{}
+	}
+
+	commands, err := b.index.BuildAdd(id, doc, metadata)
+
+	if err != nil {
+		return err
+	}
+
+	// the sequence skips the id before the commit
+	b.index.useID(id)
+
+	b.commands = append(b.commands, commands...)
+	b.docs++
+
+	return nil
+}
+
+// AddDocument adds the document `doc` to the batch using the id given by
+// its `_id` field and returns the id used. Unsigned integers are internal
+// ids, strings are external ids (see AddExternal) and documents without
+// `_id` get a new id from the sequence of the index.
+func (b *Batch) AddDocument(doc []byte, metadata map[string]interface{}) (uint64, error) {
+	value, err := idOf(doc)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if extID, ok := value.(string); ok {
+		return b.AddExternal(extID, doc, metadata)
+	}
+
+	id, err := b.index.documentID(value)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, b.Add(id, doc, metadata)
+}
+
+// AddExternal adds the document `doc` with the external id `extID` to the
+// batch and returns its internal id. An external id not mapped yet gets a
+// new id from the sequence, and the mapping is written with the document
+// by Commit.
+func (b *Batch) AddExternal(extID string, doc []byte, metadata map[string]interface{}) (uint64, error) {
+	if extID == "" {
+		return 0, errors.New("Empty document id")
+	}
+
+	id, mapping, err := b.index.mapID(extID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if mapping != nil {
+		b.extIDs = append(b.extIDs, extID)
+	}
+
+	if err = b.Add(id, doc, metadata); err != nil {
+		return 0, err
+	}
+
+	if mapping != nil {
+		b.commands = append(b.commands, *mapping)
+	}
+
+	return id, nil
+}
+
+// Len returns the number of documents in the batch.
+func (b *Batch) Len() int {
+	return b.docs
+}
+
+// Commit writes the documents of the batch in the index and empties the
+// batch. The write is all-or-nothing: the commands are appended to the
+// write-ahead log of the index before written.
+func (b *Batch) Commit() error {
+	defer b.Discard()
+
+	b.index.writeMutex.Lock()
+	defer b.index.writeMutex.Unlock()
+
+	return b.index.write(b.commands)
+}
+
+// Discard empties the batch without writing the documents.
+func (b *Batch) Discard() {
+	b.index.releaseIDs(b.extIDs)
+
+	b.commands = nil
+	b.docs = 0
+	b.extIDs = nil
+}
@@ -0,0 +1,143 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestBatchParallel(t *testing.T) {
+	var (
+		indexName = "test-batch-parallel"
+		indexDir  = DataDirTmp + "/" + indexName
+		writers   = 4
+		docs      = 25
+		wg        sync.WaitGroup
+		docIDs    []uint64
+		expected  []uint64
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// every writer fills and commits its own batches
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			batch := index.NewBatch()
+
+			for n := 0; n < docs; n++ {
+				id := uint64(w*docs + n + 1)
+				doc := fmt.Sprintf(`{"name": "neoway %d", "writer": %d}`, id, w)
+
+				if err := batch.Add(id, []byte(doc), nil); err != nil {
+					t.Error(err)
+					return
+				}
+
+				if batch.Len() == 10 {
+					if err := batch.Commit(); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+
+			if err := batch.Commit(); err != nil {
+				t.Error(err)
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	for id := uint64(1); id <= uint64(writers*docs); id++ {
+		expected = append(expected, id)
+	}
+
+	docIDs, _, err = index.FilterTermID([]byte("name"), []byte("neoway"), 0)
+
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(docIDs, expected) {
+		t.Errorf("Batches indexed %v != %v", docIDs, expected)
+	}
+
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestBatchDiscard(t *testing.T) {
+	var (
+		indexName = "test-batch-discard"
+		indexDir  = DataDirTmp + "/" + indexName
+		docIDs    []uint64
+		id, other uint64
+		found     bool
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	batch := index.NewBatch()
+
+	id, err = batch.AddDocument([]byte(`{"_id": 7, "name": "neoway"}`), nil)
+
+	if err != nil || id != 7 {
+		t.Errorf("Unexpected id %d (%v)", id, err)
+		goto cleanup
+	}
+
+	if err = batch.Add(8, []byte(`invalid`), nil); err == nil {
+		t.Error("Invalid document added to the batch")
+		goto cleanup
+	}
+
+	if batch.Len() != 1 {
+		t.Errorf("Batch with %d documents, expected 1", batch.Len())
+	}
+
+	// the external ids are mapped with the documents
+	if id, err = batch.AddDocument([]byte(`{"_id": "neoway-id", "name": "neoway"}`), nil); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if other, err = index.NewBatch().AddExternal("neoway-id", []byte(`{"name": "neoway inc"}`), nil); err != nil || other != id {
+		t.Errorf("Pending external id mapped to %d != %d (%v)", other, id, err)
+	}
+
+	batch.Discard()
+
+	if err = batch.Commit(); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if _, found, err = index.LookupID("neoway-id"); err != nil || found {
+		t.Errorf("External id of discarded document mapped: %v (%v)", found, err)
+	}
+
+	docIDs, _, err = index.FilterTermID([]byte("name"), []byte("neoway"), 0)
+
+	if err != nil || len(docIDs) != 0 {
+		t.Errorf("Discarded documents indexed: %v (%v)", docIDs, err)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
@@ -0,0 +1,91 @@
+package index
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+)
+
+// BulkDocument is a document to be indexed by AddBulk.
+type BulkDocument struct {
+	ID       uint64
+	Doc      []byte
+	Metadata Metadata
+}
+
+// analyzeBulk builds the commands of every document of `docs` using one
+// worker goroutine per CPU. The commands of docs[n] are in commands[n].
+func (i *Index) analyzeBulk(docs []BulkDocument, errs []error) [][]engine.Command {
+	var (
+		commands = make([][]engine.Command, len(docs))
+		workers  = runtime.NumCPU()
+		jobs     = make(chan int)
+		wg       sync.WaitGroup
+	)
+
+	if workers > len(docs) {
+		workers = len(docs)
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for n := range jobs {
+				metadata := docs[n].Metadata
+
+				if metadata == nil {
+					metadata = Metadata{}
+				}
+
+				commands[n], errs[n] = i.BuildAdd(docs[n].ID, docs[n].Doc, metadata)
+			}
+		}()
+	}
+
+	for n := range docs {
+		jobs <- n
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return commands
+}
+
+// AddBulk indexes the documents `docs`. The documents are analysed in
+// parallel and written at once, like a Batch, with one batch per store.
+// The error of docs[n] is returned in the position n of the result, nil
+// if the document was indexed.
+//
+// AddBulk is safe to call from many goroutines at once.
+func (i *Index) AddBulk(docs []BulkDocument) []error {
+	var (
+		errs  = make([]error, len(docs))
+		batch = i.NewBatch()
+	)
+
+	commands := i.analyzeBulk(docs, errs)
+
+	for n, docCommands := range commands {
+		if errs[n] != nil {
+			continue
+		}
+
+		i.useID(docs[n].ID)
+		batch.commands = append(batch.commands, docCommands...)
+	}
+
+	if err := batch.Commit(); err != nil {
+		for n := range errs {
+			if errs[n] == nil {
+				errs[n] = err
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,139 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestAddBulk(t *testing.T) {
+	var (
+		indexName = "test-add-bulk"
+		indexDir  = DataDirTmp + "/" + indexName
+		docs      []BulkDocument
+		errs      []error
+		docIDs    []uint64
+		expected  []uint64
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id := uint64(1); id <= 20; id++ {
+		docs = append(docs, BulkDocument{
+			ID:  id,
+			Doc: []byte(fmt.Sprintf(`{"name": "company %d", "type": "bulk"}`, id)),
+		})
+
+		expected = append(expected, id)
+	}
+
+	docs = append(docs,
+		BulkDocument{ID: 21, Doc: []byte(`{}`)},
+		BulkDocument{ID: 22, Doc: []byte(`invalid`)},
+	)
+
+	errs = index.AddBulk(docs)
+
+	if len(errs) != len(docs) {
+		t.Errorf("AddBulk returned %d errors for %d documents", len(errs), len(docs))
+		goto cleanup
+	}
+
+	for n, err := range errs {
+		if n < 20 && err != nil {
+			t.Errorf("Document %d failed: %s", n, err)
+		} else if n >= 20 && err == nil {
+			t.Errorf("Invalid document %s should fail", string(docs[n].Doc))
+		}
+	}
+
+	docIDs, _, err = index.FilterTermID([]byte("type"), []byte("bulk"), 0)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(docIDs, expected) {
+		t.Errorf("Bulk documents %v != %v", docIDs, expected)
+	}
+
+	docIDs, _, err = index.FilterTermID([]byte("name"), []byte("company 7"), 0)
+
+	if err != nil || !reflect.DeepEqual(docIDs, []uint64{7}) {
+		t.Errorf("Unexpected documents: %v (%v)", docIDs, err)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestAddBulkConcurrent(t *testing.T) {
+	var (
+		indexName = "test-add-bulk-concurrent"
+		indexDir  = DataDirTmp + "/" + indexName
+		wg        sync.WaitGroup
+		expected  []uint64
+		docIDs    []uint64
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id := uint64(1); id <= 100; id++ {
+		expected = append(expected, id)
+	}
+
+	// each goroutine adds the ids g, g+4, g+8, ...
+	for g := 1; g <= 4; g++ {
+		wg.Add(1)
+
+		go func(first uint64) {
+			defer wg.Done()
+
+			var docs []BulkDocument
+
+			for id := first; id <= 100; id += 4 {
+				docs = append(docs, BulkDocument{
+					ID:  id,
+					Doc: []byte(fmt.Sprintf(`{"id": %d, "tags": ["shared", "group%d"]}`, id, first)),
+				})
+			}
+
+			for n, err := range index.AddBulk(docs) {
+				if err != nil {
+					t.Errorf("Document %d failed: %s", docs[n].ID, err)
+				}
+			}
+		}(uint64(g))
+	}
+
+	wg.Wait()
+
+	docIDs, _, err = index.FilterTermID([]byte("tags"), []byte("shared"), 0)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(docIDs, expected) {
+		t.Errorf("Concurrent bulk documents %v != %v", docIDs, expected)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
@@ -0,0 +1,103 @@
+package index
+
+// levenshtein returns the edit distance between `a` and `b`. If the
+// distance is greater than `max`, any value greater than `max` could be
+// returned.
+func levenshtein(a, b []rune, max int) int {
+	if abs(len(a)-len(b)) > max {
+		return max + 1
+	}
+
+	row := make([]int, len(a)+1)
+
+	for j := range row {
+		row[j] = j
+	}
+
+	for i := 1; i <= len(b); i++ {
+		diag := row[0]
+		row[0] = i
+		rowMin := row[0]
+
+		for j := 1; j <= len(a); j++ {
+			up := row[j]
+			row[j] = editCost(row[j], row[j-1], diag, a[j-1] != b[i-1])
+			diag = up
+
+			if row[j] < rowMin {
+				rowMin = row[j]
+			}
+		}
+
+		if rowMin > max {
+			return max + 1
+		}
+	}
+
+	return row[len(a)]
+}
+
+// prefixDistance returns the smaller edit distance between `query` and
+// any prefix of `term`. If the distance is greater than `max`, any value
+// greater than `max` could be returned.
+func prefixDistance(query, term []rune, max int) int {
+	row := make([]int, len(query)+1)
+
+	for j := range row {
+		row[j] = j
+	}
+
+	best := row[len(query)]
+
+	for i := 1; i <= len(term) && best > 0; i++ {
+		diag := row[0]
+		row[0] = i
+		rowMin := row[0]
+
+		for j := 1; j <= len(query); j++ {
+			up := row[j]
+			row[j] = editCost(row[j], row[j-1], diag, query[j-1] != term[i-1])
+			diag = up
+
+			if row[j] < rowMin {
+				rowMin = row[j]
+			}
+		}
+
+		if row[len(query)] < best {
+			best = row[len(query)]
+		}
+
+		if rowMin > max {
+			break
+		}
+	}
+
+	return best
+}
+
+func editCost(up, left, diag int, differs bool) int {
+	cost := diag
+
+	if differs {
+		cost++
+	}
+
+	if up+1 < cost {
+		cost = up + 1
+	}
+
+	if left+1 < cost {
+		cost = left + 1
+	}
+
+	return cost
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
@@ -0,0 +1,52 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/extemporalgenome/slug"
+)
+
+// lookupField returns the values of the (possibly nested) field `field`
+// of the decoded document `doc`. The field name is normalized the same
+// way as in indexing, and arrays are flattened, then a field could have
+// more than one value.
+func lookupField(doc map[string]interface{}, field string) []interface{} {
+	var values = []interface{}{doc}
+
+	for _, part := range strings.Split(field, ".") {
+		var next []interface{}
+
+		for _, value := range flattenValues(values) {
+			obj, ok := value.(map[string]interface{})
+
+			if !ok {
+				continue
+			}
+
+			for key, fieldValue := range obj {
+				if slug.SlugAscii(key) == part {
+					next = append(next, fieldValue)
+				}
+			}
+		}
+
+		values = next
+	}
+
+	return flattenValues(values)
+}
+
+func flattenValues(values []interface{}) []interface{} {
+	var flat []interface{}
+
+	for _, value := range values {
+		if list, ok := value.([]interface{}); ok {
+			flat = append(flat, flattenValues(list)...)
+			continue
+		}
+
+		flat = append(flat, value)
+	}
+
+	return flat
+}
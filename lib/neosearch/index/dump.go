@@ -0,0 +1,357 @@
+package index
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+// Dump writes every entry of every database of the index in `w` as set
+// commands in the syntax of neosearch-cli (see engine.Command.ReverseErr),
+// one per line:
+//
+//	USING operating-systems.document.db SET uint(1) '{"id":1,"name":"Unix"}';
+//	USING operating-systems.name_string.idx SET 'unix' uint(1);
+//
+// Keys and values are written as uint, int, float or bool when the
+// database stores values of the type and as strings otherwise, but
+// always in a form read back unchanged, then Restore rebuilds the same
+// databases.
+func (i *Index) Dump(w io.Writer) error {
+	i.writeMutex.Lock()
+	defer i.writeMutex.Unlock()
+
+	databases, err := i.databaseNames()
+
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+
+	for _, database := range databases {
+		if err = i.dumpDatabase(bw, database); err != nil {
+			return fmt.Errorf("Failed to dump %s: %s", database, err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// databaseNames returns the names of every database in the index
+// directory.
+func (i *Index) databaseNames() ([]string, error) {
+	var names []string
+
+	entries, err := ioutil.ReadDir(i.fullDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+func (i *Index) dumpDatabase(w io.Writer, database string) error {
+	storekv, err := i.engine.AcquireStore(i.Name, database)
+
+	if err != nil {
+		return err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	keyType, valueType := dumpTypes(database)
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key, value := it.Key(), it.Value()
+
+		if key == nil {
+			key = []byte{}
+		}
+
+		if value == nil {
+			value = []byte{}
+		}
+
+		cmd := engine.Command{
+			Index:     i.Name,
+			Database:  database,
+			Command:   "set",
+			Key:       key,
+			KeyType:   dumpType(key, keyType),
+			Value:     value,
+			ValueType: dumpType(value, valueType),
+		}
+
+		line, err := cmd.ReverseErr()
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return it.GetError()
+}
+
+// dumpTypes returns the types of the keys and values stored in
+// `database`.
+func dumpTypes(database string) (uint8, uint8) {
+	switch {
+	case database == dbName:
+		return engine.TypeUint, engine.TypeString
+	case strings.HasSuffix(database, "_exists.idx"):
+		return engine.TypeUint, engine.TypeBool
+	case strings.HasSuffix(database, "_uint.idx"),
+		strings.HasSuffix(database, "_geo.idx"),
+		strings.HasSuffix(database, "_geodoc.idx"):
+		return engine.TypeUint, engine.TypeUint
+	case strings.HasSuffix(database, "_int.idx"):
+		return engine.TypeInt, engine.TypeUint
+	case strings.HasSuffix(database, "_float.idx"):
+		return engine.TypeFloat, engine.TypeUint
+	case strings.HasSuffix(database, "_bool.idx"):
+		return engine.TypeBool, engine.TypeUint
+	}
+
+	// string keys and the posting lists, the sequence or the ids of
+	// external ids as values.
+	return engine.TypeString, engine.TypeUint
+}
+
+// dumpType returns `kvType` if `data` is written as a literal of the type
+// without losses, or engine.TypeString for text and engine.TypeBinary
+// otherwise. Posting lists with more than one id, for example, are written
+// as binary literals.
+func dumpType(data []byte, kvType uint8) uint8 {
+	switch kvType {
+	case engine.TypeUint, engine.TypeInt:
+		if len(data) == 8 {
+			return kvType
+		}
+	case engine.TypeFloat:
+		if len(data) == 8 {
+			f := utils.BytesToFloat64(data)
+			parsed, err := strconv.ParseFloat(strconv.FormatFloat(f, 'f', -1, 64), 64)
+
+			// NaN payloads are lost
+			if err == nil && math.Float64bits(parsed) == math.Float64bits(f) {
+				return kvType
+			}
+		}
+	case engine.TypeBool:
+		if len(data) == 1 && data[0] <= 1 {
+			return kvType
+		}
+	}
+
+	if !isText(data) {
+		return engine.TypeBinary
+	}
+
+	return engine.TypeString
+}
+
+// isText returns true if `data` is printable UTF-8, with line breaks and
+// tabs.
+func isText(data []byte) bool {
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+
+		if r == utf8.RuneError || (!unicode.IsPrint(r) && r != '\n' && r != '\r' && r != '\t') {
+			return false
+		}
+
+		data = data[size:]
+	}
+
+	return true
+}
+
+// Restore writes the commands of a dump (see Dump) in the index. See
+// Restorer.
+func (i *Index) Restore(commands []engine.Command) error {
+	restorer := i.NewRestorer()
+
+	for _, cmd := range commands {
+		if err := restorer.Execute(cmd); err != nil {
+			restorer.Close()
+			return err
+		}
+	}
+
+	return restorer.Close()
+}
+
+// Restorer writes the commands of a dump in the index as they are read,
+// then the dump isn't kept in memory. The commands of each database are
+// written by one worker, in batches of engine.BatchSize commands, and up
+// to one worker per CPU runs in parallel. The index of the commands is
+// ignored, then a dump can be restored in an index with another name.
+//
+// Only set, mergeset, mergedel and delete commands are accepted. Batch
+// and flushbatch are skipped.
+type Restorer struct {
+	index   *Index
+	workers map[string]*restoreWorker
+
+	// databases being restored, by the order of the first command
+	databases  []string
+	maxWorkers int
+}
+
+type restoreWorker struct {
+	commands chan engine.Command
+	done     chan struct{}
+	err      error
+}
+
+// NewRestorer returns a Restorer of the index. The writes in the index
+// are blocked until the Restorer is closed.
+func (i *Index) NewRestorer() *Restorer {
+	i.writeMutex.Lock()
+
+	return &Restorer{
+		index:      i,
+		workers:    make(map[string]*restoreWorker),
+		maxWorkers: runtime.NumCPU(),
+	}
+}
+
+// Execute sends `cmd` to the worker of its database.
+func (r *Restorer) Execute(cmd engine.Command) error {
+	switch cmd.Command {
+	case "set", "mergeset", "mergedel", "delete":
+	case "batch", "flushbatch":
+		return nil
+	default:
+		return fmt.Errorf("Invalid restore command: %s", cmd.Command)
+	}
+
+	worker, ok := r.workers[cmd.Database]
+
+	if !ok {
+		// dumps are grouped by database, then the oldest worker is
+		// done with its database
+		if len(r.databases) == r.maxWorkers {
+			if err := r.stop(r.databases[0]); err != nil {
+				return err
+			}
+		}
+
+		worker = r.start(cmd.Database)
+	}
+
+	select {
+	case worker.commands <- cmd:
+		return nil
+	case <-worker.done:
+		return fmt.Errorf("Failed to restore %s: %s", cmd.Database, worker.err)
+	}
+}
+
+// Close waits the workers to write the commands received and unblocks
+// the writes in the index.
+func (r *Restorer) Close() error {
+	var err error
+
+	for len(r.databases) > 0 {
+		if stopErr := r.stop(r.databases[0]); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+
+	// the sequence may have been restored
+	r.index.seqMutex.Lock()
+	r.index.seqLoaded = false
+	r.index.seqMutex.Unlock()
+
+	r.index.writeMutex.Unlock()
+	return err
+}
+
+func (r *Restorer) start(database string) *restoreWorker {
+	worker := &restoreWorker{
+		commands: make(chan engine.Command, engine.BatchSize),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(worker.done)
+		worker.err = r.index.restoreDatabase(database, worker.commands)
+	}()
+
+	r.workers[database] = worker
+	r.databases = append(r.databases, database)
+
+	return worker
+}
+
+func (r *Restorer) stop(database string) error {
+	worker := r.workers[database]
+
+	close(worker.commands)
+	<-worker.done
+
+	delete(r.workers, database)
+
+	for n, name := range r.databases {
+		if name == database {
+			r.databases = append(r.databases[:n], r.databases[n+1:]...)
+			break
+		}
+	}
+
+	if worker.err != nil {
+		return fmt.Errorf("Failed to restore %s: %s", database, worker.err)
+	}
+
+	return nil
+}
+
+func (i *Index) restoreDatabase(database string, commands <-chan engine.Command) error {
+	// only the databases being restored are kept open
+	defer i.engine.CloseStore(i.Name, database)
+
+	batch := i.engine.NewBatch()
+
+	for cmd := range commands {
+		cmd.Index = i.Name
+
+		if err := batch.Execute(cmd); err != nil {
+			batch.Discard()
+			return err
+		}
+
+		if batch.Len() == engine.BatchSize {
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return batch.Commit()
+}
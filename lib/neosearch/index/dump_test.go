@@ -0,0 +1,159 @@
+package index
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+func TestDump(t *testing.T) {
+	var (
+		indexName = "test-dump"
+		indexDir  = DataDirTmp + "/" + indexName
+		buf       bytes.Buffer
+		dump      string
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "it's unix", "year": 1971}`,
+		`{"name": "unix", "year": 1992}`,
+	} {
+		if err = index.Add(uint64(id+1), []byte(doc), nil); err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	if err = index.Dump(&buf); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	dump = buf.String()
+
+	for _, line := range []string{
+		`USING test-dump.document.db SET uint(1) '{"name": "it\'s unix", "year": 1971}';`,
+		`USING test-dump.name_string.idx SET 'it\'s' uint(1);`,
+		`USING test-dump.year_float.idx SET float(1992) uint(2);`,
+		`USING test-dump.name_exists.idx SET uint(2) bool(true);`,
+		// postings with many ids are binary literals
+		`USING test-dump.name_string.idx SET 'unix' hex(00000000000000010000000000000002);`,
+	} {
+		if !strings.Contains(dump, line+"\n") {
+			t.Errorf("Line '%s' not found in dump:\n%s", line, dump)
+		}
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestRestore(t *testing.T) {
+	var (
+		indexName = "test-restore"
+		indexDir  = DataDirTmp + "/" + indexName
+		builder   *Index
+		restorer  *Restorer
+		commands  []engine.Command
+		docIDs    []uint64
+		doc       []byte
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the commands of other index are restored in the index
+	builder = &Index{
+		Name:   "other-index",
+		engine: index.engine,
+		config: index.config,
+	}
+
+	for id, docJSON := range []string{
+		`{"name": "plan9"}`,
+		`{"name": "plan9 from bell labs"}`,
+	} {
+		cmds, err := builder.BuildAdd(uint64(id+1), []byte(docJSON), nil)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		commands = append(commands, cmds...)
+	}
+
+	if err = index.Restore(commands); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if doc, err = index.Get(2); err != nil || string(doc) != `{"name": "plan9 from bell labs"}` {
+		t.Errorf("Unexpected document restored: %s (%v)", doc, err)
+	}
+
+	docIDs, _, err = index.FilterTermID([]byte("name"), []byte("plan9"), 0)
+
+	if err != nil || !reflect.DeepEqual(docIDs, []uint64{1, 2}) {
+		t.Errorf("Unexpected postings restored: %v (%v)", docIDs, err)
+	}
+
+	// the commands of the documents alternate the databases, then a
+	// single worker restarts for each database
+	restorer = index.NewRestorer()
+	restorer.maxWorkers = 1
+
+	for _, cmd := range commands {
+		cmd.Key = bytes.Replace(cmd.Key, []byte("plan9"), []byte("inferno"), -1)
+
+		if err = restorer.Execute(cmd); err != nil {
+			break
+		}
+	}
+
+	if closeErr := restorer.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	docIDs, _, err = index.FilterTermID([]byte("name"), []byte("inferno"), 0)
+
+	if err != nil || !reflect.DeepEqual(docIDs, []uint64{1, 2}) {
+		t.Errorf("Unexpected postings restored: %v (%v)", docIDs, err)
+	}
+
+	if err = index.Restore([]engine.Command{{
+		Index:    indexName,
+		Database: dbName,
+		Command:  "get",
+		Key:      utils.Uint64ToBytes(1),
+		KeyType:  engine.TypeUint,
+	}}); err == nil {
+		t.Error("Restore should fail for get commands")
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
@@ -0,0 +1,206 @@
+package index
+
+import (
+	"sort"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"github.com/extemporalgenome/slug"
+	"golang.org/x/net/context"
+)
+
+// existsStorage returns the name of the presence store of `field`. The
+// store have the ids of documents with the field as keys and a boolean
+// value, false when the field is null.
+func existsStorage(field string) string {
+	return field + "_exists.idx"
+}
+
+// hasValue returns true if `value` isn't null. Arrays have value if any
+// of their elements have.
+func hasValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, elem := range v {
+			if hasValue(elem) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// collectFields records in `fields` the fields (and sub-fields) of
+// `structData` and if they have a non-null value.
+func collectFields(baseField string, structData map[string]interface{}, fields map[string]bool) {
+	for key, value := range structData {
+		fieldKey := slug.SlugAscii(key)
+
+		if baseField != "" {
+			fieldKey = baseField + "." + fieldKey
+		}
+
+		fields[fieldKey] = fields[fieldKey] || hasValue(value)
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			collectFields(fieldKey, v, fields)
+		case []interface{}:
+			for _, elem := range v {
+				if obj, ok := elem.(map[string]interface{}); ok {
+					collectFields(fieldKey, obj, fields)
+				}
+			}
+		}
+	}
+}
+
+// buildIndexPresence builds the commands to record the fields present in
+// the document, in the order of the field names.
+func (i *Index) buildIndexPresence(id uint64, structData map[string]interface{}) []engine.Command {
+	var (
+		commands []engine.Command
+		fields   = make(map[string]bool)
+		names    []string
+	)
+
+	collectFields("", structData, fields)
+
+	for field := range fields {
+		names = append(names, field)
+	}
+
+	sort.Strings(names)
+
+	for _, field := range names {
+		storageName := existsStorage(field)
+
+		commands = append(commands, engine.Command{
+			Index:     i.Name,
+			Database:  storageName,
+			Command:   "set",
+			Key:       utils.Uint64ToBytes(id),
+			KeyType:   engine.TypeUint,
+			Value:     utils.BoolToBytes(fields[field]),
+			ValueType: engine.TypeBool,
+		})
+	}
+
+	return commands
+}
+
+// docIDs returns the ids of every document of the index. It stops when
+// `ctx` is done and returns the error of `ctx`.
+func (i *Index) docIDs(ctx context.Context) ([]uint64, error) {
+	var docIDs []uint64
+
+	storekv, err := i.engine.AcquireStore(i.Name, dbName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		docIDs = append(docIDs, utils.BytesToUint64(it.Key()))
+	}
+
+	return docIDs, it.GetError()
+}
+
+// ExistsID returns the ids of documents having a non-null value in field
+// `field` if `exists` is true, or the ids of documents where `field` is
+// missing or null otherwise.
+func (i *Index) ExistsID(field []byte, exists bool) ([]uint64, error) {
+	return i.ExistsIDContext(context.Background(), field, exists)
+}
+
+// ExistsIDContext is like ExistsID, but stops walking the documents when
+// `ctx` is done and returns the error of `ctx`.
+func (i *Index) ExistsIDContext(ctx context.Context, field []byte, exists bool) ([]uint64, error) {
+	var present []uint64
+
+	storekv, err := i.engine.AcquireStore(i.Name, existsStorage(utils.FieldNorm(string(field))))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if utils.BytesToBool(it.Value()) {
+			present = append(present, utils.BytesToUint64(it.Key()))
+		}
+	}
+
+	if err := it.GetError(); err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return present, nil
+	}
+
+	all, err := i.docIDs(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []uint64
+
+	for _, docID := range all {
+		for len(present) > 0 && present[0] < docID {
+			present = present[1:]
+		}
+
+		if len(present) > 0 && present[0] == docID {
+			continue
+		}
+
+		missing = append(missing, docID)
+	}
+
+	return missing, nil
+}
+
+// Exists search documents having a non-null value in field `field` (if
+// `exists` is true) or documents where the field is missing or null.
+func (i *Index) Exists(field []byte, exists bool) ([]string, error) {
+	return i.ExistsContext(context.Background(), field, exists)
+}
+
+// ExistsContext is like Exists, but stops when `ctx` is done and returns
+// the error of `ctx`.
+func (i *Index) ExistsContext(ctx context.Context, field []byte, exists bool) ([]string, error) {
+	docIDs, err := i.ExistsIDContext(ctx, field, exists)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.getDocsContext(ctx, docIDs)
+}
@@ -0,0 +1,73 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestExists(t *testing.T) {
+	var (
+		indexName = "test-exists"
+		indexDir  = DataDirTmp + "/" + indexName
+		docIDs    []uint64
+		metadata  = Metadata{
+			"email": Metadata{"type": "string"},
+		}
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "Neoway", "email": "contact@neoway.com.br", "address": {"city": "Florianópolis"}}`,
+		`{"name": "Google", "email": null, "address": {"city": null}}`,
+		`{"name": "Facebook", "phones": [null]}`,
+		`{"name": null, "phones": ["555-1234", null], "address": {}}`,
+		`{"contacts": [{"email": "a@b.com"}, {"phone": "555-1234"}]}`,
+	} {
+		err = index.Add(uint64(id+1), []byte(doc), metadata)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	for _, table := range []struct {
+		field    string
+		exists   bool
+		expected []uint64
+	}{
+		{"name", true, []uint64{1, 2, 3}},
+		{"name", false, []uint64{4, 5}},
+		{"email", true, []uint64{1}},
+		{"email", false, []uint64{2, 3, 4, 5}},
+		{"address", true, []uint64{1, 2, 4}},
+		{"address.city", true, []uint64{1}},
+		{"address.city", false, []uint64{2, 3, 4, 5}},
+		{"phones", true, []uint64{4}},
+		{"contacts.email", true, []uint64{5}},
+		{"nonexistent", true, nil},
+		{"nonexistent", false, []uint64{1, 2, 3, 4, 5}},
+	} {
+		docIDs, err = index.ExistsID([]byte(table.field), table.exists)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if !reflect.DeepEqual(docIDs, table.expected) {
+			t.Errorf("Exists(%s, %v) returned %v != %v", table.field, table.exists, docIDs, table.expected)
+		}
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
@@ -2,12 +2,20 @@ package index
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
 	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"golang.org/x/net/context"
 )
 
 func (i *Index) FilterTermID(field, value []byte, limit uint64) ([]uint64, uint64, error) {
+	return i.FilterTermIDContext(context.Background(), field, value, limit)
+}
+
+// FilterTermIDContext is like FilterTermID, but returns the error of `ctx`
+// if it's done.
+func (i *Index) FilterTermIDContext(ctx context.Context, field, value []byte, limit uint64) ([]uint64, uint64, error) {
 	cmd := engine.Command{}
 	cmd.Index = i.Name
 	// TODO: implement search for every type
@@ -15,7 +23,7 @@ func (i *Index) FilterTermID(field, value []byte, limit uint64) ([]uint64, uint6
 	cmd.Command = "get"
 	cmd.Key = value
 	cmd.KeyType = engine.TypeString
-	data, err := i.engine.Execute(cmd)
+	data, err := i.engine.ExecuteContext(ctx, cmd)
 
 	if err != nil {
 		return nil, 0, err
@@ -45,7 +53,13 @@ func (i *Index) FilterTermID(field, value []byte, limit uint64) ([]uint64, uint6
 // field `field` and returns upto `limit` documents. A limit of 0 (zero) is
 // the same as no limit (all of the records will return)..
 func (i *Index) FilterTerm(field []byte, value []byte, limit uint64) ([]string, uint64, error) {
-	docIDs, total, err := i.FilterTermID(field, value, limit)
+	return i.FilterTermContext(context.Background(), field, value, limit)
+}
+
+// FilterTermContext is like FilterTerm, but stops reading the documents
+// when `ctx` is done and returns the error of `ctx`.
+func (i *Index) FilterTermContext(ctx context.Context, field []byte, value []byte, limit uint64) ([]string, uint64, error) {
+	docIDs, total, err := i.FilterTermIDContext(ctx, field, value, limit)
 
 	if err != nil {
 		return nil, 0, err
@@ -54,7 +68,7 @@ func (i *Index) FilterTerm(field []byte, value []byte, limit uint64) ([]string,
 	docs := make([]string, len(docIDs))
 
 	for idx, docID := range docIDs {
-		if byteDoc, err := i.Get(docID); err == nil {
+		if byteDoc, err := i.GetContext(ctx, docID); err == nil {
 			docs[idx] = string(byteDoc)
 		} else {
 			return nil, 0, err
@@ -64,45 +78,77 @@ func (i *Index) FilterTerm(field []byte, value []byte, limit uint64) ([]string,
 	return docs, total, nil
 }
 
-func (i *Index) matchPrefix(field []byte, value []byte) ([]uint64, error) {
+func (i *Index) matchPrefix(ctx context.Context, field []byte, value []byte) ([]uint64, error) {
+	return i.matchTermsContext(ctx, stringStorage(field), value, nil, 0)
+}
+
+// stringStorage returns the name of the store with the string terms of
+// `field`.
+func stringStorage(field []byte) string {
+	// TODO: Implement search for all of field types
+	return utils.FieldNorm(string(field)) + "_string.idx"
+}
+
+// matchTerms walks the term dictionary of the store `storage` starting at
+// `prefix` and returns the union of the postings of every term accepted
+// by `match`. A nil `match` accepts every term with the given prefix. If
+// `maxTerms` is greater than zero, an error is returned when more than
+// `maxTerms` terms are accepted or more than `maxTerms` times
+// TermVisitFactor terms are visited.
+func (i *Index) matchTerms(storage string, prefix []byte, match func(term []byte) bool, maxTerms int) ([]uint64, error) {
+	return i.matchTermsContext(context.Background(), storage, prefix, match, maxTerms)
+}
+
+// matchTermsContext is like matchTerms, but stops walking the terms when
+// `ctx` is done and returns the error of `ctx`.
+func (i *Index) matchTermsContext(ctx context.Context, storage string, prefix []byte, match func(term []byte) bool, maxTerms int) ([]uint64, error) {
 	var (
-		docIDs []uint64
+		docIDs   []uint64
+		nterms   int
+		nvisited int
 	)
 
-	// TODO: Implement search for all of field types
-	storekv, err := i.engine.GetStore(i.Name, utils.FieldNorm(string(field))+"_string.idx")
+	storekv, err := i.engine.AcquireStore(i.Name, storage)
 
 	if err != nil {
 		return nil, err
 	}
 
+	defer i.engine.ReleaseStore(storekv)
+
 	it := storekv.GetIterator()
 
 	defer it.Close()
 
-	for it.Seek(value); it.Valid(); it.Next() {
-		if bytes.HasPrefix(it.Key(), value) {
-			var ids []uint64
-			dataBytes := it.Value()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		key := it.Key()
+
+		// keys are sorted, then no more terms with this prefix
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
 
-			if len(dataBytes) == 0 {
-				continue
-			}
+		nvisited++
 
-			for i := 0; i < len(dataBytes); i += 8 {
-				v := utils.BytesToUint64(dataBytes[i : i+8])
-				ids = append(ids, v)
-			}
+		if maxTerms > 0 && nvisited > maxTerms*TermVisitFactor {
+			return nil, fmt.Errorf("Query on '%s' visits more than %d terms", storage, maxTerms*TermVisitFactor)
+		}
 
-			if len(docIDs) == 0 {
-				docIDs = ids
-				continue
-			}
+		if match != nil && !match(key) {
+			continue
+		}
 
-			for _, id := range ids {
-				docIDs = utils.UniqueUint64Add(docIDs, id)
-			}
+		nterms++
+
+		if maxTerms > 0 && nterms > maxTerms {
+			return nil, fmt.Errorf("Query on '%s' expands to more than %d terms", storage, maxTerms)
 		}
+
+		docIDs = unionPostings(docIDs, it.Value())
 	}
 
 	if err := it.GetError(); err != nil {
@@ -112,18 +158,89 @@ func (i *Index) matchPrefix(field []byte, value []byte) ([]uint64, error) {
 	return docIDs, nil
 }
 
-// MatchPrefix search documents where field `field` starts with `value`.
-func (i *Index) MatchPrefix(field []byte, value []byte) ([]string, error) {
-	var docs []string
+// unionPostings merges the sorted posting list `data` (as stored by
+// mergeset) into the sorted slice of ids `docIDs`.
+func unionPostings(docIDs []uint64, data []byte) []uint64 {
+	var (
+		ids    = make([]uint64, 0, len(docIDs)+len(data)/8)
+		i, j   int
+		lenIDs = len(docIDs)
+	)
 
-	docIDs, err := i.matchPrefix(field, value)
+	for j+8 <= len(data) {
+		v := utils.BytesToUint64(data[j : j+8])
 
-	if err != nil {
+		if i < lenIDs && docIDs[i] < v {
+			ids = append(ids, docIDs[i])
+			i++
+			continue
+		}
+
+		if i < lenIDs && docIDs[i] == v {
+			i++
+		}
+
+		ids = append(ids, v)
+		j += 8
+	}
+
+	return append(ids, docIDs[i:]...)
+}
+
+// intersectPostings returns the ids present in both sorted slices.
+func intersectPostings(a, b []uint64) []uint64 {
+	var (
+		result []uint64
+		i, j   int
+	)
+
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			result = append(result, a[i])
+			i++
+			j++
+		} else if a[i] < b[j] {
+			i++
+		} else {
+			j++
+		}
+	}
+
+	return result
+}
+
+// getPostings returns the posting list stored in `key` of `storage`.
+func (i *Index) getPostings(storage string, key []byte) ([]uint64, error) {
+	return i.getPostingsContext(context.Background(), storage, key)
+}
+
+// getPostingsContext is like getPostings, but fails with the error of
+// `ctx` if it's done before reading the posting list.
+func (i *Index) getPostingsContext(ctx context.Context, storage string, key []byte) ([]uint64, error) {
+	data, err := i.engine.ExecuteContext(ctx, engine.Command{
+		Index:    i.Name,
+		Database: storage,
+		Command:  "get",
+		Key:      key,
+		KeyType:  engine.TypeString,
+	})
+
+	if err != nil || len(data) == 0 {
 		return nil, err
 	}
 
+	return unionPostings(nil, data), nil
+}
+
+func (i *Index) getDocs(docIDs []uint64) ([]string, error) {
+	return i.getDocsContext(context.Background(), docIDs)
+}
+
+func (i *Index) getDocsContext(ctx context.Context, docIDs []uint64) ([]string, error) {
+	var docs []string
+
 	for _, docID := range docIDs {
-		d, err := i.Get(docID)
+		d, err := i.GetContext(ctx, docID)
 
 		if err != nil {
 			return nil, err
@@ -134,3 +251,32 @@ func (i *Index) MatchPrefix(field []byte, value []byte) ([]string, error) {
 
 	return docs, nil
 }
+
+// MatchPrefixID returns the ids of documents where field `field` starts
+// with `value`.
+func (i *Index) MatchPrefixID(field []byte, value []byte) ([]uint64, error) {
+	return i.matchPrefix(context.Background(), field, value)
+}
+
+// MatchPrefixIDContext is like MatchPrefixID, but stops walking the terms
+// when `ctx` is done and returns the error of `ctx`.
+func (i *Index) MatchPrefixIDContext(ctx context.Context, field []byte, value []byte) ([]uint64, error) {
+	return i.matchPrefix(ctx, field, value)
+}
+
+// MatchPrefix search documents where field `field` starts with `value`.
+func (i *Index) MatchPrefix(field []byte, value []byte) ([]string, error) {
+	return i.MatchPrefixContext(context.Background(), field, value)
+}
+
+// MatchPrefixContext is like MatchPrefix, but stops when `ctx` is done
+// and returns the error of `ctx`.
+func (i *Index) MatchPrefixContext(ctx context.Context, field []byte, value []byte) ([]string, error) {
+	docIDs, err := i.matchPrefix(ctx, field, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.getDocsContext(ctx, docIDs)
+}
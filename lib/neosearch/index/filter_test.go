@@ -0,0 +1,222 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestFilterContext(t *testing.T) {
+	var (
+		indexName = "test-filter-context"
+		indexDir  = DataDirTmp + "/" + indexName
+		docIDs    []uint64
+		docs      []string
+		total     uint64
+		ctx       context.Context
+		cancel    context.CancelFunc
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "neoway"}`,
+		`{"name": "neosearch"}`,
+		`{"name": "google"}`,
+	} {
+		if err = index.Add(uint64(id+1), []byte(doc), nil); err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+
+	if docs, total, err = index.FilterTermContext(ctx, []byte("name"), []byte("google"), 0); err != nil || total != 1 || docs[0] != `{"name": "google"}` {
+		t.Errorf("Filter returned %v, %d (%v)", docs, total, err)
+	}
+
+	if docIDs, err = index.MatchPrefixIDContext(ctx, []byte("name"), []byte("neo")); err != nil || !reflect.DeepEqual(docIDs, []uint64{1, 2}) {
+		t.Errorf("Prefix returned %v (%v)", docIDs, err)
+	}
+
+	if docs, err = index.GetDocsContext(ctx, []uint64{1, 2, 3}, 2); err != nil || len(docs) != 2 {
+		t.Errorf("GetDocs returned %v (%v)", docs, err)
+	}
+
+	cancel()
+
+	if _, _, err = index.FilterTermContext(ctx, []byte("name"), []byte("google"), 0); err != context.Canceled {
+		t.Errorf("Canceled filter returned %v", err)
+	}
+
+	if _, err = index.MatchPrefixContext(ctx, []byte("name"), []byte("neo")); err != context.Canceled {
+		t.Errorf("Canceled prefix returned %v", err)
+	}
+
+	if _, err = index.MatchWildcardIDContext(ctx, []byte("name"), []byte("*o*")); err != context.Canceled {
+		t.Errorf("Canceled wildcard returned %v", err)
+	}
+
+	if _, err = index.GetDocsContext(ctx, []uint64{1, 2, 3}, 3); err != context.Canceled {
+		t.Errorf("Canceled GetDocs returned %v", err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	if _, err = index.MatchRegexIDContext(ctx, []byte("name"), []byte("neo.*")); err != context.DeadlineExceeded {
+		t.Errorf("Expired regex returned %v", err)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestFilterOperatorsContext(t *testing.T) {
+	var (
+		indexName = "test-filter-operators-context"
+		indexDir  = DataDirTmp + "/" + indexName
+		metadata  = Metadata{
+			"name":     Metadata{"type": "string", "filters": "ngram"},
+			"status":   Metadata{"type": "keyword"},
+			"location": Metadata{"type": "geo_point"},
+			"contacts": Metadata{
+				"type": "slice",
+				"metadata": Metadata{
+					"type": "object",
+					"metadata": Metadata{
+						"type":  Metadata{"type": "keyword"},
+						"value": Metadata{"type": "string"},
+					},
+				},
+			},
+		}
+		center      = GeoPoint{Lat: -27.5954, Lon: -48.5480}
+		topLeft     = GeoPoint{Lat: -27, Lon: -49}
+		bottomRight = GeoPoint{Lat: -28, Lon: -48}
+		conds       = []ElemCondition{
+			{Field: "contacts.type", Op: ElemKeyword, Value: []byte("email")},
+			{Field: "contacts.value", Op: ElemPrefix, Value: []byte("contact@")},
+		}
+		ctx    context.Context
+		cancel context.CancelFunc
+		id     uint64
+		doc    []byte
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if id, err = index.AddExternal("neoway", []byte(`{"name": "Neoway", "status": "active", "location": "-27.5954,-48.5480", "contacts": [{"type": "email", "value": "contact@neoway.com.br"}]}`), metadata); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+
+	for name, fn := range map[string]func() (int, error){
+		"contains": func() (int, error) {
+			docs, err := index.ContainsContext(ctx, []byte("name"), []byte("way"))
+			return len(docs), err
+		},
+		"keyword": func() (int, error) {
+			docs, err := index.FilterKeywordContext(ctx, []byte("status"), []byte("active"))
+			return len(docs), err
+		},
+		"geo distance": func() (int, error) {
+			docs, err := index.GeoDistanceContext(ctx, []byte("location"), center, 1000)
+			return len(docs), err
+		},
+		"geo bounding box": func() (int, error) {
+			docs, err := index.GeoBoundingBoxContext(ctx, []byte("location"), topLeft, bottomRight)
+			return len(docs), err
+		},
+		"exists": func() (int, error) {
+			docs, err := index.ExistsContext(ctx, []byte("status"), true)
+			return len(docs), err
+		},
+		"missing": func() (int, error) {
+			docIDs, err := index.ExistsIDContext(ctx, []byte("tags"), false)
+			return len(docIDs), err
+		},
+		"elem match": func() (int, error) {
+			docs, err := index.ElemMatchContext(ctx, conds)
+			return len(docs), err
+		},
+		"wildcard": func() (int, error) {
+			docs, err := index.MatchWildcardContext(ctx, []byte("name"), []byte("neo*"))
+			return len(docs), err
+		},
+		"regex": func() (int, error) {
+			docs, err := index.MatchRegexContext(ctx, []byte("name"), []byte("neo.*"))
+			return len(docs), err
+		},
+		"sort by keyword": func() (int, error) {
+			docIDs := []uint64{id}
+			return len(docIDs), index.SortByKeywordContext(ctx, []byte("status"), docIDs, false)
+		},
+		"sort by distance": func() (int, error) {
+			docIDs := []uint64{id}
+			return len(docIDs), index.SortByDistanceContext(ctx, []byte("location"), docIDs, center, false)
+		},
+		"distances": func() (int, error) {
+			distances, err := index.GeoDistancesContext(ctx, []byte("location"), []uint64{id}, center)
+			return len(distances), err
+		},
+		"terms aggregation": func() (int, error) {
+			buckets, err := index.TermsAggregationContext(ctx, []byte("status"), nil, 0)
+			return len(buckets), err
+		},
+		"lookup": func() (int, error) {
+			_, found, err := index.LookupIDContext(ctx, "neoway")
+
+			if !found {
+				return 0, err
+			}
+
+			return 1, err
+		},
+	} {
+		n, err := fn()
+
+		if err != nil || n != 1 {
+			t.Errorf("%s returned %d results (%v)", name, n, err)
+		}
+
+		cancel()
+
+		if _, err = fn(); err != context.Canceled {
+			t.Errorf("Canceled %s returned %v", name, err)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	if doc, err = index.GetContext(ctx, id); err != nil || len(doc) == 0 {
+		t.Errorf("Get returned %s (%v)", doc, err)
+	}
+
+	cancel()
+
+	if _, err = index.GetContext(ctx, id); err != context.Canceled {
+		t.Errorf("Canceled get returned %v", err)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
@@ -0,0 +1,588 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+// Kinds of problems found by Fsck
+const (
+	// FsckDanglingPosting is a posting pointing to a missing document
+	FsckDanglingPosting = "dangling posting"
+
+	// FsckMissingPosting is a document missing from a posting its
+	// fields should produce
+	FsckMissingPosting = "missing posting"
+
+	// FsckUnsortedPosting is a posting list unsorted or with duplicates
+	FsckUnsortedPosting = "unsorted posting"
+
+	// FsckCorruptStore is a store that can't be read
+	FsckCorruptStore = "corrupt store"
+
+	// FsckInvalidDocument is a stored document that can't be indexed
+	FsckInvalidDocument = "invalid document"
+
+	// FsckMissingConfig is a n-gram store without the configuration of
+	// its filter
+	FsckMissingConfig = "missing configuration"
+
+	// FsckChangedConfig is a n-gram store built with other configuration
+	// than the metadata of its field
+	FsckChangedConfig = "changed configuration"
+)
+
+// FsckProblem is an inconsistency found by Fsck.
+type FsckProblem struct {
+	Kind     string
+	Database string
+	Key      []byte
+	DocIDs   []uint64
+	Err      error
+}
+
+func (p FsckProblem) String() string {
+	msg := p.Kind + " in " + p.Database
+
+	if p.Key != nil {
+		msg += fmt.Sprintf(" key %q", p.Key)
+	}
+
+	if len(p.DocIDs) > 0 {
+		msg += fmt.Sprintf(" documents %v", p.DocIDs)
+	}
+
+	if p.Err != nil {
+		msg += ": " + p.Err.Error()
+	}
+
+	return msg
+}
+
+// FsckReport is the result of Fsck.
+type FsckReport struct {
+	Documents int
+	Databases int
+	Problems  []FsckProblem
+
+	// Repaired is true if the problems were repaired
+	Repaired bool
+}
+
+// fsckExpected are the entries the documents of the index should produce
+// in each store: the posting lists of mergeset commands and the values
+// of set commands, and the n-gram stores built with other configuration,
+// whose documents produce nothing.
+type fsckExpected struct {
+	postings map[string]map[string][]uint64
+	values   map[string]map[string][]byte
+	changed  map[string]bool
+}
+
+// isDocKeyedStorage returns true if the keys of `storage` start with the
+// id of the document (and the values aren't document ids).
+func isDocKeyedStorage(storage string) bool {
+	return strings.HasSuffix(storage, "_pos.idx") ||
+		strings.HasSuffix(storage, "_geodoc.idx") ||
+		strings.HasSuffix(storage, "_exists.idx")
+}
+
+// storeNames returns the names of the index stores in the index directory.
+func (i *Index) storeNames() ([]string, error) {
+	var names []string
+
+	entries, err := ioutil.ReadDir(i.fullDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), "."+indexExt) {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// fsckDocuments reads every document of the index and builds the entries
+// they should produce using `metadata`.
+func (i *Index) fsckDocuments(metadata Metadata, report *FsckReport) (map[uint64]bool, *fsckExpected, error) {
+	var (
+		docs     = make(map[uint64]bool)
+		expected = &fsckExpected{
+			postings: make(map[string]map[string][]uint64),
+			values:   make(map[string]map[string][]byte),
+			changed:  make(map[string]bool),
+		}
+	)
+
+	storekv, err := i.engine.AcquireStore(i.Name, dbName)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		id := utils.BytesToUint64(it.Key())
+		docs[id] = true
+
+		commands, err := i.BuildAdd(id, it.Value(), metadata)
+
+		if cfgErr, ok := err.(*gramConfigError); ok {
+			expected.changed[cfgErr.storage] = true
+			continue
+		} else if err != nil {
+			report.Problems = append(report.Problems, FsckProblem{
+				Kind:     FsckInvalidDocument,
+				Database: dbName,
+				DocIDs:   []uint64{id},
+				Err:      err,
+			})
+
+			continue
+		}
+
+		for _, cmd := range commands {
+			switch cmd.Command {
+			case "mergeset":
+				keys, ok := expected.postings[cmd.Database]
+
+				if !ok {
+					keys = make(map[string][]uint64)
+					expected.postings[cmd.Database] = keys
+				}
+
+				keys[string(cmd.Key)] = append(keys[string(cmd.Key)], utils.BytesToUint64(cmd.Value))
+			case "set":
+				if cmd.Database == dbName {
+					continue
+				}
+
+				values, ok := expected.values[cmd.Database]
+
+				if !ok {
+					values = make(map[string][]byte)
+					expected.values[cmd.Database] = values
+				}
+
+				values[string(cmd.Key)] = cmd.Value
+			}
+		}
+	}
+
+	if err := it.GetError(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, keys := range expected.postings {
+		for key, ids := range keys {
+			keys[key] = uniqueIDs(ids)
+		}
+	}
+
+	report.Documents = len(docs)
+	return docs, expected, nil
+}
+
+// fsckStore checks the store `storage` and returns the problems found and
+// the fixes of the keys with problems (nil values are deletes).
+func (i *Index) fsckStore(storage string, docs map[uint64]bool, expected *fsckExpected) ([]FsckProblem, map[string][]byte, error) {
+	var (
+		problems     []FsckProblem
+		fixes        = make(map[string][]byte)
+		seen         = make(map[string]bool)
+		postings     = expected.postings[storage]
+		values       = expected.values[storage]
+		docKeyed     = isDocKeyedStorage(storage)
+		isValueStore = strings.HasSuffix(storage, "_exists.idx")
+	)
+
+	problem := func(kind string, key []byte, docIDs []uint64) {
+		problems = append(problems, FsckProblem{
+			Kind:     kind,
+			Database: storage,
+			Key:      append([]byte{}, key...),
+			DocIDs:   docIDs,
+		})
+	}
+
+	storekv, err := i.engine.AcquireStore(i.Name, storage)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key, value := it.Key(), it.Value()
+		seen[string(key)] = true
+
+		if docKeyed {
+			if len(key) < 8 || !docs[utils.BytesToUint64(key[:8])] {
+				var docIDs []uint64
+
+				if len(key) >= 8 {
+					docIDs = []uint64{utils.BytesToUint64(key[:8])}
+				}
+
+				problem(FsckDanglingPosting, key, docIDs)
+				fixes[string(key)] = nil
+				continue
+			}
+		}
+
+		if isValueStore {
+			if expectedValue, ok := values[string(key)]; ok && !bytes.Equal(value, expectedValue) {
+				problem(FsckMissingPosting, key, []uint64{utils.BytesToUint64(key)})
+				fixes[string(key)] = expectedValue
+			}
+
+			continue
+		}
+
+		if len(value)%8 != 0 {
+			problems = append(problems, FsckProblem{
+				Kind:     FsckCorruptStore,
+				Database: storage,
+				Key:      append([]byte{}, key...),
+				Err:      fmt.Errorf("Invalid posting list length: %d", len(value)),
+			})
+
+			value = value[:len(value)-len(value)%8]
+		}
+
+		var (
+			stored   = make([]uint64, 0, len(value)/8)
+			unsorted bool
+			dangling []uint64
+			missing  []uint64
+		)
+
+		for j := 0; j+8 <= len(value); j += 8 {
+			id := utils.BytesToUint64(value[j : j+8])
+
+			if len(stored) > 0 && id <= stored[len(stored)-1] {
+				unsorted = true
+			}
+
+			if !docKeyed && !docs[id] {
+				dangling = append(dangling, id)
+				continue
+			}
+
+			stored = append(stored, id)
+		}
+
+		if unsorted {
+			problem(FsckUnsortedPosting, key, nil)
+		}
+
+		if len(dangling) > 0 {
+			problem(FsckDanglingPosting, key, dangling)
+		}
+
+		stored = uniqueIDs(stored)
+
+		for _, id := range postings[string(key)] {
+			if idx := sort.Search(len(stored), func(n int) bool { return stored[n] >= id }); idx == len(stored) || stored[idx] != id {
+				missing = append(missing, id)
+			}
+		}
+
+		if len(missing) > 0 {
+			problem(FsckMissingPosting, key, missing)
+		}
+
+		if unsorted || len(dangling) > 0 || len(missing) > 0 || len(value)%8 != 0 {
+			if ids := unionPostings(missing, encodePostings(stored)); len(ids) > 0 {
+				fixes[string(key)] = encodePostings(ids)
+			} else {
+				fixes[string(key)] = nil
+			}
+		}
+	}
+
+	if err := it.GetError(); err != nil {
+		return nil, nil, err
+	}
+
+	// documents missing from postings not stored at all
+	for _, key := range sortedKeys(postings, values) {
+		if seen[key] {
+			continue
+		}
+
+		if value, ok := values[key]; ok {
+			problem(FsckMissingPosting, []byte(key), []uint64{utils.BytesToUint64([]byte(key))})
+			fixes[key] = value
+		} else {
+			problem(FsckMissingPosting, []byte(key), postings[key])
+			fixes[key] = encodePostings(postings[key])
+		}
+	}
+
+	return problems, fixes, nil
+}
+
+// sortedKeys returns the keys of `postings` and `values` sorted.
+func sortedKeys(postings map[string][]uint64, values map[string][]byte) []string {
+	keys := make([]string, 0, len(postings)+len(values))
+
+	for key := range postings {
+		keys = append(keys, key)
+	}
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// fsckGramConfigs returns the problems of the configurations of the n-gram
+// stores in `names` and their fixes. The documents produce the
+// configurations only if missing or different of the stored ones (see
+// gramConfigChanged).
+func (i *Index) fsckGramConfigs(names []string, expected *fsckExpected) ([]FsckProblem, map[string][]byte) {
+	var (
+		problems []FsckProblem
+		fixes    = make(map[string][]byte)
+		configs  = expected.values[gramsDB]
+	)
+
+	for _, storage := range names {
+		if value, ok := configs[storage]; ok {
+			problems = append(problems, FsckProblem{
+				Kind:     FsckMissingConfig,
+				Database: gramsDB,
+				Key:      []byte(storage),
+			})
+
+			fixes[storage] = value
+		}
+	}
+
+	return problems, fixes
+}
+
+// writeFixes writes `fixes` in the store `storage`.
+func (i *Index) writeFixes(storage string, fixes map[string][]byte) error {
+	storekv, err := i.engine.AcquireStore(i.Name, storage)
+
+	if err != nil {
+		return err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	for key, value := range fixes {
+		if value == nil {
+			err = storekv.Delete([]byte(key))
+		} else {
+			err = storekv.Set([]byte(key), value)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuildGrams removes the n-gram stores built with other configuration
+// and their configurations, and reads the documents again, building the
+// stores with the configuration of `metadata`.
+func (i *Index) rebuildGrams(metadata Metadata, changed map[string]bool) (map[uint64]bool, *fsckExpected, error) {
+	var (
+		docs     map[uint64]bool
+		expected *fsckExpected
+		err      error
+		removed  = make(map[string][]byte)
+	)
+
+	// a rebuilt store could reveal other changed stores of the documents
+	for len(changed) > 0 {
+		for storage := range changed {
+			if err = i.engine.RemoveStore(i.Name, storage); err != nil {
+				return nil, nil, fmt.Errorf("Failed to rebuild %s: %s", storage, err)
+			}
+
+			removed[storage] = nil
+		}
+
+		if err = i.writeFixes(gramsDB, removed); err != nil {
+			return nil, nil, err
+		}
+
+		i.gramMutex.Lock()
+		i.gramConfigs = nil
+		i.gramMutex.Unlock()
+
+		if docs, expected, err = i.fsckDocuments(metadata, &FsckReport{}); err != nil {
+			return nil, nil, err
+		}
+
+		changed = expected.changed
+	}
+
+	fixes := make(map[string][]byte)
+
+	for storage := range removed {
+		if err = i.rebuildStore(storage, expected); err != nil {
+			return nil, nil, fmt.Errorf("Failed to rebuild %s: %s", storage, err)
+		}
+
+		if value, ok := expected.values[gramsDB][storage]; ok {
+			fixes[storage] = value
+			delete(expected.values[gramsDB], storage)
+		}
+	}
+
+	return docs, expected, i.writeFixes(gramsDB, fixes)
+}
+
+// rebuildStore recreates the store `storage` with the entries produced
+// by the documents.
+func (i *Index) rebuildStore(storage string, expected *fsckExpected) error {
+	fixes := make(map[string][]byte)
+
+	for key, ids := range expected.postings[storage] {
+		fixes[key] = encodePostings(ids)
+	}
+
+	for key, value := range expected.values[storage] {
+		fixes[key] = value
+	}
+
+	// the store isn't removed while in use by the searches or batches
+	if err := i.engine.RemoveStore(i.Name, storage); err != nil {
+		return err
+	}
+
+	return i.writeFixes(storage, fixes)
+}
+
+// Fsck checks the consistency of the index: walks document.db and every
+// index store reporting postings pointing to missing documents, documents
+// missing from the postings their fields should produce (building them
+// again with `metadata`), unsorted or duplicated posting lists and stores
+// that can't be read, and the configurations of the n-gram stores. Only
+// the stores present in the index are checked, then stores of fields
+// indexed with other metadata are not reported, except the n-gram stores
+// built with other configuration.
+//
+// If `repair` is true the problems are fixed: postings and configurations
+// are rewritten, and unreadable stores and n-gram stores with changed
+// configuration are rebuilt from the documents, unless in use. Writes are
+// blocked while checking.
+func (i *Index) Fsck(metadata Metadata, repair bool) (*FsckReport, error) {
+	report := &FsckReport{}
+
+	if metadata == nil {
+		metadata = Metadata{}
+	}
+
+	i.writeMutex.Lock()
+	defer i.writeMutex.Unlock()
+
+	// the configurations of the n-gram stores are read again
+	i.gramMutex.Lock()
+	i.gramConfigs = nil
+	i.gramMutex.Unlock()
+
+	docs, expected, err := i.fsckDocuments(metadata, report)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %s", dbName, err)
+	}
+
+	changed := make([]string, 0, len(expected.changed))
+
+	for storage := range expected.changed {
+		changed = append(changed, storage)
+	}
+
+	sort.Strings(changed)
+
+	for _, storage := range changed {
+		report.Problems = append(report.Problems, FsckProblem{
+			Kind:     FsckChangedConfig,
+			Database: gramsDB,
+			Key:      []byte(storage),
+		})
+	}
+
+	if repair && len(expected.changed) > 0 {
+		if docs, expected, err = i.rebuildGrams(metadata, expected.changed); err != nil {
+			return report, err
+		}
+	}
+
+	names, err := i.storeNames()
+
+	if err != nil {
+		return nil, err
+	}
+
+	report.Databases = len(names) + 1
+
+	for _, storage := range names {
+		problems, fixes, err := i.fsckStore(storage, docs, expected)
+
+		if err != nil {
+			report.Problems = append(report.Problems, FsckProblem{
+				Kind:     FsckCorruptStore,
+				Database: storage,
+				Err:      err,
+			})
+
+			if repair {
+				if err = i.rebuildStore(storage, expected); err != nil {
+					return report, fmt.Errorf("Failed to rebuild %s: %s", storage, err)
+				}
+			}
+
+			continue
+		}
+
+		report.Problems = append(report.Problems, problems...)
+
+		if repair && len(fixes) > 0 {
+			if err = i.writeFixes(storage, fixes); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	problems, fixes := i.fsckGramConfigs(names, expected)
+	report.Problems = append(report.Problems, problems...)
+
+	if repair && len(fixes) > 0 {
+		if err = i.writeFixes(gramsDB, fixes); err != nil {
+			return report, err
+		}
+	}
+
+	report.Repaired = repair && len(report.Problems) > 0
+	return report, nil
+}
@@ -0,0 +1,310 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+func TestFsck(t *testing.T) {
+	var (
+		indexName = "test-fsck"
+		indexDir  = DataDirTmp + "/" + indexName
+		report    *FsckReport
+		kinds     map[string]int
+		docIDs    []uint64
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "neoway", "tags": ["search", "go"]}`,
+		`{"name": "google", "tags": ["search"]}`,
+		`{"name": "facebook"}`,
+	} {
+		if err = index.Add(uint64(id+1), []byte(doc), nil); err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	report, err = index.Fsck(nil, false)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if report.Documents != 3 || len(report.Problems) != 0 {
+		t.Errorf("Consistent index reported: %+v", report)
+		goto cleanup
+	}
+
+	// breaks the index: posting to a missing document, document missing
+	// from a posting and an unsorted posting list with duplicates.
+	for _, fix := range []struct {
+		storage string
+		key     string
+		ids     []uint64
+	}{
+		{"name_string.idx", "neoway", []uint64{1, 9}},
+		{"tags_string.idx", "search", []uint64{1}},
+		{"tags_string.idx", "go", []uint64{1, 1}},
+		{"name_string.idx", "google", []uint64{}},
+	} {
+		err = index.writeFixes(fix.storage, map[string][]byte{fix.key: rawPostings(fix.ids)})
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	err = index.writeFixes("name_string.idx", map[string][]byte{"facebook": nil})
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	report, err = index.Fsck(nil, true)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	kinds = make(map[string]int)
+
+	for _, problem := range report.Problems {
+		kinds[problem.Kind]++
+	}
+
+	if !reflect.DeepEqual(kinds, map[string]int{
+		FsckDanglingPosting: 1,
+		FsckMissingPosting:  3,
+		FsckUnsortedPosting: 1,
+	}) {
+		t.Errorf("Unexpected problems: %v", report.Problems)
+	}
+
+	if !report.Repaired {
+		t.Error("Problems should be repaired")
+	}
+
+	for _, table := range []struct {
+		field, term string
+		expected    []uint64
+	}{
+		{"name", "neoway", []uint64{1}},
+		{"name", "google", []uint64{2}},
+		{"name", "facebook", []uint64{3}},
+		{"tags", "search", []uint64{1, 2}},
+		{"tags", "go", []uint64{1}},
+	} {
+		docIDs, _, err = index.FilterTermID([]byte(table.field), []byte(table.term), 0)
+
+		if err != nil || !reflect.DeepEqual(docIDs, table.expected) {
+			t.Errorf("Posting %s:%s after repair: %v (%v)", table.field, table.term, docIDs, err)
+		}
+	}
+
+	report, err = index.Fsck(nil, false)
+
+	if err != nil || len(report.Problems) != 0 {
+		t.Errorf("Repaired index reported: %v (%v)", report, err)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestFsckGrams(t *testing.T) {
+	var (
+		indexName = "test-fsck-grams"
+		indexDir  = DataDirTmp + "/" + indexName
+		report    *FsckReport
+		expected  *fsckExpected
+		storekv   store.KVStore
+		docIDs    []uint64
+		metadata  = Metadata{
+			"name": Metadata{
+				"type":    "string",
+				"filters": "ngram",
+			},
+			"city": Metadata{
+				"type":    "string",
+				"filters": "edge_ngram",
+				"side":    "back",
+			},
+		}
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "Neoway", "city": "Florianópolis"}`,
+		`{"name": "Broadway", "city": "New York City"}`,
+	} {
+		if err = index.Add(uint64(id+1), []byte(doc), metadata); err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	// the n-gram stores are consistent
+	report, err = index.Fsck(metadata, true)
+
+	if err != nil || len(report.Problems) != 0 || report.Repaired {
+		t.Errorf("Consistent index reported: %v (%v)", report, err)
+		goto cleanup
+	}
+
+	// the configuration of a n-gram store is lost
+	if err = index.writeFixes(gramsDB, map[string][]byte{ngramStorage("name"): nil}); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	report, err = index.Fsck(metadata, true)
+
+	if err != nil || len(report.Problems) != 1 || report.Problems[0].Kind != FsckMissingConfig ||
+		string(report.Problems[0].Key) != ngramStorage("name") {
+		t.Errorf("Unexpected problems: %v (%v)", report, err)
+	}
+
+	if docIDs, err = index.ContainsID([]byte("name"), []byte("way")); err != nil || !reflect.DeepEqual(docIDs, []uint64{1, 2}) {
+		t.Errorf("Contains after repair returned %v (%v)", docIDs, err)
+	}
+
+	// stores in use aren't rebuilt
+	if _, expected, err = index.fsckDocuments(metadata, &FsckReport{}); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if storekv, err = index.engine.AcquireStore(indexName, edgeNgramStorage("city")); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if err = index.rebuildStore(edgeNgramStorage("city"), expected); err == nil {
+		t.Error("Store in use rebuilt")
+	}
+
+	index.engine.ReleaseStore(storekv)
+
+	if err = index.rebuildStore(edgeNgramStorage("city"), expected); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if docIDs, err = index.ContainsID([]byte("city"), []byte("york city")); err != nil || !reflect.DeepEqual(docIDs, []uint64{2}) {
+		t.Errorf("Contains after rebuild returned %v (%v)", docIDs, err)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestFsckGramsChanged(t *testing.T) {
+	var (
+		indexName = "test-fsck-grams-changed"
+		indexDir  = DataDirTmp + "/" + indexName
+		report    *FsckReport
+		docIDs    []uint64
+		metadata  = Metadata{
+			"name": Metadata{"type": "string", "filters": "ngram", "maxGram": 3},
+		}
+		changed = Metadata{
+			"name": Metadata{"type": "string", "filters": "ngram", "maxGram": 5},
+		}
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "Neoway"}`,
+		`{"name": "Broadway"}`,
+	} {
+		if err = index.Add(uint64(id+1), []byte(doc), metadata); err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	// the grams of the documents indexed before would be missed
+	if err = index.Add(3, []byte(`{"name": "Neosearch"}`), changed); err == nil {
+		t.Error("Changed n-gram configuration should fail")
+	}
+
+	if docIDs, err = index.ContainsID([]byte("name"), []byte("oadwa")); err != nil || !reflect.DeepEqual(docIDs, []uint64{2}) {
+		t.Errorf("Contains returned %v (%v)", docIDs, err)
+	}
+
+	report, err = index.Fsck(changed, false)
+
+	if err != nil || len(report.Problems) != 1 || report.Problems[0].Kind != FsckChangedConfig ||
+		string(report.Problems[0].Key) != ngramStorage("name") || report.Repaired {
+		t.Errorf("Unexpected problems: %v (%v)", report, err)
+		goto cleanup
+	}
+
+	// the store is rebuilt with the new configuration
+	if report, err = index.Fsck(changed, true); err != nil || !report.Repaired {
+		t.Errorf("Repair returned %v (%v)", report, err)
+		goto cleanup
+	}
+
+	if report, err = index.Fsck(changed, false); err != nil || len(report.Problems) != 0 {
+		t.Errorf("Rebuilt index reported: %v (%v)", report, err)
+	}
+
+	if err = index.Add(3, []byte(`{"name": "Neosearch"}`), changed); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if docIDs, err = index.ContainsID([]byte("name"), []byte("oadwa")); err != nil || !reflect.DeepEqual(docIDs, []uint64{2}) {
+		t.Errorf("Contains after rebuild returned %v (%v)", docIDs, err)
+	}
+
+	if docIDs, err = index.ContainsID([]byte("name"), []byte("neo")); err != nil || !reflect.DeepEqual(docIDs, []uint64{1, 3}) {
+		t.Errorf("Contains after rebuild returned %v (%v)", docIDs, err)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+// rawPostings encodes `ids` as stored by mergeset, without sorting.
+func rawPostings(ids []uint64) []byte {
+	data := []byte{}
+
+	for _, id := range ids {
+		data = append(data, utils.Uint64ToBytes(id)...)
+	}
+
+	return data
+}
@@ -0,0 +1,587 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"golang.org/x/net/context"
+)
+
+const (
+	// EarthRadius is the mean radius of Earth in meters
+	EarthRadius = 6371008.8
+
+	// maxGeoRanges is the maximum number of ranges of the Z-order curve
+	// scanned to cover a bounding box.
+	maxGeoRanges = 64
+
+	geoCells = 1 << 32
+)
+
+// GeoPoint is a point in the surface of Earth.
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// geoStorage is the store of the Z-order keys of the points of `field`.
+// Each key have the posting list of documents with that point.
+func geoStorage(field string) string {
+	return field + "_geo.idx"
+}
+
+// geoDocStorage is the store of the points (Z-order keys) of each
+// document, used to sort by distance.
+func geoDocStorage(field string) string {
+	return field + "_geodoc.idx"
+}
+
+// ParseGeoPoint parses a geo_point value. The point could be an object
+// like {"lat": -27.59, "lon": -48.54} or a string like "-27.59,-48.54".
+func ParseGeoPoint(value interface{}) (GeoPoint, error) {
+	var (
+		point GeoPoint
+		err   error
+	)
+
+	switch v := value.(type) {
+	case GeoPoint:
+		point = v
+	case string:
+		parts := strings.Split(v, ",")
+
+		if len(parts) != 2 {
+			return point, fmt.Errorf("Invalid geo_point '%s'. Expected 'lat,lon'", v)
+		}
+
+		if point.Lat, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64); err != nil {
+			return point, fmt.Errorf("Invalid latitude in geo_point '%s'", v)
+		}
+
+		if point.Lon, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64); err != nil {
+			return point, fmt.Errorf("Invalid longitude in geo_point '%s'", v)
+		}
+	case map[string]interface{}:
+		lat, okLat := v["lat"].(float64)
+		lon, okLon := v["lon"].(float64)
+
+		if !okLat || !okLon {
+			return point, fmt.Errorf("Invalid geo_point %v. Numeric 'lat' and 'lon' are required", v)
+		}
+
+		point = GeoPoint{Lat: lat, Lon: lon}
+	default:
+		return point, fmt.Errorf("Invalid geo_point: %v", value)
+	}
+
+	if point.Lat < -90 || point.Lat > 90 || point.Lon < -180 || point.Lon > 180 {
+		return point, fmt.Errorf("geo_point out of range: %+v", point)
+	}
+
+	return point, nil
+}
+
+// ParseDistance parses a distance in meters. The distance could be a
+// number of meters or a string with one of the units "m", "km" or "mi",
+// like "10km".
+func ParseDistance(value interface{}) (float64, error) {
+	var (
+		distance float64
+		err      error
+	)
+
+	switch v := value.(type) {
+	case float64:
+		distance = v
+	case string:
+		multiplier := 1.0
+		str := strings.TrimSpace(v)
+
+		if strings.HasSuffix(str, "km") {
+			multiplier = 1000
+			str = str[:len(str)-2]
+		} else if strings.HasSuffix(str, "mi") {
+			multiplier = 1609.344
+			str = str[:len(str)-2]
+		} else if strings.HasSuffix(str, "m") {
+			str = str[:len(str)-1]
+		}
+
+		if distance, err = strconv.ParseFloat(strings.TrimSpace(str), 64); err != nil {
+			return 0, fmt.Errorf("Invalid distance '%s'", v)
+		}
+
+		distance *= multiplier
+	default:
+		return 0, fmt.Errorf("Invalid distance: %v", value)
+	}
+
+	if distance < 0 {
+		return 0, fmt.Errorf("Invalid negative distance: %v", value)
+	}
+
+	return distance, nil
+}
+
+// Distance returns the great-circle distance in meters between `p` and
+// `o` (haversine formula).
+func (p GeoPoint) Distance(o GeoPoint) float64 {
+	lat1 := p.Lat * math.Pi / 180
+	lat2 := o.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (o.Lon - p.Lon) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// geoCell returns the cell of the 2^32 x 2^32 grid containing `p`.
+func geoCell(p GeoPoint) (x, y uint32) {
+	return scaleCoord(p.Lon, 180), scaleCoord(p.Lat, 90)
+}
+
+func scaleCoord(v, max float64) uint32 {
+	cell := math.Floor((v + max) / (2 * max) * geoCells)
+
+	if cell >= geoCells {
+		return geoCells - 1
+	}
+
+	return uint32(cell)
+}
+
+func unscaleCoord(cell uint32, max float64) float64 {
+	return (float64(cell)+0.5)/geoCells*2*max - max
+}
+
+// interleave returns the Z-order (Morton code) of the cell x, y. The bits
+// of the longitude comes first, like in geohashes, then the Z-order of
+// the points in a geohash cell are a contiguous range.
+func interleave(x, y uint32) uint64 {
+	return spread(x)<<1 | spread(y)
+}
+
+func deinterleave(z uint64) (x, y uint32) {
+	return compact(z >> 1), compact(z)
+}
+
+func spread(v uint32) uint64 {
+	z := uint64(v)
+	z = (z | z<<16) & 0x0000FFFF0000FFFF
+	z = (z | z<<8) & 0x00FF00FF00FF00FF
+	z = (z | z<<4) & 0x0F0F0F0F0F0F0F0F
+	z = (z | z<<2) & 0x3333333333333333
+	z = (z | z<<1) & 0x5555555555555555
+	return z
+}
+
+func compact(z uint64) uint32 {
+	z &= 0x5555555555555555
+	z = (z | z>>1) & 0x3333333333333333
+	z = (z | z>>2) & 0x0F0F0F0F0F0F0F0F
+	z = (z | z>>4) & 0x00FF00FF00FF00FF
+	z = (z | z>>8) & 0x0000FFFF0000FFFF
+	z = (z | z>>16) & 0x00000000FFFFFFFF
+	return uint32(z)
+}
+
+func geoEncode(p GeoPoint) uint64 {
+	return interleave(geoCell(p))
+}
+
+// geoDecode returns the center of the cell with Z-order `z`. The cells
+// are smaller than 1cm, then the decoded point is good enough for exact
+// distance filters.
+func geoDecode(z uint64) GeoPoint {
+	x, y := deinterleave(z)
+
+	return GeoPoint{
+		Lat: unscaleCoord(y, 90),
+		Lon: unscaleCoord(x, 180),
+	}
+}
+
+// buildIndexGeoPoint builds the commands to index the geo_point `value`.
+func (i *Index) buildIndexGeoPoint(id uint64, field string, value interface{}) ([]engine.Command, error) {
+	var commands []engine.Command
+
+	point, err := ParseGeoPoint(value)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error indexing field '%s'. %s", field, err.Error())
+	}
+
+	z := utils.Uint64ToBytes(geoEncode(point))
+
+	commands = append(commands, engine.Command{
+		Index:     i.Name,
+		Database:  geoStorage(field),
+		Command:   "mergeset",
+		Key:       z,
+		KeyType:   engine.TypeUint,
+		Value:     utils.Uint64ToBytes(id),
+		ValueType: engine.TypeUint,
+	}, engine.Command{
+		Index:     i.Name,
+		Database:  geoDocStorage(field),
+		Command:   "mergeset",
+		Key:       utils.Uint64ToBytes(id),
+		KeyType:   engine.TypeUint,
+		Value:     z,
+		ValueType: engine.TypeUint,
+	})
+
+	return commands, nil
+}
+
+// geoBox is a rectangle of cells of the grid, inclusive.
+type geoBox struct {
+	minX, minY, maxX, maxY uint32
+}
+
+// geoBoxes returns the boxes of cells covering the area between
+// `topLeft` and `bottomRight`. Boxes crossing the antimeridian are
+// splitted in two.
+func geoBoxes(topLeft, bottomRight GeoPoint) []geoBox {
+	left, top := geoCell(topLeft)
+	right, bottom := geoCell(bottomRight)
+
+	if topLeft.Lon <= bottomRight.Lon {
+		return []geoBox{{left, bottom, right, top}}
+	}
+
+	return []geoBox{
+		{left, bottom, geoCells - 1, top},
+		{0, bottom, right, top},
+	}
+}
+
+// zRanges returns the ranges of the Z-order curve covering `box`. The
+// grid is visited like a quadtree, until the cells are fully inside the
+// box or the number of ranges would be greater than maxGeoRanges. The
+// ranges could contain points outside of the box, then the keys must be
+// verified.
+func zRanges(box geoBox) [][2]uint64 {
+	type cell struct {
+		x, y  uint64
+		level uint
+	}
+
+	var (
+		ranges  [][2]uint64
+		partial = []cell{{0, 0, 0}}
+	)
+
+	cellRange := func(c cell) [2]uint64 {
+		if c.level == 0 {
+			return [2]uint64{0, math.MaxUint64}
+		}
+
+		shift := 2 * (32 - c.level)
+		start := interleave(uint32(c.x<<(32-c.level)), uint32(c.y<<(32-c.level)))
+
+		return [2]uint64{start, start | (1<<shift - 1)}
+	}
+
+	for len(partial) > 0 {
+		var next []cell
+
+		if len(ranges)+4*len(partial) > maxGeoRanges || partial[0].level == 32 {
+			for _, c := range partial {
+				ranges = append(ranges, cellRange(c))
+			}
+
+			break
+		}
+
+		for _, c := range partial {
+			for _, child := range []cell{
+				{c.x << 1, c.y << 1, c.level + 1},
+				{c.x << 1, c.y<<1 | 1, c.level + 1},
+				{c.x<<1 | 1, c.y << 1, c.level + 1},
+				{c.x<<1 | 1, c.y<<1 | 1, c.level + 1},
+			} {
+				shift := 32 - child.level
+				minX, minY := child.x<<shift, child.y<<shift
+				maxX, maxY := minX|(1<<shift-1), minY|(1<<shift-1)
+
+				if maxX < uint64(box.minX) || minX > uint64(box.maxX) ||
+					maxY < uint64(box.minY) || minY > uint64(box.maxY) {
+					continue
+				}
+
+				if minX >= uint64(box.minX) && maxX <= uint64(box.maxX) &&
+					minY >= uint64(box.minY) && maxY <= uint64(box.maxY) {
+					ranges = append(ranges, cellRange(child))
+					continue
+				}
+
+				next = append(next, child)
+			}
+		}
+
+		partial = next
+	}
+
+	sort.Sort(zRangeSlice(ranges))
+
+	// merge contiguous ranges
+	merged := ranges[:0]
+
+	for _, r := range ranges {
+		last := len(merged) - 1
+
+		if last >= 0 && merged[last][1] != math.MaxUint64 && merged[last][1]+1 >= r[0] {
+			if r[1] > merged[last][1] {
+				merged[last][1] = r[1]
+			}
+
+			continue
+		}
+
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+type zRangeSlice [][2]uint64
+
+func (s zRangeSlice) Len() int           { return len(s) }
+func (s zRangeSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s zRangeSlice) Less(i, j int) bool { return s[i][0] < s[j][0] }
+
+// matchGeo returns the ids of documents with a point of `field` inside
+// the boxes and accepted by `match`. It stops when `ctx` is done and
+// returns the error of `ctx`.
+func (i *Index) matchGeo(ctx context.Context, field []byte, boxes []geoBox, match func(p GeoPoint) bool) ([]uint64, error) {
+	var docIDs []uint64
+
+	storekv, err := i.engine.AcquireStore(i.Name, geoStorage(utils.FieldNorm(string(field))))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	for _, box := range boxes {
+		for _, r := range zRanges(box) {
+			for it.Seek(utils.Uint64ToBytes(r[0])); it.Valid(); it.Next() {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+
+				z := utils.BytesToUint64(it.Key())
+
+				if z > r[1] {
+					break
+				}
+
+				x, y := deinterleave(z)
+
+				if x < box.minX || x > box.maxX || y < box.minY || y > box.maxY {
+					continue
+				}
+
+				if match != nil && !match(geoDecode(z)) {
+					continue
+				}
+
+				docIDs = unionPostings(docIDs, it.Value())
+			}
+
+			if err := it.GetError(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return docIDs, nil
+}
+
+// GeoBoundingBoxID returns the ids of documents with a point of field
+// `field` inside the box between `topLeft` and `bottomRight`. If the
+// left longitude is greater than the right one, the box crosses the
+// antimeridian.
+func (i *Index) GeoBoundingBoxID(field []byte, topLeft, bottomRight GeoPoint) ([]uint64, error) {
+	return i.GeoBoundingBoxIDContext(context.Background(), field, topLeft, bottomRight)
+}
+
+// GeoBoundingBoxIDContext is like GeoBoundingBoxID, but stops walking the
+// points when `ctx` is done and returns the error of `ctx`.
+func (i *Index) GeoBoundingBoxIDContext(ctx context.Context, field []byte, topLeft, bottomRight GeoPoint) ([]uint64, error) {
+	if topLeft.Lat < bottomRight.Lat {
+		return nil, errors.New("Invalid bounding box: top latitude is lesser than bottom latitude")
+	}
+
+	return i.matchGeo(ctx, field, geoBoxes(topLeft, bottomRight), nil)
+}
+
+// GeoBoundingBox search documents with a point of field `field` inside
+// the box between `topLeft` and `bottomRight`.
+func (i *Index) GeoBoundingBox(field []byte, topLeft, bottomRight GeoPoint) ([]string, error) {
+	return i.GeoBoundingBoxContext(context.Background(), field, topLeft, bottomRight)
+}
+
+// GeoBoundingBoxContext is like GeoBoundingBox, but stops when `ctx` is
+// done and returns the error of `ctx`.
+func (i *Index) GeoBoundingBoxContext(ctx context.Context, field []byte, topLeft, bottomRight GeoPoint) ([]string, error) {
+	docIDs, err := i.GeoBoundingBoxIDContext(ctx, field, topLeft, bottomRight)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.getDocsContext(ctx, docIDs)
+}
+
+// GeoDistanceID returns the ids of documents with a point of field
+// `field` at most `distance` meters from `center`. The keys in the
+// bounding box of the circle are scanned and then filtered by the exact
+// distance.
+func (i *Index) GeoDistanceID(field []byte, center GeoPoint, distance float64) ([]uint64, error) {
+	return i.GeoDistanceIDContext(context.Background(), field, center, distance)
+}
+
+// GeoDistanceIDContext is like GeoDistanceID, but stops walking the
+// points when `ctx` is done and returns the error of `ctx`.
+func (i *Index) GeoDistanceIDContext(ctx context.Context, field []byte, center GeoPoint, distance float64) ([]uint64, error) {
+	dLat := distance / EarthRadius * 180 / math.Pi
+	topLeft := GeoPoint{Lat: math.Min(90, center.Lat+dLat), Lon: -180}
+	bottomRight := GeoPoint{Lat: math.Max(-90, center.Lat-dLat), Lon: 180}
+
+	// the circle doesn't contains a pole, then the box could be
+	// narrowed in longitude
+	if topLeft.Lat < 90 && bottomRight.Lat > -90 {
+		maxLat := math.Max(math.Abs(topLeft.Lat), math.Abs(bottomRight.Lat))
+		dLon := dLat / math.Cos(maxLat*math.Pi/180)
+
+		if dLon < 180 {
+			topLeft.Lon = center.Lon - dLon
+			bottomRight.Lon = center.Lon + dLon
+
+			if topLeft.Lon < -180 {
+				topLeft.Lon += 360
+			}
+
+			if bottomRight.Lon > 180 {
+				bottomRight.Lon -= 360
+			}
+		}
+	}
+
+	return i.matchGeo(ctx, field, geoBoxes(topLeft, bottomRight), func(p GeoPoint) bool {
+		return center.Distance(p) <= distance
+	})
+}
+
+// GeoDistance search documents with a point of field `field` at most
+// `distance` meters from `center`.
+func (i *Index) GeoDistance(field []byte, center GeoPoint, distance float64) ([]string, error) {
+	return i.GeoDistanceContext(context.Background(), field, center, distance)
+}
+
+// GeoDistanceContext is like GeoDistance, but stops when `ctx` is done
+// and returns the error of `ctx`.
+func (i *Index) GeoDistanceContext(ctx context.Context, field []byte, center GeoPoint, distance float64) ([]string, error) {
+	docIDs, err := i.GeoDistanceIDContext(ctx, field, center, distance)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.getDocsContext(ctx, docIDs)
+}
+
+// GeoDistances returns the distance in meters from `origin` to the
+// nearest point of field `field` of each document in `docIDs`. Documents
+// without the field have distance +Inf.
+func (i *Index) GeoDistances(field []byte, docIDs []uint64, origin GeoPoint) ([]float64, error) {
+	return i.GeoDistancesContext(context.Background(), field, docIDs, origin)
+}
+
+// GeoDistancesContext is like GeoDistances, but stops when `ctx` is done
+// and returns the error of `ctx`.
+func (i *Index) GeoDistancesContext(ctx context.Context, field []byte, docIDs []uint64, origin GeoPoint) ([]float64, error) {
+	distances := make([]float64, len(docIDs))
+	storage := geoDocStorage(utils.FieldNorm(string(field)))
+
+	for idx, docID := range docIDs {
+		data, err := i.engine.ExecuteContext(ctx, engine.Command{
+			Index:    i.Name,
+			Database: storage,
+			Command:  "get",
+			Key:      utils.Uint64ToBytes(docID),
+			KeyType:  engine.TypeUint,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		distances[idx] = math.Inf(1)
+
+		for j := 0; j+8 <= len(data); j += 8 {
+			d := origin.Distance(geoDecode(utils.BytesToUint64(data[j : j+8])))
+
+			if d < distances[idx] {
+				distances[idx] = d
+			}
+		}
+	}
+
+	return distances, nil
+}
+
+type byDistance struct {
+	docIDs    []uint64
+	distances []float64
+}
+
+func (s byDistance) Len() int { return len(s.docIDs) }
+func (s byDistance) Swap(i, j int) {
+	s.docIDs[i], s.docIDs[j] = s.docIDs[j], s.docIDs[i]
+	s.distances[i], s.distances[j] = s.distances[j], s.distances[i]
+}
+func (s byDistance) Less(i, j int) bool { return s.distances[i] < s.distances[j] }
+
+// SortByDistance sorts `docIDs` by the distance of their points of field
+// `field` to `origin`, nearest first (or farthest first, if `desc`).
+// Documents without the field are always moved to the end.
+func (i *Index) SortByDistance(field []byte, docIDs []uint64, origin GeoPoint, desc bool) error {
+	return i.SortByDistanceContext(context.Background(), field, docIDs, origin, desc)
+}
+
+// SortByDistanceContext is like SortByDistance, but stops when `ctx` is
+// done and returns the error of `ctx`, leaving `docIDs` unchanged.
+func (i *Index) SortByDistanceContext(ctx context.Context, field []byte, docIDs []uint64, origin GeoPoint, desc bool) error {
+	distances, err := i.GeoDistancesContext(ctx, field, docIDs, origin)
+
+	if err != nil {
+		return err
+	}
+
+	if desc {
+		for idx, d := range distances {
+			if !math.IsInf(d, 1) {
+				distances[idx] = -d
+			}
+		}
+	}
+
+	sort.Stable(byDistance{docIDs, distances})
+	return nil
+}
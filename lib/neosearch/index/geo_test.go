@@ -0,0 +1,210 @@
+package index
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseGeoPoint(t *testing.T) {
+	for _, table := range []struct {
+		value    interface{}
+		expected GeoPoint
+		fail     bool
+	}{
+		{map[string]interface{}{"lat": -27.59, "lon": -48.54}, GeoPoint{-27.59, -48.54}, false},
+		{"-27.59, -48.54", GeoPoint{-27.59, -48.54}, false},
+		{"-27.59", GeoPoint{}, true},
+		{"a,b", GeoPoint{}, true},
+		{map[string]interface{}{"lat": "-27.59", "lon": -48.54}, GeoPoint{}, true},
+		{"91,0", GeoPoint{}, true},
+		{"0,-181", GeoPoint{}, true},
+		{float64(10), GeoPoint{}, true},
+	} {
+		point, err := ParseGeoPoint(table.value)
+
+		if table.fail {
+			if err == nil {
+				t.Errorf("geo_point %v should fail", table.value)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if point != table.expected {
+			t.Errorf("geo_point %v differs: %+v != %+v", table.value, point, table.expected)
+		}
+	}
+
+	for _, table := range []struct {
+		value    interface{}
+		expected float64
+	}{
+		{float64(100), 100},
+		{"100", 100},
+		{"250m", 250},
+		{"1.5km", 1500},
+		{"2mi", 3218.688},
+	} {
+		distance, err := ParseDistance(table.value)
+
+		if err != nil || distance != table.expected {
+			t.Errorf("Distance %v differs: %f != %f (%v)", table.value, distance, table.expected, err)
+		}
+	}
+
+	if _, err := ParseDistance("-1km"); err == nil {
+		t.Error("Negative distance should fail")
+	}
+}
+
+func TestGeoEncode(t *testing.T) {
+	for _, p := range []GeoPoint{
+		{0, 0},
+		{-27.5954, -48.5480},
+		{90, 180},
+		{-90, -180},
+		{35.6762, 139.6503},
+	} {
+		decoded := geoDecode(geoEncode(p))
+
+		if math.Abs(decoded.Lat-p.Lat) > 1e-7 || math.Abs(decoded.Lon-p.Lon) > 1e-7 {
+			t.Errorf("Decoded point differs: %+v != %+v", decoded, p)
+		}
+	}
+
+	// points in the same quadrant share the prefix of the key
+	if geoEncode(GeoPoint{10, 10})>>62 != geoEncode(GeoPoint{80, 170})>>62 {
+		t.Error("Z-order of points in the same quadrant differs")
+	}
+
+	if d := (GeoPoint{-27.5954, -48.5480}).Distance(GeoPoint{-23.5505, -46.6333}); math.Abs(d-489000) > 5000 {
+		t.Errorf("Unexpected distance between Florianópolis and São Paulo: %f", d)
+	}
+}
+
+func TestGeoQueries(t *testing.T) {
+	var (
+		indexName = "test-geo"
+		indexDir  = DataDirTmp + "/" + indexName
+		docIDs    []uint64
+		metadata  = Metadata{
+			"location": Metadata{"type": "geo_point"},
+			"offices": Metadata{
+				"type":     "slice",
+				"metadata": Metadata{"type": "geo_point"},
+			},
+		}
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"city": "Florianópolis", "location": {"lat": -27.5954, "lon": -48.5480}}`,
+		`{"city": "São Paulo", "location": "-23.5505,-46.6333"}`,
+		`{"city": "Rio de Janeiro", "location": {"lat": -22.9068, "lon": -43.1729}}`,
+		`{"city": "New York", "location": {"lat": 40.7128, "lon": -74.0060}}`,
+		`{"city": "Tokyo", "location": {"lat": 35.6762, "lon": 139.6503}}`,
+		`{"city": "Suva", "location": {"lat": -18.1248, "lon": 178.4501}}`,
+		`{"city": "Apia", "location": {"lat": -13.8333, "lon": -171.75}}`,
+		`{"company": "Neoway", "offices": ["-27.5954,-48.5480", "40.7128,-74.0060"]}`,
+	} {
+		err = index.Add(uint64(id+1), []byte(doc), metadata)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	if err = index.Add(100, []byte(`{"location": "-27.5954"}`), metadata); err == nil {
+		t.Error("Invalid geo_point should fail")
+	}
+
+	for _, table := range []struct {
+		center   GeoPoint
+		distance float64
+		expected []uint64
+	}{
+		{GeoPoint{-23.5505, -46.6333}, 400000, []uint64{2, 3}},
+		{GeoPoint{-23.5505, -46.6333}, 500000, []uint64{1, 2, 3}},
+		{GeoPoint{-27.5954, -48.5480}, 10, []uint64{1}},
+		{GeoPoint{-16, 179.9}, 500000, []uint64{6}},
+		{GeoPoint{-16, 179.9}, 1000000, []uint64{6, 7}},
+		{GeoPoint{0, 0}, 100000, nil},
+		{GeoPoint{0, 0}, 30000000, []uint64{1, 2, 3, 4, 5, 6, 7}},
+	} {
+		docIDs, err = index.GeoDistanceID([]byte("location"), table.center, table.distance)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if !reflect.DeepEqual(docIDs, table.expected) {
+			t.Errorf("Distance %f from %+v returned %v != %v", table.distance, table.center, docIDs, table.expected)
+		}
+	}
+
+	for _, table := range []struct {
+		topLeft, bottomRight GeoPoint
+		expected             []uint64
+	}{
+		{GeoPoint{-20, -50}, GeoPoint{-30, -45}, []uint64{1, 2}},
+		{GeoPoint{-20, -50}, GeoPoint{-30, -40}, []uint64{1, 2, 3}},
+		{GeoPoint{-10, 170}, GeoPoint{-20, -170}, []uint64{6, 7}},
+		{GeoPoint{90, -180}, GeoPoint{0, 180}, []uint64{4, 5}},
+	} {
+		docIDs, err = index.GeoBoundingBoxID([]byte("location"), table.topLeft, table.bottomRight)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if !reflect.DeepEqual(docIDs, table.expected) {
+			t.Errorf("Box %+v %+v returned %v != %v", table.topLeft, table.bottomRight, docIDs, table.expected)
+		}
+	}
+
+	docIDs, err = index.GeoDistanceID([]byte("offices"), GeoPoint{40.7, -74}, 10000)
+
+	if err != nil || !reflect.DeepEqual(docIDs, []uint64{8}) {
+		t.Errorf("Failed to search array of points: %v (%v)", docIDs, err)
+	}
+
+	docIDs = []uint64{1, 2, 3, 4, 5, 8}
+
+	if err = index.SortByDistance([]byte("location"), docIDs, GeoPoint{-22, -43}, false); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(docIDs, []uint64{3, 2, 1, 4, 5, 8}) {
+		t.Errorf("Invalid sort by distance: %v", docIDs)
+	}
+
+	if err = index.SortByDistance([]byte("location"), docIDs, GeoPoint{-22, -43}, true); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(docIDs, []uint64{5, 4, 1, 2, 3, 8}) {
+		t.Errorf("Invalid descending sort by distance: %v", docIDs)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
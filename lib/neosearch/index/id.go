@@ -0,0 +1,309 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"golang.org/x/net/context"
+)
+
+const (
+	// sequenceDB stores the last id reserved for NextID
+	sequenceDB string = "_sequence.db"
+
+	// idBlockSize is the number of ids reserved at once in the sequence
+	idBlockSize = 1000
+
+	// externalDB maps the external ids of documents to internal ids
+	externalDB string = "_ids.db"
+)
+
+var sequenceKey = []byte("id")
+
+// lastID returns the greatest id in use by the index: the last id
+// reserved or the greatest id of the stored documents, if greater.
+func (i *Index) lastID() (uint64, error) {
+	var last uint64
+
+	data, err := i.engine.Execute(engine.Command{
+		Index:    i.Name,
+		Database: sequenceDB,
+		Command:  "get",
+		Key:      sequenceKey,
+		KeyType:  engine.TypeString,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(data) == 8 {
+		last = utils.BytesToUint64(data)
+	}
+
+	storekv, err := i.engine.AcquireStore(i.Name, dbName)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	it.SeekToLast()
+
+	if it.Valid() {
+		if docID := utils.BytesToUint64(it.Key()); docID > last {
+			last = docID
+		}
+	}
+
+	return last, it.GetError()
+}
+
+// nextID allocates a new id. The caller must hold seqMutex. The ids are
+// reserved in blocks of idBlockSize, then the sequence is written once
+// per block.
+func (i *Index) nextID() (uint64, error) {
+	if !i.seqLoaded {
+		last, err := i.lastID()
+
+		if err != nil {
+			return 0, err
+		}
+
+		// explicit ids of batches not committed yet aren't stored
+		if i.seqExplicit > last {
+			last = i.seqExplicit
+		}
+
+		i.seq = last
+		i.seqReserved = last
+		i.seqLoaded = true
+	}
+
+	id := i.seq + 1
+
+	if id > i.seqReserved {
+		reserved := id + idBlockSize - 1
+
+		_, err := i.engine.Execute(engine.Command{
+			Index:     i.Name,
+			Database:  sequenceDB,
+			Command:   "set",
+			Key:       sequenceKey,
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(reserved),
+			ValueType: engine.TypeUint,
+		})
+
+		if err != nil {
+			return 0, err
+		}
+
+		i.seqReserved = reserved
+	}
+
+	i.seq = id
+	return id, nil
+}
+
+// NextID allocates a new document id from the sequence of the index. The
+// sequence is persisted, then ids aren't reused after the index is
+// reopened, and never returns ids of documents added with explicit ids.
+// The ids are reserved in blocks: the ids of the block not allocated
+// when the index is closed are skipped.
+func (i *Index) NextID() (uint64, error) {
+	i.seqMutex.Lock()
+	defer i.seqMutex.Unlock()
+
+	return i.nextID()
+}
+
+// useID records that `id` was used by a document added with an explicit
+// id, then NextID will not allocate it, even if the sequence is loaded
+// before the document is committed.
+func (i *Index) useID(id uint64) {
+	i.seqMutex.Lock()
+	defer i.seqMutex.Unlock()
+
+	if id > i.seqExplicit {
+		i.seqExplicit = id
+	}
+
+	if i.seqLoaded && id > i.seq {
+		i.seq = id
+	}
+}
+
+// LookupID returns the internal id of the document with external id
+// `extID` and true, or false if there's no document with that id.
+func (i *Index) LookupID(extID string) (uint64, bool, error) {
+	return i.LookupIDContext(context.Background(), extID)
+}
+
+// LookupIDContext is like LookupID, but fails with the error of `ctx` if
+// it's done.
+func (i *Index) LookupIDContext(ctx context.Context, extID string) (uint64, bool, error) {
+	if extID == "" {
+		return 0, false, errors.New("Empty document id")
+	}
+
+	data, err := i.engine.ExecuteContext(ctx, engine.Command{
+		Index:    i.Name,
+		Database: externalDB,
+		Command:  "get",
+		Key:      []byte(extID),
+		KeyType:  engine.TypeString,
+	})
+
+	if err != nil || len(data) != 8 {
+		return 0, false, err
+	}
+
+	return utils.BytesToUint64(data), true, nil
+}
+
+// pendingID is an external id mapped by batches not committed yet.
+type pendingID struct {
+	id   uint64
+	refs int
+}
+
+// mapID returns the internal id of the external id `extID`, allocating
+// a new one from the sequence if `extID` isn't mapped yet, and the command
+// to store the mapping (nil if already stored). The mapping is written
+// with the document, then it's pending until the batch is committed or
+// discarded (see releaseIDs): the batches mapping the same external id
+// in the meantime get the same id.
+func (i *Index) mapID(extID string) (uint64, *engine.Command, error) {
+	i.seqMutex.Lock()
+	defer i.seqMutex.Unlock()
+
+	id, found, err := i.LookupID(extID)
+
+	if err != nil || found {
+		return id, nil, err
+	}
+
+	pending, ok := i.pendingIDs[extID]
+
+	if !ok {
+		if id, err = i.nextID(); err != nil {
+			return 0, nil, err
+		}
+
+		if i.pendingIDs == nil {
+			i.pendingIDs = make(map[string]*pendingID)
+		}
+
+		pending = &pendingID{id: id}
+		i.pendingIDs[extID] = pending
+	}
+
+	pending.refs++
+
+	return pending.id, &engine.Command{
+		Index:     i.Name,
+		Database:  externalDB,
+		Command:   "set",
+		Key:       []byte(extID),
+		KeyType:   engine.TypeString,
+		Value:     utils.Uint64ToBytes(pending.id),
+		ValueType: engine.TypeUint,
+	}, nil
+}
+
+// releaseIDs releases the pending mappings of the external ids `extIDs`,
+// after their batch is committed or discarded.
+func (i *Index) releaseIDs(extIDs []string) {
+	i.seqMutex.Lock()
+	defer i.seqMutex.Unlock()
+
+	for _, extID := range extIDs {
+		pending, ok := i.pendingIDs[extID]
+
+		if !ok {
+			continue
+		}
+
+		if pending.refs--; pending.refs <= 0 {
+			delete(i.pendingIDs, extID)
+		}
+	}
+}
+
+// documentID returns the internal id of a document with `_id` field
+// `value`: unsigned integers are internal ids and documents without
+// `_id` get a new id from the sequence. The string ids (external ids)
+// are mapped by Batch.AddExternal.
+func (i *Index) documentID(value interface{}) (uint64, error) {
+	switch v := value.(type) {
+	case nil:
+		return i.NextID()
+	case json.Number:
+		id, err := strconv.ParseUint(v.String(), 10, 64)
+
+		if err != nil {
+			return 0, fmt.Errorf("Invalid document _id: %s", v)
+		}
+
+		return id, nil
+	}
+
+	return 0, fmt.Errorf("Invalid document _id: %v", value)
+}
+
+// AddDocument indexes the document `doc` using the id given by its `_id`
+// field and returns the id used. See Batch.AddDocument.
+func (i *Index) AddDocument(doc []byte, metadata map[string]interface{}) (uint64, error) {
+	batch := i.NewBatch()
+
+	id, err := batch.AddDocument(doc, metadata)
+
+	if err != nil {
+		batch.Discard()
+		return 0, err
+	}
+
+	return id, batch.Commit()
+}
+
+// AddExternal indexes the document `doc` with the external id `extID`
+// and returns the internal id used. See Batch.AddExternal.
+func (i *Index) AddExternal(extID string, doc []byte, metadata map[string]interface{}) (uint64, error) {
+	batch := i.NewBatch()
+
+	id, err := batch.AddExternal(extID, doc, metadata)
+
+	if err != nil {
+		batch.Discard()
+		return 0, err
+	}
+
+	return id, batch.Commit()
+}
+
+// idOf returns the `_id` field of the document `doc`.
+func idOf(doc []byte) (interface{}, error) {
+	var fields struct {
+		ID interface{} `json:"_id"`
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	return fields.ID, nil
+}
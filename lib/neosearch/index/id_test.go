@@ -0,0 +1,179 @@
+package index
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNextID(t *testing.T) {
+	var (
+		indexName = "test-next-id"
+		indexDir  = DataDirTmp + "/" + indexName
+		id        uint64
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, expected := range []uint64{1, 2, 3} {
+		id, err = index.NextID()
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if id != expected {
+			t.Errorf("NextID returned %d != %d", id, expected)
+		}
+	}
+
+	// explicit ids are never allocated again
+	err = index.Add(10, []byte(`{"name": "neoway"}`), nil)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if id, err = index.NextID(); err != nil || id != 11 {
+		t.Errorf("NextID returned %d (%v) != 11", id, err)
+	}
+
+	// the sequence survives reopening the index, skipping the ids
+	// reserved and not allocated
+	index.Close()
+
+	index, err = New(indexName, Config{DataDir: DataDirTmp}, false)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if id, err = index.NextID(); err != nil || id != idBlockSize+1 {
+		t.Errorf("NextID returned %d (%v) != %d", id, err, idBlockSize+1)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestNextIDPendingBatch(t *testing.T) {
+	var (
+		indexName = "test-next-id-pending"
+		indexDir  = DataDirTmp + "/" + indexName
+		id        uint64
+		batch     *Batch
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the sequence isn't loaded yet and the explicit id isn't stored
+	// before the commit
+	batch = index.NewBatch()
+
+	if err = batch.Add(100, []byte(`{"name": "neoway"}`), nil); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if id, err = index.NextID(); err != nil || id != 101 {
+		t.Errorf("NextID returned %d (%v) != 101", id, err)
+	}
+
+	if err = batch.Commit(); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if id, err = index.NextID(); err != nil || id != 102 {
+		t.Errorf("NextID returned %d (%v) != 102", id, err)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestAddDocument(t *testing.T) {
+	var (
+		indexName = "test-add-document"
+		indexDir  = DataDirTmp + "/" + indexName
+		id        uint64
+		found     bool
+		doc       []byte
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, table := range []struct {
+		doc string
+		id  uint64
+	}{
+		{`{"name": "neoway"}`, 1},
+		{`{"_id": 5, "name": "facebook"}`, 5},
+		{`{"_id": "11.222.333/0001-81", "name": "google"}`, 6},
+		{`{"_id": "11.222.333/0001-81", "name": "google inc"}`, 6},
+		{`{"name": "github"}`, 7},
+	} {
+		id, err = index.AddDocument([]byte(table.doc), nil)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if id != table.id {
+			t.Errorf("Document %s added with id %d != %d", table.doc, id, table.id)
+		}
+	}
+
+	id, found, err = index.LookupID("11.222.333/0001-81")
+
+	if err != nil || !found || id != 6 {
+		t.Errorf("LookupID returned %d, %v, %v", id, found, err)
+		goto cleanup
+	}
+
+	doc, err = index.Get(id)
+
+	if err != nil || string(doc) != `{"_id": "11.222.333/0001-81", "name": "google inc"}` {
+		t.Errorf("Unexpected document: %s (%v)", string(doc), err)
+	}
+
+	if _, found, err = index.LookupID("unknown"); err != nil || found {
+		t.Errorf("LookupID of unknown id returned %v, %v", found, err)
+	}
+
+	for _, invalid := range []string{
+		`{"_id": -1, "name": "neoway"}`,
+		`{"_id": 1.5, "name": "neoway"}`,
+		`{"_id": true, "name": "neoway"}`,
+		`{"_id": ""}`,
+		`[]`,
+	} {
+		if _, err = index.AddDocument([]byte(invalid), nil); err == nil {
+			t.Errorf("Document %s should fail", invalid)
+		}
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
@@ -9,17 +9,27 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
 	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
 	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
 	"github.com/extemporalgenome/slug"
+	"golang.org/x/net/context"
 )
 
 const (
 	dbName   string = "document.db"
 	indexExt string = "idx"
+
+	// walName is the name of the write-ahead log file in the index
+	// directory (see engine.NGConfig.LogPath)
+	walName string = "wal.log"
+
+	// changesName is the name of the change stream file in the index
+	// directory (see engine.NGConfig.ChangesPath)
+	changesName string = "changes.log"
 )
 
 // Config index
@@ -30,6 +40,23 @@ type Config struct {
 	Debug       bool
 	CacheSize   int
 	EnableCache bool
+
+	// MaxTermExpansion is the maximum number of terms that wildcard
+	// and regex queries are allowed to expand to. The queries visit at
+	// most TermVisitFactor times this number of terms.
+	MaxTermExpansion int
+
+	// MaxSuggestScan is the maximum number of terms visited by the
+	// suggestions. Suggestions are ranked among the terms visited, then
+	// they're approximate when the limit is reached.
+	MaxSuggestScan int
+
+	// Storage is the tuning of the stores of the index
+	Storage store.Tuning
+
+	// Changes enables the change stream of the index, read with
+	// Index.Changes.
+	Changes bool
 }
 
 // Index represents an entire index
@@ -39,10 +66,22 @@ type Index struct {
 	engine *engine.Engine
 	config Config
 
-	// Indicates that index abstraction should batch each write command
-	enableBatchMode bool
+	// Serializes the writes of the commits
+	writeMutex sync.Mutex
 
-	flushStorages []string
+	// Configurations of the n-gram stores, see gramConfigChanged
+	gramMutex   sync.Mutex
+	gramConfigs map[string]gramConfig
+
+	// Sequence of document ids, loaded on first use (see NextID), the
+	// greatest explicit id added and the external ids mapped by
+	// batches not committed yet
+	seqMutex    sync.Mutex
+	seq         uint64
+	seqReserved uint64
+	seqExplicit uint64
+	seqLoaded   bool
+	pendingIDs  map[string]*pendingID
 
 	fullDir string
 }
@@ -89,80 +128,63 @@ func (i *Index) setup(create bool) error {
 
 	i.fullDir = dataDir
 
-	i.engine = engine.New(engine.NGConfig{
+	// the writes are all-or-nothing, coordinated by the write-ahead log
+	// of the index
+	ngConfig := engine.NGConfig{
 		KVCfg: &store.KVConfig{
 			DataDir:     i.config.DataDir,
 			Debug:       i.config.Debug,
 			CacheSize:   i.config.CacheSize,
 			EnableCache: i.config.EnableCache,
+			Tuning:      i.config.Storage,
 		},
-	})
+		LogPath: dataDir + "/" + walName,
+	}
 
-	return nil
-}
+	if i.config.Changes {
+		ngConfig.ChangesPath = dataDir + "/" + changesName
+	}
+
+	i.engine = engine.New(ngConfig)
 
-// Batch enables write cache of command before FlushBatch is executed
-func (i *Index) Batch() {
-	i.enableBatchMode = true
+	// executes the writes interrupted by a crash
+	return i.engine.Recover()
 }
 
-// FlushBatch writes the cached commands to disk
-// Simple and ugly approach. Only to test the concepts.
-func (i *Index) FlushBatch() {
-	// flush the WriteBatch
-	for _, storeName := range i.flushStorages {
-		i.engine.Execute(engine.Command{
-			Index:    i.Name,
-			Database: storeName,
-			Command:  "flushbatch",
-		})
+// Changes opens the change stream of the index to read the writes of the
+// documents from the sequence number `offset` (see engine.OpenChanges).
+// The stream must be enabled by Config.Changes. The writes of Fsck and
+// Restore aren't in the stream.
+func (i *Index) Changes(offset uint64) (*engine.ChangeReader, error) {
+	return i.engine.Changes(offset)
+}
 
-		if i.config.Debug {
-			fmt.Printf("Flushing batch storage '%s' of index '%s'.\n",
-				storeName,
-				i.Name)
-		}
+// write executes `commands` with one batch per store (see
+// engine.ExecuteAll). The write is all-or-nothing across stores. The
+// caller must hold i.writeMutex.
+func (i *Index) write(commands []engine.Command) error {
+	if len(commands) == 0 {
+		return nil
 	}
 
-	i.flushStorages = make([]string, 0)
+	_, err := i.engine.ExecuteAll(commands)
+	return err
 }
 
 // Add executes the sequence of commands necessary to index the document `doc`.
 func (i *Index) Add(id uint64, doc []byte, metadata map[string]interface{}) error {
-	if metadata == nil {
-		metadata = Metadata{}
-	}
+	batch := i.NewBatch()
 
-	commands, err := i.BuildAdd(id, doc, metadata)
-
-	if err != nil {
+	if err := batch.Add(id, doc, metadata); err != nil {
 		return err
 	}
 
-	for _, cmd := range commands {
-		_, err := i.engine.Execute(cmd)
-
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return batch.Commit()
 }
 
 func (i *Index) BuildAdd(id uint64, doc []byte, metadata Metadata) ([]engine.Command, error) {
 	var commands []engine.Command
 
-	if i.enableBatchMode {
-		// batchMode says if the BATCH operation is pending on indices
-		// If true, then we need run USING <idx> BATCH; on each index.
-		// When the Add method returns, this means that every index is
-		// propertly in batchMode, then we can disable here.
-		defer func() {
-			i.enableBatchMode = false
-		}()
-	}
-
 	docCommands, err := i.buildAddDocument(id, doc)
 
 	if err != nil {
@@ -181,7 +203,7 @@ func (i *Index) BuildAdd(id uint64, doc []byte, metadata Metadata) ([]engine.Com
 		return nil, errors.New("Empty document")
 	}
 
-	fieldCommands, err := i.buildIndexFields(id, "", structData, metadata)
+	fieldCommands, err := i.buildIndexFields(id, "", structData, metadata, false)
 
 	if err != nil {
 		return nil, err
@@ -195,21 +217,13 @@ func (i *Index) BuildAdd(id uint64, doc []byte, metadata Metadata) ([]engine.Com
 		commands = append(commands, cmd)
 	}
 
-	return commands, nil
+	return append(commands, i.buildIndexPresence(id, structData)...), nil
 }
 
 func (i *Index) buildAddDocument(id uint64, doc []byte) ([]engine.Command, error) {
 	var commands []engine.Command
 
-	commands = make([]engine.Command, 0, 2)
-
-	if i.enableBatchMode {
-		cmd, err := i.buildBatchOn(dbName)
-
-		if err == nil {
-			commands = append(commands, cmd)
-		}
-	}
+	commands = make([]engine.Command, 0, 1)
 
 	cmd := engine.Command{}
 	cmd.Database = dbName
@@ -236,7 +250,13 @@ func (i *Index) buildGet(id uint64) engine.Command {
 
 // Get retrieves the document by id
 func (i *Index) Get(id uint64) ([]byte, error) {
-	return i.engine.Execute(i.buildGet(id))
+	return i.GetContext(context.Background(), id)
+}
+
+// GetContext is like Get, but fails with the error of `ctx` if it's
+// done before reading the document.
+func (i *Index) GetContext(ctx context.Context, id uint64) ([]byte, error) {
+	return i.engine.ExecuteContext(ctx, i.buildGet(id))
 }
 
 func (i *Index) GetAnalyze(id uint64) (engine.Command, error) {
@@ -246,6 +266,12 @@ func (i *Index) GetAnalyze(id uint64) (engine.Command, error) {
 // GetDocs returns the content of documents specified by docIDs and limited
 // by limit.
 func (i *Index) GetDocs(docIDs []uint64, limit uint) ([]string, error) {
+	return i.GetDocsContext(context.Background(), docIDs, limit)
+}
+
+// GetDocsContext is like GetDocs, but stops reading the documents when
+// `ctx` is done and returns the error of `ctx`.
+func (i *Index) GetDocsContext(ctx context.Context, docIDs []uint64, limit uint) ([]string, error) {
 	var (
 		docLen = uint(len(docIDs))
 	)
@@ -261,7 +287,7 @@ func (i *Index) GetDocs(docIDs []uint64, limit uint) ([]string, error) {
 			break
 		}
 
-		if byteDoc, err := i.Get(docID); err == nil {
+		if byteDoc, err := i.GetContext(ctx, docID); err == nil {
 			docs[idx] = string(byteDoc)
 		} else {
 			return nil, err
@@ -271,50 +297,10 @@ func (i *Index) GetDocs(docIDs []uint64, limit uint) ([]string, error) {
 	return docs, nil
 }
 
-func (i *Index) buildBatchOn(storage string) (engine.Command, error) {
-	if i.config.Debug {
-		fmt.Printf("Batch mode enabled for storage '%s' of index '%s'.\n",
-			storage,
-			i.Name,
-		)
-	}
-
-	for _, flush := range i.flushStorages {
-		if flush == storage {
-			return engine.Command{}, errors.New("Index already in batch mode")
-		}
-	}
-
-	i.flushStorages = append(i.flushStorages, storage)
-
-	command := engine.Command{
-		Index:     i.Name,
-		Database:  storage,
-		Command:   "batch",
-		Key:       nil,
-		KeyType:   engine.TypeNil,
-		Value:     nil,
-		ValueType: engine.TypeNil,
-	}
-
-	return command, nil
-}
-
-func (i *Index) enableBatchOn(storage string) error {
-	cmd, err := i.buildBatchOn(storage)
-
-	if err != nil {
-		return nil
-	}
-
-	_, err = i.engine.Execute(cmd)
-
-	return err
-}
-
 // buildIndexFields builds the list of commands to index document fields. Note that
-// the order os commands generated by field is sorted lexicografically (sort.Strings)
-func (i *Index) buildIndexFields(id uint64, baseField string, structData map[string]interface{}, metadata Metadata) ([]engine.Command, error) {
+// the order os commands generated by field is sorted lexicografically (sort.Strings).
+// `inArray` indicates that the fields are inside an array.
+func (i *Index) buildIndexFields(id uint64, baseField string, structData map[string]interface{}, metadata Metadata, inArray bool) ([]engine.Command, error) {
 	var (
 		commands []engine.Command
 		dataKeys []string
@@ -327,7 +313,7 @@ func (i *Index) buildIndexFields(id uint64, baseField string, structData map[str
 	sort.Strings(dataKeys)
 
 	for _, key := range dataKeys {
-		metainfo, ok := metadata[key].(Metadata)
+		metainfo, ok := toMetadata(metadata[key])
 
 		if !ok {
 			if i.config.Debug {
@@ -345,7 +331,7 @@ func (i *Index) buildIndexFields(id uint64, baseField string, structData map[str
 			fieldKey = baseField + "." + fieldKey
 		}
 
-		cmds, err := i.buildIndexField(id, fieldKey, value, metainfo)
+		cmds, err := i.buildIndexField(id, fieldKey, value, metainfo, inArray)
 
 		if err != nil {
 			return nil, err
@@ -359,7 +345,7 @@ func (i *Index) buildIndexFields(id uint64, baseField string, structData map[str
 	return commands, nil
 }
 
-func (i *Index) buildIndexField(id uint64, field string, value interface{}, metadata Metadata) ([]engine.Command, error) {
+func (i *Index) buildIndexField(id uint64, field string, value interface{}, metadata Metadata, inArray bool) ([]engine.Command, error) {
 	var (
 		commands  []engine.Command
 		err       error
@@ -367,6 +353,11 @@ func (i *Index) buildIndexField(id uint64, field string, value interface{}, meta
 		fieldType string
 	)
 
+	// null values are only recorded in the presence store
+	if value == nil {
+		return nil, nil
+	}
+
 	vtype := reflect.TypeOf(value)
 	fieldType = vtype.String()
 
@@ -386,7 +377,15 @@ func (i *Index) buildIndexField(id uint64, field string, value interface{}, meta
 			return nil, fmt.Errorf("Error indexing field '%s'. Value '%+v' isn't string", field, value)
 		}
 
-		commands, err = i.buildIndexString(id, field, vstr)
+		commands, err = i.buildIndexString(id, field, vstr, metadata)
+	case "keyword":
+		vstr, ok := value.(string)
+
+		if !ok {
+			return nil, fmt.Errorf("Error indexing field '%s'. Value '%+v' isn't keyword", field, value)
+		}
+
+		commands, err = i.buildIndexKeyword(id, field, vstr)
 	case "date":
 		dateStr, ok := value.(string)
 
@@ -445,6 +444,8 @@ func (i *Index) buildIndexField(id uint64, field string, value interface{}, meta
 		}
 
 		commands, err = i.buildIndexFloat64(id, field, vfloat)
+	case "geo_point", "geopoint":
+		commands, err = i.buildIndexGeoPoint(id, field, value)
 	case "slice", "list", "[]interface {}":
 		vslice, ok := value.([]interface{})
 
@@ -452,13 +453,13 @@ func (i *Index) buildIndexField(id uint64, field string, value interface{}, meta
 			return nil, fmt.Errorf("Error indexing field '%s'. Value '%+v' isn't slice", field, value)
 		}
 
-		submetadata, ok := metadata["metadata"].(Metadata)
+		submetadata, ok := toMetadata(metadata["metadata"])
 
 		if !ok {
 			submetadata = nil
 		}
 
-		commands, err = i.buildIndexSlice(id, field, vslice, submetadata)
+		commands, err = i.buildIndexSlice(id, field, vslice, submetadata, inArray)
 	case "object", "map", "map[string]interface {}":
 		vobject, ok := value.(map[string]interface{})
 
@@ -466,13 +467,13 @@ func (i *Index) buildIndexField(id uint64, field string, value interface{}, meta
 			return nil, fmt.Errorf("Error indexing field '%s'. Value '%+v' isn't object", field, value)
 		}
 
-		submetadata, ok := metadata["metadata"].(Metadata)
+		submetadata, ok := toMetadata(metadata["metadata"])
 
 		if !ok {
 			submetadata = nil
 		}
 
-		commands, err = i.buildIndexFields(id, field, vobject, submetadata)
+		commands, err = i.buildIndexFields(id, field, vobject, submetadata, inArray)
 	default:
 		errMsg := fmt.Sprintf("Unknown type %s: %s\n", fieldType, value)
 
@@ -486,21 +487,17 @@ func (i *Index) buildIndexField(id uint64, field string, value interface{}, meta
 	return commands, err
 }
 
-// TODO: Index don't take care of item order
-func (i *Index) buildIndexSlice(id uint64, field string, values []interface{}, metadata Metadata) ([]engine.Command, error) {
+// buildIndexSlice builds the commands to index each element of the array
+// `values`. The elements of the outermost array (`inArray` false) are
+// indexed with their positions too (see buildIndexPositions), then fields
+// of the same element could be matched together.
+func (i *Index) buildIndexSlice(id uint64, field string, values []interface{}, metadata Metadata, inArray bool) ([]engine.Command, error) {
 	var commands []engine.Command
 
-	storageName := field + "_slice.idx"
-
-	if i.enableBatchMode {
-		cmd, err := i.buildBatchOn(storageName)
-		if err == nil {
-			commands = append(commands, cmd)
-		}
-	}
+	outermost := !inArray
 
-	for _, value := range values {
-		cmds, err := i.buildIndexField(id, field, value, metadata)
+	for pos, value := range values {
+		cmds, err := i.buildIndexField(id, field, value, metadata, true)
 
 		if err != nil {
 			return nil, err
@@ -509,12 +506,16 @@ func (i *Index) buildIndexSlice(id uint64, field string, values []interface{}, m
 		for _, cmd := range cmds {
 			commands = append(commands, cmd)
 		}
+
+		if outermost {
+			commands = append(commands, i.buildIndexPositions(id, uint64(pos), cmds)...)
+		}
 	}
 
 	return commands, nil
 }
 
-func (i *Index) buildIndexString(id uint64, field string, value string) ([]engine.Command, error) {
+func (i *Index) buildIndexString(id uint64, field string, value string, metadata Metadata) ([]engine.Command, error) {
 	var commands []engine.Command
 
 	// default/hardcoded analyser == tokenizer
@@ -524,13 +525,6 @@ func (i *Index) buildIndexString(id uint64, field string, value string) ([]engin
 
 	storageName := field + "_string.idx"
 
-	if i.enableBatchMode {
-		cmd, err := i.buildBatchOn(storageName)
-		if err == nil {
-			commands = append(commands, cmd)
-		}
-	}
-
 	addIndexStringCommand := func(dbase string, key []byte) {
 		cmd := engine.Command{}
 		cmd.Index = i.Name
@@ -550,14 +544,18 @@ func (i *Index) buildIndexString(id uint64, field string, value string) ([]engin
 		addIndexStringCommand(storageName, []byte(t))
 	}
 
-	if len(tokens) == 1 {
-		// if there's one token, then no need for index entire string
-		return commands, nil
+	if len(tokens) > 1 {
+		// Index all string
+		addIndexStringCommand(storageName, []byte(value))
 	}
 
-	// Index all string
-	addIndexStringCommand(storageName, []byte(value))
-	return commands, nil
+	gramCommands, err := i.buildIndexGrams(id, field, tokens, metadata)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(commands, gramCommands...), nil
 }
 
 func (i *Index) buildIndexDate(id uint64, field string, value string, metadata Metadata) ([]engine.Command, error) {
@@ -605,13 +603,6 @@ func (i *Index) buildIndexCommands(field string, cmdKey []byte, cmdVal []byte, k
 
 	storageName := field + "_" + typeStr + ".idx"
 
-	if i.enableBatchMode {
-		cmd, err := i.buildBatchOn(storageName)
-		if err == nil {
-			commands = append(commands, cmd)
-		}
-	}
-
 	cmd := engine.Command{}
 	cmd.Index = i.Name
 	cmd.Database = storageName
@@ -641,7 +632,14 @@ func (i *Index) buildIndexInt64(id uint64, field string, value int64) ([]engine.
 	return i.buildIndexCommands(field, utils.Int64ToBytes(value), utils.Uint64ToBytes(id), engine.TypeInt)
 }
 
-// Close the index
-func (i *Index) Close() {
-	i.engine.Close()
+// Engine returns the engine of the stores of the index. The commands
+// executed by the engine bypass the analysis of the documents, like the
+// commands of neosearch-cli.
+func (i *Index) Engine() *engine.Engine {
+	return i.engine
+}
+
+// Close the index. The batches not committed yet are lost.
+func (i *Index) Close() error {
+	return i.engine.Close()
 }
@@ -73,6 +73,7 @@ func TestSimpleIndexWithMetadata(t *testing.T) {
 			ValueType: engine.TypeUint,
 			Command:   "mergeset",
 		},
+		existsCommand(indexName, "id", 1),
 	}
 
 	if !compareCommands(t, commands, expectedCommands) {
@@ -193,6 +194,8 @@ func TestSimpleIndexWithMetadata(t *testing.T) {
 			Value:     utils.Uint64ToBytes(2),
 			ValueType: engine.TypeUint,
 		},
+		existsCommand(indexName, "description", 2),
+		existsCommand(indexName, "title", 2),
 	}
 
 	commands, err = index.BuildAdd(2, docJSON, metadata)
@@ -291,6 +294,8 @@ func TestDateIndex(t *testing.T) {
 			ValueType: engine.TypeUint,
 			Command:   "mergeset",
 		},
+		existsCommand(indexName, "createat", 1),
+		existsCommand(indexName, "id", 1),
 	}
 
 	if !compareCommands(t, commands, expectedCommands) {
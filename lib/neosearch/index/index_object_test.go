@@ -97,6 +97,15 @@ func TestBuildAddObjectDocument(t *testing.T) {
 			ValueType: engine.TypeUint,
 			Command:   "mergeset",
 		},
+		{
+			Index:     indexName,
+			Database:  "address.latlon_float_pos.idx",
+			Key:       append(utils.Uint64ToBytes(1), utils.Float64ToBytes(-27.545198)...),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(0),
+			ValueType: engine.TypeUint,
+			Command:   "mergeset",
+		},
 		{
 			Index:     indexName,
 			Database:  "address.latlon_float.idx",
@@ -106,6 +115,15 @@ func TestBuildAddObjectDocument(t *testing.T) {
 			ValueType: engine.TypeUint,
 			Command:   "mergeset",
 		},
+		{
+			Index:     indexName,
+			Database:  "address.latlon_float_pos.idx",
+			Key:       append(utils.Uint64ToBytes(1), utils.Float64ToBytes(-48.504827)...),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(1),
+			ValueType: engine.TypeUint,
+			Command:   "mergeset",
+		},
 		{
 			Index:     indexName,
 			Database:  "address.street_string.idx",
@@ -142,6 +160,12 @@ func TestBuildAddObjectDocument(t *testing.T) {
 			ValueType: engine.TypeUint,
 			Command:   "mergeset",
 		},
+		existsCommand(indexName, "address", 1),
+		existsCommand(indexName, "address.city", 1),
+		existsCommand(indexName, "address.district", 1),
+		existsCommand(indexName, "address.latlon", 1),
+		existsCommand(indexName, "address.street", 1),
+		existsCommand(indexName, "id", 1),
 	}
 
 	if !compareCommands(t, commands, expectedCommands) {
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -76,6 +77,20 @@ func compareCommands(t *testing.T, commands, expectedCommands []engine.Command)
 	return true
 }
 
+// existsCommand returns the command recording that the document `id`
+// have a value in `field`.
+func existsCommand(indexName, field string, id uint64) engine.Command {
+	return engine.Command{
+		Index:     indexName,
+		Database:  field + "_exists.idx",
+		Command:   "set",
+		Key:       utils.Uint64ToBytes(id),
+		KeyType:   engine.TypeUint,
+		Value:     utils.BoolToBytes(true),
+		ValueType: engine.TypeBool,
+	}
+}
+
 func TestBuildAddDocument(t *testing.T) {
 	var (
 		indexName                  = "document-sample"
@@ -119,6 +134,7 @@ func TestBuildAddDocument(t *testing.T) {
 			ValueType: engine.TypeUint,
 			Command:   "mergeset",
 		},
+		existsCommand(indexName, "id", 1),
 	}
 
 	if !compareCommands(t, commands, expectedCommands) {
@@ -230,6 +246,8 @@ func TestBuildAddDocument(t *testing.T) {
 			Value:     utils.Uint64ToBytes(2),
 			ValueType: engine.TypeUint,
 		},
+		existsCommand(indexName, "description", 2),
+		existsCommand(indexName, "title", 2),
 	}
 
 	commands, err = index.BuildAdd(2, docJSON, nil)
@@ -248,217 +266,73 @@ cleanup:
 	os.RemoveAll(indexDir)
 }
 
-func TestBuildAddDocumentWithBatchMode(t *testing.T) {
+func TestIndexChanges(t *testing.T) {
 	var (
-		indexName                  = "document-sample2"
-		indexDir                   = DataDirTmp + "/" + indexName
-		commands, expectedCommands []engine.Command
-		docJSON                    = []byte(`{"id": 1}`)
-		err                        error
-		index                      *Index
+		indexName = "test-index-changes"
+		indexDir  = DataDirTmp + "/" + indexName
+		reader    *engine.ChangeReader
+		change    engine.Change
+		docKeys   []uint64
 	)
 
-	index, err = createIndex(indexName, t)
+	index, err := createIndex("test-index-no-changes", t)
 
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	index.Batch()
-	commands, err = index.BuildAdd(1, docJSON, nil)
+	if _, err = index.Changes(0); err == nil {
+		t.Error("Changes of index without change stream should fail")
+	}
 
-	if err != nil {
-		t.Error(err.Error())
-		goto cleanup
+	index.Close()
+	os.RemoveAll(DataDirTmp + "/test-index-no-changes")
+
+	if err = os.MkdirAll(indexDir, 0755); err != nil {
+		t.Error(err)
+		return
 	}
 
-	expectedCommands = []engine.Command{
-		{
-			Index:     indexName,
-			Database:  "document.db",
-			Command:   "batch",
-			Key:       nil,
-			KeyType:   engine.TypeNil,
-			Value:     nil,
-			ValueType: engine.TypeNil,
-		},
-		{
-			Index:     indexName,
-			Database:  "document.db",
-			Key:       utils.Uint64ToBytes(1),
-			KeyType:   engine.TypeUint,
-			Value:     docJSON,
-			ValueType: engine.TypeString,
-			Command:   "set",
-		},
-		{
-			Index:     indexName,
-			Database:  "id_float.idx",
-			Command:   "batch",
-			Key:       nil,
-			KeyType:   engine.TypeNil,
-			Value:     nil,
-			ValueType: engine.TypeNil,
-		},
-		{
-			Index:     indexName,
-			Database:  "id_float.idx",
-			Key:       utils.Float64ToBytes(1),
-			KeyType:   engine.TypeFloat,
-			Value:     utils.Uint64ToBytes(1),
-			ValueType: engine.TypeUint,
-			Command:   "mergeset",
-		},
+	if index, err = New(indexName, Config{DataDir: DataDirTmp, Changes: true}, false); err != nil {
+		t.Error(err)
+		return
 	}
 
-	if !compareCommands(t, commands, expectedCommands) {
+	if reader, err = index.Changes(0); err != nil {
+		t.Error(err)
 		goto cleanup
 	}
 
-	docJSON = []byte(`{
-            "title": "NeoSearch - Reverse Index",
-            "description": "Neoway Full Text Search"
-        }`)
+	for _, id := range []uint64{1, 2} {
+		if err = index.Add(id, []byte(`{"name": "neoway"}`), nil); err != nil {
+			t.Error(err)
+			goto cleanup
+		}
 
-	expectedCommands = []engine.Command{
-		// The "document.db" doesn't need a batch command,
-		// because this was already done by document '1'
-		//{
-		//	Index:   "document.db",
-		//	Command: "batch",
-		//},
-		{
-			Index:     indexName,
-			Database:  "document.db",
-			Command:   "set",
-			Key:       utils.Uint64ToBytes(2),
-			KeyType:   engine.TypeUint,
-			Value:     docJSON,
-			ValueType: engine.TypeString,
-		},
-		{
-			Index:     indexName,
-			Database:  "description_string.idx",
-			Command:   "batch",
-			Key:       nil,
-			KeyType:   engine.TypeNil,
-			Value:     nil,
-			ValueType: engine.TypeNil,
-		},
-		{
-			Index:     indexName,
-			Database:  "description_string.idx",
-			Command:   "mergeset",
-			Key:       []byte("neoway"),
-			KeyType:   engine.TypeString,
-			Value:     utils.Uint64ToBytes(2),
-			ValueType: engine.TypeUint,
-		},
-		{
-			Index:     indexName,
-			Database:  "description_string.idx",
-			Command:   "mergeset",
-			Key:       []byte("full"),
-			KeyType:   engine.TypeString,
-			Value:     utils.Uint64ToBytes(2),
-			ValueType: engine.TypeUint,
-		},
-		{
-			Index:     indexName,
-			Database:  "description_string.idx",
-			Command:   "mergeset",
-			Key:       []byte("text"),
-			KeyType:   engine.TypeString,
-			Value:     utils.Uint64ToBytes(2),
-			ValueType: engine.TypeUint,
-		},
-		{
-			Index:     indexName,
-			Database:  "description_string.idx",
-			Command:   "mergeset",
-			Key:       []byte("search"),
-			KeyType:   engine.TypeString,
-			Value:     utils.Uint64ToBytes(2),
-			ValueType: engine.TypeUint,
-		},
-		{
-			Index:     indexName,
-			Database:  "description_string.idx",
-			Command:   "mergeset",
-			Key:       []byte("neoway full text search"),
-			KeyType:   engine.TypeString,
-			Value:     utils.Uint64ToBytes(2),
-			ValueType: engine.TypeUint,
-		},
-		{
-			Index:     indexName,
-			Database:  "title_string.idx",
-			Command:   "batch",
-			Key:       nil,
-			KeyType:   engine.TypeNil,
-			Value:     nil,
-			ValueType: engine.TypeNil,
-		},
-		{
-			Index:     indexName,
-			Database:  "title_string.idx",
-			Command:   "mergeset",
-			Key:       []byte("neosearch"),
-			KeyType:   engine.TypeString,
-			Value:     utils.Uint64ToBytes(2),
-			ValueType: engine.TypeUint,
-		},
-		{
-			Index:     indexName,
-			Database:  "title_string.idx",
-			Command:   "mergeset",
-			Key:       []byte("-"),
-			KeyType:   engine.TypeString,
-			Value:     utils.Uint64ToBytes(2),
-			ValueType: engine.TypeUint,
-		},
-		{
-			Index:     indexName,
-			Database:  "title_string.idx",
-			Command:   "mergeset",
-			Key:       []byte("reverse"),
-			KeyType:   engine.TypeString,
-			Value:     utils.Uint64ToBytes(2),
-			ValueType: engine.TypeUint,
-		},
-		{
-			Index:     indexName,
-			Database:  "title_string.idx",
-			Command:   "mergeset",
-			Key:       []byte("index"),
-			KeyType:   engine.TypeString,
-			Value:     utils.Uint64ToBytes(2),
-			ValueType: engine.TypeUint,
-		},
-		{
-			Index:     indexName,
-			Database:  "title_string.idx",
-			Command:   "mergeset",
-			Key:       []byte("neosearch - reverse index"),
-			KeyType:   engine.TypeString,
-			Value:     utils.Uint64ToBytes(2),
-			ValueType: engine.TypeUint,
-		},
-	}
+		// the reader tails the stream written after it's open
+		for {
+			if change, err = reader.Next(); err != nil {
+				break
+			}
 
-	index.Batch()
-	commands, err = index.BuildAdd(2, docJSON, nil)
+			if change.Command.Database == dbName && change.Command.Command == "set" {
+				docKeys = append(docKeys, utils.BytesToUint64(change.Command.Key))
+			}
+		}
 
-	if err != nil {
-		t.Error(err)
-		goto cleanup
+		if err != io.EOF {
+			t.Error(err)
+			goto cleanup
+		}
 	}
 
-	if !compareCommands(t, commands, expectedCommands) {
-		goto cleanup
+	if !reflect.DeepEqual(docKeys, []uint64{1, 2}) {
+		t.Errorf("Unexpected documents in the change stream: %v", docKeys)
 	}
 
+	reader.Close()
+
 cleanup:
 	index.Close()
 	os.RemoveAll(indexDir)
@@ -0,0 +1,354 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/store"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"github.com/extemporalgenome/slug"
+	"golang.org/x/net/context"
+)
+
+// DefaultAggregationSize is the default number of buckets of terms
+// aggregations.
+const DefaultAggregationSize = 10
+
+// keywordLookupSize is the maximum number of documents sorted by the
+// keywords of each document. Larger sets are sorted by a walk of the
+// whole keyword store.
+const keywordLookupSize = 512
+
+// Bucket is a term of a terms aggregation and the number of documents
+// having the term.
+type Bucket struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// keywordStorage returns the name of the store with the raw values of
+// the keyword field `field`.
+func keywordStorage(field string) string {
+	return field + "_keyword.idx"
+}
+
+// buildIndexKeyword builds the command to index `value` as a single term,
+// without analysis. Keywords are case sensitive, then "ACTIVE" and
+// "active" are different terms.
+func (i *Index) buildIndexKeyword(id uint64, field string, value string) ([]engine.Command, error) {
+	var commands []engine.Command
+
+	storageName := keywordStorage(field)
+
+	commands = append(commands, engine.Command{
+		Index:     i.Name,
+		Database:  storageName,
+		Command:   "mergeset",
+		Key:       []byte(value),
+		KeyType:   engine.TypeString,
+		Value:     utils.Uint64ToBytes(id),
+		ValueType: engine.TypeUint,
+	})
+
+	return commands, nil
+}
+
+// FilterKeywordID returns the ids of documents where the keyword field
+// `field` is exactly `value`.
+func (i *Index) FilterKeywordID(field, value []byte) ([]uint64, error) {
+	return i.FilterKeywordIDContext(context.Background(), field, value)
+}
+
+// FilterKeywordIDContext is like FilterKeywordID, but fails with the
+// error of `ctx` if it's done.
+func (i *Index) FilterKeywordIDContext(ctx context.Context, field, value []byte) ([]uint64, error) {
+	return i.getPostingsContext(ctx, keywordStorage(utils.FieldNorm(string(field))), value)
+}
+
+// FilterKeyword search documents where the keyword field `field` is
+// exactly `value`. The value isn't analysed, then the match is case
+// sensitive.
+func (i *Index) FilterKeyword(field, value []byte) ([]string, error) {
+	return i.FilterKeywordContext(context.Background(), field, value)
+}
+
+// FilterKeywordContext is like FilterKeyword, but stops when `ctx` is
+// done and returns the error of `ctx`.
+func (i *Index) FilterKeywordContext(ctx context.Context, field, value []byte) ([]string, error) {
+	docIDs, err := i.FilterKeywordIDContext(ctx, field, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.getDocsContext(ctx, docIDs)
+}
+
+// walkKeywords calls `fn` with the keywords of `field` and the ids of
+// documents (only those in `docSet`, if not nil) having each one, in
+// ascending order of the keywords, or descending if `desc`. It stops
+// when `ctx` is done and returns the error of `ctx`.
+func (i *Index) walkKeywords(ctx context.Context, field []byte, docSet map[uint64]bool, desc bool, fn func(key []byte, docIDs []uint64)) error {
+	storekv, err := i.engine.AcquireStore(i.Name, keywordStorage(utils.FieldNorm(string(field))))
+
+	if err != nil {
+		return err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	var next func(it store.KVIterator)
+
+	if desc {
+		it.SeekToLast()
+		next = store.KVIterator.Prev
+	} else {
+		it.SeekToFirst()
+		next = store.KVIterator.Next
+	}
+
+	for ; it.Valid(); next(it) {
+		var docIDs []uint64
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		for _, docID := range unionPostings(nil, it.Value()) {
+			if docSet == nil || docSet[docID] {
+				docIDs = append(docIDs, docID)
+			}
+		}
+
+		if len(docIDs) > 0 {
+			fn(it.Key(), docIDs)
+		}
+	}
+
+	return it.GetError()
+}
+
+func docSet(docIDs []uint64) map[uint64]bool {
+	set := make(map[uint64]bool, len(docIDs))
+
+	for _, docID := range docIDs {
+		set[docID] = true
+	}
+
+	return set
+}
+
+// SortByKeyword sorts `docIDs` by the value of the keyword field `field`,
+// ascending or descending if `desc`. Documents with more than one
+// value are sorted by the first value in that order. Documents without
+// the field are moved to the end.
+func (i *Index) SortByKeyword(field []byte, docIDs []uint64, desc bool) error {
+	return i.SortByKeywordContext(context.Background(), field, docIDs, desc)
+}
+
+// SortByKeywordContext is like SortByKeyword, but stops when `ctx` is
+// done and returns the error of `ctx`, leaving `docIDs` unchanged.
+func (i *Index) SortByKeywordContext(ctx context.Context, field []byte, docIDs []uint64, desc bool) error {
+	if len(docIDs) <= keywordLookupSize {
+		return i.sortByKeywordLookup(ctx, field, docIDs, desc)
+	}
+
+	return i.sortByKeywordWalk(ctx, field, docIDs, desc)
+}
+
+// sortByKeywordWalk sorts `docIDs` walking the keyword store of `field`.
+func (i *Index) sortByKeywordWalk(ctx context.Context, field []byte, docIDs []uint64, desc bool) error {
+	var (
+		set    = docSet(docIDs)
+		sorted = make([]uint64, 0, len(docIDs))
+	)
+
+	err := i.walkKeywords(ctx, field, set, desc, func(key []byte, ids []uint64) {
+		for _, docID := range ids {
+			if set[docID] {
+				sorted = append(sorted, docID)
+				delete(set, docID)
+			}
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, docID := range docIDs {
+		if set[docID] {
+			sorted = append(sorted, docID)
+		}
+	}
+
+	copy(docIDs, sorted)
+	return nil
+}
+
+// sortByKeywordLookup sorts `docIDs` reading the keywords of `field` of
+// each document, in the same order of sortByKeywordWalk.
+func (i *Index) sortByKeywordLookup(ctx context.Context, field []byte, docIDs []uint64, desc bool) error {
+	var (
+		storage = keywordStorage(utils.FieldNorm(string(field)))
+		path    = strings.Split(utils.FieldNorm(string(field)), ".")
+		keyed   []keywordDoc
+		missing []uint64
+	)
+
+	for _, docID := range docIDs {
+		doc, err := i.GetContext(ctx, docID)
+
+		if err != nil {
+			return err
+		}
+
+		var (
+			data  interface{}
+			key   []byte
+			found bool
+		)
+
+		// documents that aren't JSON haven't keywords
+		json.Unmarshal(doc, &data)
+
+		for _, value := range fieldStrings(data, path, nil) {
+			if found && (bytes.Compare([]byte(value), key) > 0) != desc {
+				continue
+			}
+
+			// the value could be indexed as other type
+			ids, err := i.getPostingsContext(ctx, storage, []byte(value))
+
+			if err != nil {
+				return err
+			}
+
+			if hasPosting(ids, docID) {
+				key, found = []byte(value), true
+			}
+		}
+
+		if found {
+			keyed = append(keyed, keywordDoc{key: key, docID: docID})
+		} else {
+			missing = append(missing, docID)
+		}
+	}
+
+	sort.Sort(keywordDocs{docs: keyed, desc: desc})
+
+	for n, kd := range keyed {
+		docIDs[n] = kd.docID
+	}
+
+	copy(docIDs[len(keyed):], missing)
+	return nil
+}
+
+// fieldStrings appends to `values` the strings of the field `path` of
+// the decoded JSON `data`. Arrays are flattened, like in the indexing.
+func fieldStrings(data interface{}, path []string, values []string) []string {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, elem := range v {
+			values = fieldStrings(elem, path, values)
+		}
+	case map[string]interface{}:
+		if len(path) == 0 {
+			break
+		}
+
+		for key, elem := range v {
+			if slug.SlugAscii(key) == path[0] {
+				values = fieldStrings(elem, path[1:], values)
+			}
+		}
+	case string:
+		if len(path) == 0 {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+func hasPosting(docIDs []uint64, docID uint64) bool {
+	n := sort.Search(len(docIDs), func(n int) bool { return docIDs[n] >= docID })
+	return n < len(docIDs) && docIDs[n] == docID
+}
+
+type keywordDoc struct {
+	key   []byte
+	docID uint64
+}
+
+// keywordDocs sorts by the keyword, ascending or descending if `desc`,
+// and by the id of the documents with the same keyword.
+type keywordDocs struct {
+	docs []keywordDoc
+	desc bool
+}
+
+func (k keywordDocs) Len() int      { return len(k.docs) }
+func (k keywordDocs) Swap(a, b int) { k.docs[a], k.docs[b] = k.docs[b], k.docs[a] }
+
+func (k keywordDocs) Less(a, b int) bool {
+	cmp := bytes.Compare(k.docs[a].key, k.docs[b].key)
+
+	if cmp == 0 {
+		return k.docs[a].docID < k.docs[b].docID
+	}
+
+	return (cmp < 0) != k.desc
+}
+
+// TermsAggregation returns the `size` most frequent values of the keyword
+// field `field` among the documents `docIDs` (or every document of the
+// index, if `docIDs` is nil), with the number of documents of each one.
+func (i *Index) TermsAggregation(field []byte, docIDs []uint64, size int) ([]Bucket, error) {
+	return i.TermsAggregationContext(context.Background(), field, docIDs, size)
+}
+
+// TermsAggregationContext is like TermsAggregation, but stops when `ctx`
+// is done and returns the error of `ctx`.
+func (i *Index) TermsAggregationContext(ctx context.Context, field []byte, docIDs []uint64, size int) ([]Bucket, error) {
+	var (
+		top []Suggestion
+		set map[uint64]bool
+	)
+
+	if size <= 0 {
+		size = DefaultAggregationSize
+	}
+
+	if docIDs != nil {
+		set = docSet(docIDs)
+	}
+
+	err := i.walkKeywords(ctx, field, set, false, func(key []byte, ids []uint64) {
+		top = addSuggestion(top, Suggestion{
+			Term:  string(key),
+			Count: uint64(len(ids)),
+		}, size)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]Bucket, len(top))
+
+	for idx, s := range top {
+		buckets[idx] = Bucket{Key: s.Term, Count: s.Count}
+	}
+
+	return buckets, nil
+}
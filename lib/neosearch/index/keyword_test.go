@@ -0,0 +1,153 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestKeyword(t *testing.T) {
+	var (
+		indexName = "test-keyword"
+		indexDir  = DataDirTmp + "/" + indexName
+		docIDs    []uint64
+		buckets   []Bucket
+		metadata  = Metadata{
+			"cnpj":   Metadata{"type": "keyword"},
+			"status": Metadata{"type": "keyword"},
+			"tags": Metadata{
+				"type":     "slice",
+				"metadata": Metadata{"type": "keyword"},
+			},
+		}
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"cnpj": "05.340.639/0001-30", "status": "ACTIVE", "tags": ["B2B", "data"]}`,
+		`{"cnpj": "00.000.000/0001-91", "status": "INACTIVE", "tags": ["bank"]}`,
+		`{"cnpj": "33.000.167/0001-01", "status": "ACTIVE", "tags": ["B2B", "oil"]}`,
+		`{"cnpj": "60.701.190/0001-04", "status": "active"}`,
+		`{"name": "no keywords"}`,
+	} {
+		err = index.Add(uint64(id+1), []byte(doc), metadata)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	if err = index.Add(100, []byte(`{"status": 10}`), metadata); err == nil {
+		t.Error("Non-string keyword should fail")
+	}
+
+	for _, table := range []struct {
+		field, value string
+		expected     []uint64
+	}{
+		{"cnpj", "00.000.000/0001-91", []uint64{2}},
+		{"cnpj", "00.000.000", nil},
+		{"status", "ACTIVE", []uint64{1, 3}},
+		{"status", "active", []uint64{4}},
+		{"tags", "B2B", []uint64{1, 3}},
+		{"tags", "b2b", nil},
+	} {
+		docIDs, err = index.FilterKeywordID([]byte(table.field), []byte(table.value))
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if !reflect.DeepEqual(docIDs, table.expected) {
+			t.Errorf("Keyword '%s' in '%s' returned %v != %v", table.value, table.field, docIDs, table.expected)
+		}
+	}
+
+	// keywords aren't analysed, then there's no string terms
+	docIDs, _, err = index.FilterTermID([]byte("status"), []byte("active"), 0)
+
+	if err != nil || len(docIDs) != 0 {
+		t.Errorf("Keyword indexed as string: %v (%v)", docIDs, err)
+	}
+
+	docIDs = []uint64{1, 2, 3, 4, 5}
+
+	if err = index.SortByKeyword([]byte("cnpj"), docIDs, true); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(docIDs, []uint64{4, 3, 1, 2, 5}) {
+		t.Errorf("Invalid descending sort: %v", docIDs)
+	}
+
+	docIDs = []uint64{1, 2, 3, 4, 5}
+
+	if err = index.SortByKeyword([]byte("status"), docIDs, false); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(docIDs, []uint64{1, 3, 2, 4, 5}) {
+		t.Errorf("Invalid ascending sort: %v", docIDs)
+	}
+
+	// small sets read the keywords of each document, but are sorted as
+	// the walk of the keyword store
+	for _, field := range []string{"cnpj", "status", "tags", "name"} {
+		for _, desc := range []bool{false, true} {
+			walked := []uint64{5, 4, 3, 2, 1}
+			looked := []uint64{5, 4, 3, 2, 1}
+
+			if err = index.sortByKeywordWalk(context.Background(), []byte(field), walked, desc); err != nil {
+				t.Error(err)
+				goto cleanup
+			}
+
+			if err = index.sortByKeywordLookup(context.Background(), []byte(field), looked, desc); err != nil {
+				t.Error(err)
+				goto cleanup
+			}
+
+			if !reflect.DeepEqual(walked, looked) {
+				t.Errorf("Sort of '%s' (desc %v) by lookup %v != %v", field, desc, looked, walked)
+			}
+		}
+	}
+
+	buckets, err = index.TermsAggregation([]byte("tags"), nil, 0)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(buckets, []Bucket{{"B2B", 2}, {"bank", 1}, {"data", 1}, {"oil", 1}}) {
+		t.Errorf("Unexpected buckets: %+v", buckets)
+	}
+
+	buckets, err = index.TermsAggregation([]byte("status"), []uint64{2, 3, 4}, 2)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(buckets, []Bucket{{"ACTIVE", 1}, {"INACTIVE", 1}}) {
+		t.Errorf("Unexpected buckets: %+v", buckets)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
@@ -1,3 +1,63 @@
 package index
 
+import "fmt"
+
 type Metadata map[string]interface{}
+
+// toMetadata converts the metadata entry `value` to Metadata. Metadata
+// decoded from JSON have nested entries of type map[string]interface{}.
+func toMetadata(value interface{}) (Metadata, bool) {
+	switch v := value.(type) {
+	case Metadata:
+		return v, true
+	case map[string]interface{}:
+		return Metadata(v), true
+	}
+
+	return nil, false
+}
+
+// Int returns the integer option `key` or `def` if the option isn't set.
+func (m Metadata) Int(key string, def int) (int, error) {
+	switch v := m[key].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return v, nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+
+	return 0, fmt.Errorf("Invalid metadata. Field '%s' must be an integer: %+v", key, m[key])
+}
+
+// Strings returns the list of strings option `key`. A single string is
+// accepted as a list with one element.
+func (m Metadata) Strings(key string) ([]string, error) {
+	switch v := m[key].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		values := make([]string, len(v))
+
+		for idx, value := range v {
+			str, ok := value.(string)
+
+			if !ok {
+				return nil, fmt.Errorf("Invalid metadata. Field '%s' must be a list of strings: %+v", key, v)
+			}
+
+			values[idx] = str
+		}
+
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("Invalid metadata. Field '%s' must be a list of strings: %+v", key, m[key])
+}
@@ -0,0 +1,441 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultMinGram is the default minimum length of n-grams
+	DefaultMinGram = 2
+
+	// DefaultMaxGram is the default maximum length of n-grams
+	DefaultMaxGram = 3
+
+	// DefaultEdgeMaxGram is the default maximum length of edge n-grams
+	DefaultEdgeMaxGram = 10
+
+	ngramFilter     = "ngram"
+	edgeNgramFilter = "edge_ngram"
+
+	// gramsDB stores the configurations of the n-gram filters, keyed
+	// by the name of the n-gram store. They are kept out of the n-gram
+	// stores, then these only have grams.
+	gramsDB = "_grams.db"
+)
+
+// gramConfig is the configuration of the n-gram token filters.
+// The filters are selected in the field metadata, like below:
+//
+//	{"name": {"type": "string", "filters": ["ngram"], "minGram": 2, "maxGram": 3}}
+//
+// The edge_ngram filter accepts the option "side" with values "front"
+// (default) or "back", to generate prefixes or suffixes of the tokens.
+type gramConfig struct {
+	Min  int    `json:"min"`
+	Max  int    `json:"max"`
+	Side string `json:"side,omitempty"`
+}
+
+func ngramStorage(field string) string {
+	return field + "_ngram.idx"
+}
+
+func edgeNgramStorage(field string) string {
+	return field + "_edgengram.idx"
+}
+
+// grams returns the unique grams of `token` for this configuration.
+func (cfg *gramConfig) grams(token string) []string {
+	var grams []string
+
+	runes := []rune(token)
+
+	for n := cfg.Min; n <= cfg.Max && n <= len(runes); n++ {
+		if cfg.Side == "" {
+			for start := 0; start+n <= len(runes); start++ {
+				grams = append(grams, string(runes[start:start+n]))
+			}
+		} else if cfg.Side == "back" {
+			grams = append(grams, string(runes[len(runes)-n:]))
+		} else {
+			grams = append(grams, string(runes[:n]))
+		}
+	}
+
+	return grams
+}
+
+// gramFilters returns the n-gram filters enabled in the field metadata.
+func gramFilters(metadata Metadata) (map[string]*gramConfig, error) {
+	filters, err := metadata.Strings("filters")
+
+	if err != nil || len(filters) == 0 {
+		return nil, err
+	}
+
+	configs := make(map[string]*gramConfig)
+
+	for _, filter := range filters {
+		var (
+			cfg    = &gramConfig{}
+			defMax = DefaultMaxGram
+		)
+
+		switch filter {
+		case ngramFilter:
+		case edgeNgramFilter:
+			defMax = DefaultEdgeMaxGram
+			cfg.Side = "front"
+
+			if side, ok := metadata["side"].(string); ok {
+				cfg.Side = side
+			}
+
+			if cfg.Side != "front" && cfg.Side != "back" {
+				return nil, fmt.Errorf("Invalid edge_ngram side: %s", cfg.Side)
+			}
+		default:
+			return nil, fmt.Errorf("Unknown token filter: %s", filter)
+		}
+
+		if cfg.Min, err = metadata.Int("minGram", DefaultMinGram); err != nil {
+			return nil, err
+		}
+
+		if cfg.Max, err = metadata.Int("maxGram", defMax); err != nil {
+			return nil, err
+		}
+
+		if cfg.Min < 1 || cfg.Max < cfg.Min {
+			return nil, fmt.Errorf("Invalid gram length: minGram = %d, maxGram = %d", cfg.Min, cfg.Max)
+		}
+
+		configs[filter] = cfg
+	}
+
+	return configs, nil
+}
+
+// buildIndexGrams builds the commands to index the n-grams of `tokens` in
+// the stores of the filters enabled for `field`. The grams are written in
+// separated stores, then the term store isn't affected. The configuration
+// of the filters is written only by the first document, and indexing with
+// other configuration fails (see gramConfigChanged).
+func (i *Index) buildIndexGrams(id uint64, field string, tokens []string, metadata Metadata) ([]engine.Command, error) {
+	var commands []engine.Command
+
+	filters, err := gramFilters(metadata)
+
+	if err != nil || filters == nil {
+		return nil, err
+	}
+
+	for _, filter := range []string{edgeNgramFilter, ngramFilter} {
+		cfg, ok := filters[filter]
+
+		if !ok {
+			continue
+		}
+
+		storageName := ngramStorage(field)
+
+		if filter == edgeNgramFilter {
+			storageName = edgeNgramStorage(field)
+		}
+
+		changed, err := i.gramConfigChanged(storageName, cfg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if changed {
+			cfgJSON, err := json.Marshal(cfg)
+
+			if err != nil {
+				return nil, err
+			}
+
+			commands = append(commands, engine.Command{
+				Index:     i.Name,
+				Database:  gramsDB,
+				Command:   "set",
+				Key:       []byte(storageName),
+				KeyType:   engine.TypeString,
+				Value:     cfgJSON,
+				ValueType: engine.TypeString,
+			})
+		}
+
+		unique := make(map[string]bool)
+
+		for _, token := range tokens {
+			for _, gram := range cfg.grams(token) {
+				unique[gram] = true
+			}
+		}
+
+		grams := make([]string, 0, len(unique))
+
+		for gram := range unique {
+			grams = append(grams, gram)
+		}
+
+		sort.Strings(grams)
+
+		for _, gram := range grams {
+			commands = append(commands, engine.Command{
+				Index:     i.Name,
+				Database:  storageName,
+				Command:   "mergeset",
+				Key:       []byte(gram),
+				KeyType:   engine.TypeString,
+				Value:     utils.Uint64ToBytes(id),
+				ValueType: engine.TypeUint,
+			})
+		}
+	}
+
+	return commands, nil
+}
+
+// gramConfigError is the error of indexing a field with a n-gram
+// configuration different of the one its store was built with. The
+// grams of the documents indexed before would be missed by the queries,
+// then the store must be rebuilt (see Fsck).
+type gramConfigError struct {
+	storage string
+	stored  gramConfig
+	cfg     gramConfig
+}
+
+func (e *gramConfigError) Error() string {
+	return fmt.Sprintf("N-gram configuration of '%s' changed from %+v to %+v. Rebuild the store with Fsck repair",
+		e.storage, e.stored, e.cfg)
+}
+
+// gramConfigChanged returns true if there's no configuration stored for
+// the n-gram store `storage`, or a *gramConfigError if the stored one
+// isn't `cfg`. The configurations stored are cached, then the store is
+// read only until the configuration is committed.
+func (i *Index) gramConfigChanged(storage string, cfg *gramConfig) (bool, error) {
+	i.gramMutex.Lock()
+	defer i.gramMutex.Unlock()
+
+	if stored, ok := i.gramConfigs[storage]; ok && stored == *cfg {
+		return false, nil
+	}
+
+	stored, err := i.getGramConfig(storage)
+
+	if err != nil {
+		return false, err
+	}
+
+	if stored == nil {
+		return true, nil
+	}
+
+	if *stored != *cfg {
+		return false, &gramConfigError{storage: storage, stored: *stored, cfg: *cfg}
+	}
+
+	if i.gramConfigs == nil {
+		i.gramConfigs = make(map[string]gramConfig)
+	}
+
+	i.gramConfigs[storage] = *stored
+	return false, nil
+}
+
+// getGramConfig returns the configuration of the n-gram store `storage`
+// or nil if the field wasn't indexed with the filter.
+func (i *Index) getGramConfig(storage string) (*gramConfig, error) {
+	data, err := i.engine.Execute(engine.Command{
+		Index:    i.Name,
+		Database: gramsDB,
+		Command:  "get",
+		Key:      []byte(storage),
+		KeyType:  engine.TypeString,
+	})
+
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	cfg := &gramConfig{}
+
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// gramCandidates returns the ids of documents that *could* have a token
+// containing `token`.
+func (i *Index) gramCandidates(ctx context.Context, field, storage string, cfg *gramConfig, token string) ([]uint64, error) {
+	runes := []rune(token)
+
+	if len(runes) < cfg.Min {
+		// there's no gram this short, then scan the term dictionary
+		return i.matchTermsContext(ctx, stringStorage([]byte(field)), nil, func(term []byte) bool {
+			return strings.Contains(string(term), token)
+		}, i.maxTermExpansion())
+	}
+
+	if len(runes) <= cfg.Max {
+		return i.getPostingsContext(ctx, storage, []byte(token))
+	}
+
+	if cfg.Side == "front" {
+		return i.getPostingsContext(ctx, storage, []byte(string(runes[:cfg.Max])))
+	} else if cfg.Side == "back" {
+		return i.getPostingsContext(ctx, storage, []byte(string(runes[len(runes)-cfg.Max:])))
+	}
+
+	var docIDs []uint64
+
+	for start := 0; start+cfg.Max <= len(runes); start++ {
+		ids, err := i.getPostingsContext(ctx, storage, []byte(string(runes[start:start+cfg.Max])))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if start == 0 {
+			docIDs = ids
+		} else {
+			docIDs = intersectPostings(docIDs, ids)
+		}
+
+		if len(docIDs) == 0 {
+			break
+		}
+	}
+
+	return docIDs, nil
+}
+
+// verifyContains filters out the documents whose field `field` doesn't
+// contains `value`.
+func (i *Index) verifyContains(ctx context.Context, docIDs []uint64, field, value string) ([]uint64, error) {
+	var result []uint64
+
+	for _, docID := range docIDs {
+		data, err := i.GetContext(ctx, docID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		doc := map[string]interface{}{}
+
+		if err = json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+
+		for _, fieldValue := range lookupField(doc, field) {
+			str, ok := fieldValue.(string)
+
+			if ok && strings.Contains(strings.ToLower(str), value) {
+				result = append(result, docID)
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// ContainsID returns the ids of documents where field `field` contains
+// the substring `value`. See Contains.
+func (i *Index) ContainsID(field []byte, value []byte) ([]uint64, error) {
+	return i.ContainsIDContext(context.Background(), field, value)
+}
+
+// ContainsIDContext is like ContainsID, but stops when `ctx` is done and
+// returns the error of `ctx`.
+func (i *Index) ContainsIDContext(ctx context.Context, field []byte, value []byte) ([]uint64, error) {
+	var (
+		docIDs  []uint64
+		storage string
+	)
+
+	fieldName := utils.FieldNorm(string(field))
+	query := strings.ToLower(strings.Trim(string(value), " "))
+
+	if query == "" {
+		return nil, errors.New("Empty $contains value")
+	}
+
+	storage = ngramStorage(fieldName)
+	cfg, err := i.getGramConfig(storage)
+
+	if err == nil && cfg == nil {
+		storage = edgeNgramStorage(fieldName)
+		cfg, err = i.getGramConfig(storage)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg == nil {
+		return nil, fmt.Errorf("Field '%s' isn't indexed with ngram or edge_ngram filters", fieldName)
+	}
+
+	for idx, token := range strings.Split(query, " ") {
+		if token == "" {
+			continue
+		}
+
+		ids, err := i.gramCandidates(ctx, fieldName, storage, cfg, token)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if idx == 0 {
+			docIDs = ids
+		} else {
+			docIDs = intersectPostings(docIDs, ids)
+		}
+
+		if len(docIDs) == 0 {
+			return nil, nil
+		}
+	}
+
+	return i.verifyContains(ctx, docIDs, fieldName, query)
+}
+
+// Contains search documents where field `field` contains the substring
+// `value`, like "way" inside "Neoway". The field must be indexed with
+// the "ngram" filter (or "edge_ngram", but then only the start or the
+// end of the tokens are matched). The candidates found in the n-gram
+// store are verified against the stored document to remove false
+// positives.
+func (i *Index) Contains(field []byte, value []byte) ([]string, error) {
+	return i.ContainsContext(context.Background(), field, value)
+}
+
+// ContainsContext is like Contains, but stops when `ctx` is done and
+// returns the error of `ctx`.
+func (i *Index) ContainsContext(ctx context.Context, field []byte, value []byte) ([]string, error) {
+	docIDs, err := i.ContainsIDContext(ctx, field, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.getDocsContext(ctx, docIDs)
+}
@@ -0,0 +1,264 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+)
+
+func TestGrams(t *testing.T) {
+	for _, table := range []struct {
+		cfg      gramConfig
+		token    string
+		expected []string
+	}{
+		{
+			cfg:      gramConfig{Min: 2, Max: 3},
+			token:    "neoway",
+			expected: []string{"ne", "eo", "ow", "wa", "ay", "neo", "eow", "owa", "way"},
+		},
+		{
+			cfg:      gramConfig{Min: 2, Max: 3},
+			token:    "a",
+			expected: nil,
+		},
+		{
+			cfg:      gramConfig{Min: 1, Max: 4, Side: "front"},
+			token:    "neoway",
+			expected: []string{"n", "ne", "neo", "neow"},
+		},
+		{
+			cfg:      gramConfig{Min: 2, Max: 10, Side: "back"},
+			token:    "neoway",
+			expected: []string{"ay", "way", "oway", "eoway", "neoway"},
+		},
+		{
+			cfg:      gramConfig{Min: 2, Max: 2},
+			token:    "são",
+			expected: []string{"sã", "ão"},
+		},
+	} {
+		grams := table.cfg.grams(table.token)
+
+		if !reflect.DeepEqual(grams, table.expected) {
+			t.Errorf("Grams of '%s' differs: %v != %v", table.token, grams, table.expected)
+		}
+	}
+}
+
+func TestGramFilters(t *testing.T) {
+	filters, err := gramFilters(Metadata{
+		"type":    "string",
+		"filters": []interface{}{"ngram", "edge_ngram"},
+		"minGram": float64(1),
+		"side":    "back",
+	})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(filters, map[string]*gramConfig{
+		"ngram":      {Min: 1, Max: DefaultMaxGram},
+		"edge_ngram": {Min: 1, Max: DefaultEdgeMaxGram, Side: "back"},
+	}) {
+		t.Errorf("Unexpected filters: %+v", filters)
+	}
+
+	for _, metadata := range []Metadata{
+		{"filters": []interface{}{"soundex"}},
+		{"filters": "ngram", "minGram": 3, "maxGram": 2},
+		{"filters": "ngram", "minGram": "two"},
+		{"filters": "edge_ngram", "side": "middle"},
+	} {
+		if _, err := gramFilters(metadata); err == nil {
+			t.Errorf("Metadata should fail: %+v", metadata)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	var (
+		indexName = "test-contains"
+		indexDir  = DataDirTmp + "/" + indexName
+		docIDs    []uint64
+		docs      []string
+		metadata  = Metadata{
+			"name": map[string]interface{}{
+				"type":    "string",
+				"filters": []interface{}{"ngram"},
+			},
+			"city": Metadata{
+				"type":    "string",
+				"filters": "edge_ngram",
+				"side":    "back",
+			},
+		}
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "Neoway Business Solution", "city": "Florianópolis"}`,
+		`{"name": "Google Inc.", "city": "Mountain View"}`,
+		`{"name": "Facebook Company", "city": "Menlo Park"}`,
+		`{"name": "Wayne Enterprises", "city": "Gotham City"}`,
+		`{"name": "Broadway Theater", "city": "New York City"}`,
+	} {
+		err = index.Add(uint64(id+1), []byte(doc), metadata)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	// normal term queries are unaffected by the grams
+	docIDs, _, err = index.FilterTermID([]byte("name"), []byte("way"), 0)
+
+	if err != nil || len(docIDs) != 0 {
+		t.Errorf("Term query affected by n-grams: %v (%v)", docIDs, err)
+	}
+
+	for _, table := range []struct {
+		field, value string
+		expected     []uint64
+	}{
+		{"name", "way", []uint64{1, 4, 5}},
+		{"name", "Neoway", []uint64{1}},
+		{"name", "oogle", []uint64{2}},
+		{"name", "siness sol", []uint64{1}},
+		{"name", "book com", []uint64{3}},
+		{"name", "y", []uint64{1, 3, 4, 5}},
+		{"name", "busyness", nil},
+		{"city", "city", []uint64{4, 5}},
+		{"city", "polis", []uint64{1}},
+		{"city", "york city", []uint64{5}},
+	} {
+		docIDs, err = index.ContainsID([]byte(table.field), []byte(table.value))
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if !reflect.DeepEqual(docIDs, table.expected) {
+			t.Errorf("Contains '%s' in '%s' returned %v != %v", table.value, table.field, docIDs, table.expected)
+		}
+	}
+
+	docs, err = index.Contains([]byte("name"), []byte("ebo"))
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if len(docs) != 1 || docs[0] != `{"name": "Facebook Company", "city": "Menlo Park"}` {
+		t.Errorf("Failed to retrieve documents: %v", docs)
+	}
+
+	if _, err = index.ContainsID([]byte("nonexistent"), []byte("abc")); err == nil {
+		t.Error("$contains on field without n-grams should fail")
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestGramConfigWrites(t *testing.T) {
+	var (
+		indexName = "test-gram-config"
+		indexDir  = DataDirTmp + "/" + indexName
+		commands  []engine.Command
+		cfg       *gramConfig
+		metadata  = Metadata{
+			"name": Metadata{
+				"type":    "string",
+				"filters": "ngram",
+			},
+		}
+	)
+
+	configWrites := func(commands []engine.Command) int {
+		writes := 0
+
+		for _, cmd := range commands {
+			if cmd.Database == gramsDB {
+				writes++
+			}
+		}
+
+		return writes
+	}
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = index.Add(1, []byte(`{"name": "neoway"}`), metadata); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	// the configuration is written once, out of the n-gram store
+	if commands, err = index.BuildAdd(2, []byte(`{"name": "neosearch"}`), metadata); err != nil || configWrites(commands) != 0 {
+		t.Errorf("Unchanged configuration written again: %v (%v)", commands, err)
+	}
+
+	if cfg, err = index.getGramConfig(ngramStorage("name")); err != nil || cfg == nil || *cfg != (gramConfig{Min: DefaultMinGram, Max: DefaultMaxGram}) {
+		t.Errorf("Unexpected configuration: %+v (%v)", cfg, err)
+	}
+
+	if err = verifyPostingStore(index, ngramStorage("name")); err != nil {
+		t.Error(err)
+	}
+
+	// the stored configuration isn't overwritten (see TestFsckGramsChanged)
+	metadata["name"].(Metadata)["maxGram"] = 4
+
+	if commands, err = index.BuildAdd(2, []byte(`{"name": "neosearch"}`), metadata); err == nil {
+		t.Errorf("Changed configuration written: %v", commands)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+// verifyPostingStore returns an error if a value of `storage` isn't a
+// posting list.
+func verifyPostingStore(index *Index, storage string) error {
+	storekv, err := index.engine.AcquireStore(index.Name, storage)
+
+	if err != nil {
+		return err
+	}
+
+	defer index.engine.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if len(it.Value())%8 != 0 {
+			return fmt.Errorf("Key %q of %s isn't a posting list", it.Key(), storage)
+		}
+	}
+
+	return it.GetError()
+}
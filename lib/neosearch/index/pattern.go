@@ -0,0 +1,154 @@
+package index
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultMaxTermExpansion is the default maximum number of terms that a
+// wildcard or regex query can expand to. This value can be override by
+// Config.MaxTermExpansion.
+const DefaultMaxTermExpansion = 1024
+
+// TermVisitFactor bounds the number of terms that a wildcard or regex
+// query can visit to TermVisitFactor times the maximum term expansion.
+// Patterns without a literal prefix (eg.: "*inc") walk the term
+// dictionary from the start, then they fail on large dictionaries even
+// if few terms match.
+const TermVisitFactor = 64
+
+// compileWildcard converts a wildcard pattern into an anchored regular
+// expression. The wildcard '*' matches any sequence of characters, '?'
+// matches exactly one character and '\' escapes the next character.
+func compileWildcard(pattern string) (*regexp.Regexp, error) {
+	var (
+		expr    = []string{"(?s)^"}
+		escaped bool
+	)
+
+	for _, r := range pattern {
+		if escaped {
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+			escaped = false
+			continue
+		}
+
+		switch r {
+		case '\\':
+			escaped = true
+		case '*':
+			expr = append(expr, ".*")
+		case '?':
+			expr = append(expr, ".")
+		default:
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	if escaped {
+		expr = append(expr, regexp.QuoteMeta("\\"))
+	}
+
+	expr = append(expr, "$")
+	return regexp.Compile(strings.Join(expr, ""))
+}
+
+// compileRegex compiles the RE2 expression `expr` anchored to match the
+// entire term.
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + expr + `)$`)
+}
+
+func (i *Index) maxTermExpansion() int {
+	if i.config.MaxTermExpansion > 0 {
+		return i.config.MaxTermExpansion
+	}
+
+	return DefaultMaxTermExpansion
+}
+
+// matchRegexp returns the union of postings of every term of `field`
+// matching the anchored expression `rxp`. The literal prefix of `rxp`
+// bounds the range of the term dictionary visited.
+func (i *Index) matchRegexp(ctx context.Context, field []byte, rxp *regexp.Regexp) ([]uint64, error) {
+	prefix, _ := rxp.LiteralPrefix()
+	return i.matchTermsContext(ctx, stringStorage(field), []byte(prefix), rxp.Match, i.maxTermExpansion())
+}
+
+// MatchWildcardID returns the ids of documents where some term of field
+// `field` matches the wildcard `pattern`. See MatchWildcard.
+func (i *Index) MatchWildcardID(field []byte, pattern []byte) ([]uint64, error) {
+	return i.MatchWildcardIDContext(context.Background(), field, pattern)
+}
+
+// MatchWildcardIDContext is like MatchWildcardID, but stops walking the
+// terms when `ctx` is done and returns the error of `ctx`.
+func (i *Index) MatchWildcardIDContext(ctx context.Context, field []byte, pattern []byte) ([]uint64, error) {
+	rxp, err := compileWildcard(string(pattern))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.matchRegexp(ctx, field, rxp)
+}
+
+// MatchWildcard search documents where some term of field `field` matches
+// the wildcard `pattern`. The wildcard '*' matches any sequence of
+// characters and '?' matches a single character. The characters before
+// the first wildcard are used to bound the term dictionary scan, then
+// patterns starting with a wildcard are expensive.
+func (i *Index) MatchWildcard(field []byte, pattern []byte) ([]string, error) {
+	return i.MatchWildcardContext(context.Background(), field, pattern)
+}
+
+// MatchWildcardContext is like MatchWildcard, but stops when `ctx` is done and
+// returns the error of `ctx`.
+func (i *Index) MatchWildcardContext(ctx context.Context, field []byte, pattern []byte) ([]string, error) {
+	docIDs, err := i.MatchWildcardIDContext(ctx, field, pattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.getDocsContext(ctx, docIDs)
+}
+
+// MatchRegexID returns the ids of documents where some term of field
+// `field` matches the regular expression `expr`. See MatchRegex.
+func (i *Index) MatchRegexID(field []byte, expr []byte) ([]uint64, error) {
+	return i.MatchRegexIDContext(context.Background(), field, expr)
+}
+
+// MatchRegexIDContext is like MatchRegexID, but stops walking the terms
+// when `ctx` is done and returns the error of `ctx`.
+func (i *Index) MatchRegexIDContext(ctx context.Context, field []byte, expr []byte) ([]uint64, error) {
+	rxp, err := compileRegex(string(expr))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.matchRegexp(ctx, field, rxp)
+}
+
+// MatchRegex search documents where some term of field `field` matches
+// the RE2 regular expression `expr`. The expression must match the entire
+// term.
+func (i *Index) MatchRegex(field []byte, expr []byte) ([]string, error) {
+	return i.MatchRegexContext(context.Background(), field, expr)
+}
+
+// MatchRegexContext is like MatchRegex, but stops when `ctx` is done and
+// returns the error of `ctx`.
+func (i *Index) MatchRegexContext(ctx context.Context, field []byte, expr []byte) ([]string, error) {
+	docIDs, err := i.MatchRegexIDContext(ctx, field, expr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.getDocsContext(ctx, docIDs)
+}
@@ -0,0 +1,188 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCompileWildcard(t *testing.T) {
+	for _, table := range []struct {
+		pattern string
+		match   []string
+		noMatch []string
+		prefix  string
+	}{
+		{
+			pattern: "neo*",
+			match:   []string{"neo", "neoway", "neosearch"},
+			noMatch: []string{"ne", "aneoway"},
+			prefix:  "neo",
+		},
+		{
+			pattern: "ne?way",
+			match:   []string{"neoway", "neXway"},
+			noMatch: []string{"neway", "neooway"},
+			prefix:  "ne",
+		},
+		{
+			pattern: "*way",
+			match:   []string{"way", "neoway"},
+			noMatch: []string{"ways"},
+			prefix:  "",
+		},
+		{
+			pattern: `a.b\*`,
+			match:   []string{"a.b*"},
+			noMatch: []string{"axb*", "a.bc"},
+			prefix:  "a.b*",
+		},
+	} {
+		rxp, err := compileWildcard(table.pattern)
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		for _, term := range table.match {
+			if !rxp.MatchString(term) {
+				t.Errorf("Wildcard '%s' should match '%s'", table.pattern, term)
+			}
+		}
+
+		for _, term := range table.noMatch {
+			if rxp.MatchString(term) {
+				t.Errorf("Wildcard '%s' shouldn't match '%s'", table.pattern, term)
+			}
+		}
+
+		if prefix, _ := rxp.LiteralPrefix(); prefix != table.prefix {
+			t.Errorf("Wildcard '%s' prefix differs: '%s' != '%s'", table.pattern, prefix, table.prefix)
+		}
+	}
+}
+
+func TestMatchWildcardAndRegex(t *testing.T) {
+	var (
+		indexName = "test-match-pattern"
+		indexDir  = DataDirTmp + "/" + indexName
+		docIDs    []uint64
+		docs      []string
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "Neoway Business Solution"}`,
+		`{"name": "Google Inc."}`,
+		`{"name": "Facebook Company"}`,
+		`{"name": "Neoway Teste"}`,
+		`{"name": "Neosearch"}`,
+	} {
+		err = index.Add(uint64(id+1), []byte(doc), nil)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	for _, table := range []struct {
+		pattern  string
+		expected []uint64
+	}{
+		{"neo*", []uint64{1, 4, 5}},
+		{"neo?ay", []uint64{1, 4}},
+		{"*com*", []uint64{3}},
+		{"inc?", []uint64{2}},
+		{"nothing*", nil},
+	} {
+		docIDs, err = index.MatchWildcardID([]byte("name"), []byte(table.pattern))
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if !reflect.DeepEqual(docIDs, table.expected) {
+			t.Errorf("Wildcard '%s' returned %v != %v", table.pattern, docIDs, table.expected)
+		}
+	}
+
+	for _, table := range []struct {
+		expr     string
+		expected []uint64
+	}{
+		{"neo(way|search)", []uint64{1, 4, 5}},
+		{"[fg].*", []uint64{2, 3}},
+		{"te.te", []uint64{4}},
+		{"neo", nil},
+	} {
+		docIDs, err = index.MatchRegexID([]byte("name"), []byte(table.expr))
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if !reflect.DeepEqual(docIDs, table.expected) {
+			t.Errorf("Regex '%s' returned %v != %v", table.expr, docIDs, table.expected)
+		}
+	}
+
+	if _, err = index.MatchRegexID([]byte("name"), []byte("neo(")); err == nil {
+		t.Error("Invalid regex should fail")
+	}
+
+	docs, err = index.MatchWildcard([]byte("name"), []byte("goo*"))
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if len(docs) != 1 || docs[0] != `{"name": "Google Inc."}` {
+		t.Errorf("Failed to retrieve documents: %v", docs)
+	}
+
+	index.config.MaxTermExpansion = 2
+
+	if _, err = index.MatchRegexID([]byte("name"), []byte(".*")); err == nil {
+		t.Error("Term expansion limit not respected")
+	}
+
+	if _, err = index.MatchWildcardID([]byte("name"), []byte("neos*")); err != nil {
+		t.Error(err)
+	}
+
+	// "*earch" matches one term, but visits the whole dictionary
+	index.config.MaxTermExpansion = 1
+
+	if _, err = index.MatchWildcardID([]byte("name"), []byte("*earch")); err != nil {
+		t.Error(err)
+	}
+
+	for k := 0; k < TermVisitFactor; k++ {
+		err = index.Add(uint64(100+k), []byte(fmt.Sprintf(`{"name": "company %d"}`, k)), nil)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	if _, err = index.MatchWildcardID([]byte("name"), []byte("*earch")); err == nil {
+		t.Error("Term visit limit not respected")
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
@@ -0,0 +1,214 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"golang.org/x/net/context"
+)
+
+// Operators of element conditions
+const (
+	ElemTerm    = "term"
+	ElemKeyword = "keyword"
+	ElemPrefix  = "prefix"
+)
+
+// ElemCondition is a condition on a field of the elements of an array,
+// see ElemMatchID.
+type ElemCondition struct {
+	// Field is the full path of the field, like "contacts.type"
+	Field string
+
+	// Op is one of ElemTerm, ElemKeyword or ElemPrefix
+	Op    string
+	Value []byte
+}
+
+// termStorageSuffixes are the suffixes of the stores where the keys are
+// the indexed values and the values the posting lists.
+var termStorageSuffixes = []string{
+	"_string.idx",
+	"_keyword.idx",
+	"_uint.idx",
+	"_int.idx",
+	"_float.idx",
+	"_bool.idx",
+}
+
+// positionStorage returns the name of the store with the positions of
+// the values indexed in the term store `storage`. The keys of the store
+// are the document id followed by the indexed value and the values the
+// positions of the array elements having the value.
+func positionStorage(storage string) string {
+	return strings.TrimSuffix(storage, ".idx") + "_pos.idx"
+}
+
+func isTermStorage(storage string) bool {
+	for _, suffix := range termStorageSuffixes {
+		if strings.HasSuffix(storage, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// buildIndexPositions builds the commands to record that the values
+// indexed by `cmds` are in the element `pos` of an array. Nested arrays
+// record the position of the outermost one.
+func (i *Index) buildIndexPositions(id uint64, pos uint64, cmds []engine.Command) []engine.Command {
+	var commands []engine.Command
+
+	docKey := utils.Uint64ToBytes(id)
+
+	for _, cmd := range cmds {
+		if cmd.Command != "mergeset" || !isTermStorage(cmd.Database) ||
+			!bytes.Equal(cmd.Value, docKey) {
+			continue
+		}
+
+		storageName := positionStorage(cmd.Database)
+
+		commands = append(commands, engine.Command{
+			Index:     i.Name,
+			Database:  storageName,
+			Command:   "mergeset",
+			Key:       append(utils.Uint64ToBytes(id), cmd.Key...),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(pos),
+			ValueType: engine.TypeUint,
+		})
+	}
+
+	return commands
+}
+
+// conditionDocs returns the documents matching `cond` in any element, and
+// the store with the positions of the values of its field.
+func (i *Index) conditionDocs(ctx context.Context, cond ElemCondition) ([]uint64, string, error) {
+	var (
+		docIDs []uint64
+		err    error
+		field  = []byte(cond.Field)
+	)
+
+	switch cond.Op {
+	case ElemTerm:
+		docIDs, _, err = i.FilterTermIDContext(ctx, field, cond.Value, 0)
+		return docIDs, stringStorage(field), err
+	case ElemKeyword:
+		docIDs, err = i.FilterKeywordIDContext(ctx, field, cond.Value)
+		return docIDs, keywordStorage(utils.FieldNorm(cond.Field)), err
+	case ElemPrefix:
+		docIDs, err = i.MatchPrefixIDContext(ctx, field, cond.Value)
+		return docIDs, stringStorage(field), err
+	}
+
+	return nil, "", fmt.Errorf("Unknown element condition '%s'", cond.Op)
+}
+
+// conditionPositions returns the positions of the array elements of the
+// document `docID` matching `cond`.
+func (i *Index) conditionPositions(ctx context.Context, docID uint64, storage string, cond ElemCondition) ([]uint64, error) {
+	key := append(utils.Uint64ToBytes(docID), cond.Value...)
+
+	if cond.Op != ElemPrefix {
+		return i.getPostingsContext(ctx, positionStorage(storage), key)
+	}
+
+	return i.matchTermsContext(ctx, positionStorage(storage), key, nil, 0)
+}
+
+// ElemMatchID returns the ids of documents having an array element that
+// satisfies every condition of `conds`, like the query below, where both
+// conditions must hold in the same contact:
+//
+//	contacts: [{"type": "email", "value": "..."}, {"type": "phone", ...}]
+//	ElemMatchID([]ElemCondition{
+//		{Field: "contacts.type", Op: ElemKeyword, Value: []byte("email")},
+//		{Field: "contacts.value", Op: ElemPrefix, Value: []byte("contact@")},
+//	})
+func (i *Index) ElemMatchID(conds []ElemCondition) ([]uint64, error) {
+	return i.ElemMatchIDContext(context.Background(), conds)
+}
+
+// ElemMatchIDContext is like ElemMatchID, but stops when `ctx` is done
+// and returns the error of `ctx`.
+func (i *Index) ElemMatchIDContext(ctx context.Context, conds []ElemCondition) ([]uint64, error) {
+	var (
+		docIDs   []uint64
+		storages = make([]string, len(conds))
+		result   []uint64
+	)
+
+	if len(conds) == 0 {
+		return nil, errors.New("No element conditions")
+	}
+
+	for idx, cond := range conds {
+		ids, storage, err := i.conditionDocs(ctx, cond)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if idx == 0 {
+			docIDs = ids
+		} else {
+			docIDs = intersectPostings(docIDs, ids)
+		}
+
+		storages[idx] = storage
+	}
+
+	for _, docID := range docIDs {
+		var positions []uint64
+
+		for idx, cond := range conds {
+			pos, err := i.conditionPositions(ctx, docID, storages[idx], cond)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if idx == 0 {
+				positions = pos
+			} else {
+				positions = intersectPostings(positions, pos)
+			}
+
+			if len(positions) == 0 {
+				break
+			}
+		}
+
+		if len(positions) > 0 {
+			result = append(result, docID)
+		}
+	}
+
+	return result, nil
+}
+
+// ElemMatch search documents having an array element that satisfies
+// every condition of `conds`. See ElemMatchID.
+func (i *Index) ElemMatch(conds []ElemCondition) ([]string, error) {
+	return i.ElemMatchContext(context.Background(), conds)
+}
+
+// ElemMatchContext is like ElemMatch, but stops when `ctx` is done and
+// returns the error of `ctx`.
+func (i *Index) ElemMatchContext(ctx context.Context, conds []ElemCondition) ([]string, error) {
+	docIDs, err := i.ElemMatchIDContext(ctx, conds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i.getDocsContext(ctx, docIDs)
+}
@@ -0,0 +1,246 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+func TestBuildIndexPositions(t *testing.T) {
+	var (
+		indexName = "test-build-positions"
+		indexDir  = DataDirTmp + "/" + indexName
+		commands  []engine.Command
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	commands, err = index.buildIndexField(1, "tags", []interface{}{"go", []interface{}{"c", "go"}}, nil, false)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	// nested arrays record the position in the outermost array
+	compareCommands(t, commands, []engine.Command{
+		{
+			Index:     indexName,
+			Database:  "tags_string.idx",
+			Command:   "mergeset",
+			Key:       []byte("go"),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(1),
+			ValueType: engine.TypeUint,
+		},
+		{
+			Index:     indexName,
+			Database:  "tags_string_pos.idx",
+			Command:   "mergeset",
+			Key:       append(utils.Uint64ToBytes(1), "go"...),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(0),
+			ValueType: engine.TypeUint,
+		},
+		{
+			Index:     indexName,
+			Database:  "tags_string.idx",
+			Command:   "mergeset",
+			Key:       []byte("c"),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(1),
+			ValueType: engine.TypeUint,
+		},
+		{
+			Index:     indexName,
+			Database:  "tags_string.idx",
+			Command:   "mergeset",
+			Key:       []byte("go"),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(1),
+			ValueType: engine.TypeUint,
+		},
+		{
+			Index:     indexName,
+			Database:  "tags_string_pos.idx",
+			Command:   "mergeset",
+			Key:       append(utils.Uint64ToBytes(1), "c"...),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(1),
+			ValueType: engine.TypeUint,
+		},
+		{
+			Index:     indexName,
+			Database:  "tags_string_pos.idx",
+			Command:   "mergeset",
+			Key:       append(utils.Uint64ToBytes(1), "go"...),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(1),
+			ValueType: engine.TypeUint,
+		},
+	})
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+// BuildAdd has no build state in the index, then documents with arrays
+// can be analysed in parallel with the same index.
+func TestBuildAddConcurrent(t *testing.T) {
+	var (
+		indexName = "test-build-concurrent"
+		indexDir  = DataDirTmp + "/" + indexName
+		expected  []engine.Command
+		wg        sync.WaitGroup
+	)
+
+	doc := []byte(`{"tags": ["go", ["c", "go"]], "name": "neoway"}`)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if expected, err = index.BuildAdd(1, doc, nil); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				commands, err := index.BuildAdd(1, doc, nil)
+
+				if err != nil || !reflect.DeepEqual(commands, expected) {
+					t.Errorf("Unexpected commands: %v (%v)", commands, err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestElemMatch(t *testing.T) {
+	var (
+		indexName = "test-elem-match"
+		indexDir  = DataDirTmp + "/" + indexName
+		docIDs    []uint64
+		docs      []string
+		metadata  = Metadata{
+			"contacts": Metadata{
+				"type": "slice",
+				"metadata": Metadata{
+					"type": "object",
+					"metadata": Metadata{
+						"type":  Metadata{"type": "keyword"},
+						"value": Metadata{"type": "string"},
+					},
+				},
+			},
+		}
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "Neoway", "contacts": [{"type": "email", "value": "contact@neoway.com.br"}, {"type": "phone", "value": "555-1234"}]}`,
+		`{"name": "Google", "contacts": [{"type": "phone", "value": "contact@google.com"}, {"type": "email", "value": "555-4321"}]}`,
+		`{"name": "Facebook", "contacts": [{"type": "email", "value": "contact@fb.com"}]}`,
+	} {
+		err = index.Add(uint64(id+1), []byte(doc), metadata)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	for _, table := range []struct {
+		conds    []ElemCondition
+		expected []uint64
+	}{
+		{
+			[]ElemCondition{
+				{Field: "contacts.type", Op: ElemKeyword, Value: []byte("email")},
+				{Field: "contacts.value", Op: ElemPrefix, Value: []byte("contact@")},
+			},
+			[]uint64{1, 3},
+		},
+		{
+			[]ElemCondition{
+				{Field: "contacts.type", Op: ElemKeyword, Value: []byte("phone")},
+				{Field: "contacts.value", Op: ElemTerm, Value: []byte("555-1234")},
+			},
+			[]uint64{1},
+		},
+		{
+			[]ElemCondition{
+				{Field: "contacts.type", Op: ElemKeyword, Value: []byte("email")},
+				{Field: "contacts.value", Op: ElemTerm, Value: []byte("555-4321")},
+			},
+			[]uint64{2},
+		},
+		{
+			[]ElemCondition{
+				{Field: "contacts.type", Op: ElemKeyword, Value: []byte("phone")},
+				{Field: "contacts.value", Op: ElemTerm, Value: []byte("contact@fb.com")},
+			},
+			nil,
+		},
+	} {
+		docIDs, err = index.ElemMatchID(table.conds)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if !reflect.DeepEqual(docIDs, table.expected) {
+			t.Errorf("ElemMatch %+v returned %v != %v", table.conds, docIDs, table.expected)
+		}
+	}
+
+	docs, err = index.ElemMatch([]ElemCondition{
+		{Field: "contacts.type", Op: ElemKeyword, Value: []byte("phone")},
+		{Field: "contacts.value", Op: ElemPrefix, Value: []byte("contact")},
+	})
+
+	if err != nil || len(docs) != 1 {
+		t.Errorf("Unexpected documents: %v (%v)", docs, err)
+	}
+
+	if _, err = index.ElemMatchID([]ElemCondition{{Field: "contacts.type", Op: "regex"}}); err == nil {
+		t.Error("Unknown condition should fail")
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
@@ -0,0 +1,33 @@
+package index
+
+import (
+	"sort"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+// uniqueIDs sorts `ids` and removes the duplicates.
+func uniqueIDs(ids []uint64) []uint64 {
+	sort.Sort(utils.Uint64Slice(ids))
+
+	unique := ids[:0]
+
+	for idx, id := range ids {
+		if idx == 0 || id != ids[idx-1] {
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
+
+// encodePostings returns `ids` in the format stored by mergeset.
+func encodePostings(ids []uint64) []byte {
+	data := make([]byte, 0, len(ids)*8)
+
+	for _, id := range ids {
+		data = append(data, utils.Uint64ToBytes(id)...)
+	}
+
+	return data
+}
@@ -0,0 +1,99 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestUniqueIDs(t *testing.T) {
+	for _, table := range []struct {
+		ids      []uint64
+		expected []uint64
+	}{
+		{[]uint64{}, []uint64{}},
+		{[]uint64{1}, []uint64{1}},
+		{[]uint64{3, 1, 2}, []uint64{1, 2, 3}},
+		{[]uint64{5, 5, 1, 5, 1}, []uint64{1, 5}},
+	} {
+		if ids := uniqueIDs(table.ids); !reflect.DeepEqual(ids, table.expected) {
+			t.Errorf("uniqueIDs returned %v != %v", ids, table.expected)
+		}
+	}
+}
+
+func TestBatchPostings(t *testing.T) {
+	var (
+		indexName = "test-batch-postings"
+		indexDir  = DataDirTmp + "/" + indexName
+		docIDs    []uint64
+		batch     *Batch
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = index.Add(1, []byte(`{"name": "neoway"}`), nil)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	batch = index.NewBatch()
+
+	// documents of the same batch sharing terms
+	for id, doc := range []string{
+		`{"name": "neoway labs"}`,
+		`{"name": "neoway business"}`,
+		`{"name": "labs"}`,
+	} {
+		err = batch.Add(uint64(id+2), []byte(doc), nil)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	// the postings are written only by Commit
+	docIDs, _, err = index.FilterTermID([]byte("name"), []byte("neoway"), 0)
+
+	if err != nil || !reflect.DeepEqual(docIDs, []uint64{1}) {
+		t.Errorf("Postings before Commit: %v (%v)", docIDs, err)
+	}
+
+	if err = batch.Commit(); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	for term, expected := range map[string][]uint64{
+		"neoway":   {1, 2, 3},
+		"labs":     {2, 4},
+		"business": {3},
+	} {
+		docIDs, _, err = index.FilterTermID([]byte("name"), []byte(term), 0)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if !reflect.DeepEqual(docIDs, expected) {
+			t.Errorf("Postings of %s: %v != %v", term, docIDs, expected)
+		}
+	}
+
+	if batch.Len() != 0 {
+		t.Errorf("Batch with %d documents after Commit", batch.Len())
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
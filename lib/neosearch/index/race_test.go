@@ -0,0 +1,80 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentAddSearch indexes and searches the same index from many
+// goroutines. Run with -race (see hack/stress-test.sh).
+func TestConcurrentAddSearch(t *testing.T) {
+	var (
+		indexName = "test-concurrent-add-search"
+		indexDir  = DataDirTmp + "/" + indexName
+		writers   = 4
+		docs      = 25
+		wg        sync.WaitGroup
+		docIDs    []uint64
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for n := 0; n < docs; n++ {
+				id := uint64(w*docs + n + 1)
+				doc := fmt.Sprintf(`{"name": "neoway %d", "writer": %d}`, id, w)
+
+				if err := index.Add(id, []byte(doc), nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+
+		go func() {
+			defer wg.Done()
+
+			for n := 0; n < docs; n++ {
+				if _, _, err := index.FilterTerm([]byte("name"), []byte("neoway"), 10); err != nil {
+					t.Error(err)
+					return
+				}
+
+				if _, err := index.MatchPrefix([]byte("name"), []byte("neo")); err != nil {
+					t.Error(err)
+					return
+				}
+
+				if _, err := index.Get(uint64(n + 1)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	docIDs, _, err = index.FilterTermID([]byte("name"), []byte("neoway"), 0)
+
+	if err != nil {
+		t.Error(err)
+	} else if len(docIDs) != writers*docs {
+		t.Errorf("Expected %d documents, but found %d", writers*docs, len(docIDs))
+	}
+
+	index.Close()
+	os.RemoveAll(indexDir)
+}
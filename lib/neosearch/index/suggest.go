@@ -0,0 +1,294 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultSuggestSize is the default number of suggestions returned
+	// by Suggest.
+	DefaultSuggestSize = 5
+
+	// MaxFuzziness is the maximum edit distance allowed in fuzzy
+	// suggestions.
+	MaxFuzziness = 2
+
+	// DefaultSpellDistance is the default edit distance of the spelling
+	// suggestions.
+	DefaultSpellDistance = 2
+
+	// DefaultMaxSuggestScan is the default maximum number of terms
+	// visited by a suggestion. The suggestions are ranked among the
+	// terms visited only, then they're approximate when the limit is
+	// reached. This value can be override by Config.MaxSuggestScan.
+	DefaultMaxSuggestScan = 10000
+)
+
+// Suggestion is a term of the field dictionary and the number of
+// documents having that term.
+type Suggestion struct {
+	Term     string `json:"term"`
+	Count    uint64 `json:"count"`
+	Distance int    `json:"distance,omitempty"`
+}
+
+// better returns true if suggestion `s` should be ranked before `o`.
+func (s Suggestion) better(o Suggestion) bool {
+	if s.Distance != o.Distance {
+		return s.Distance < o.Distance
+	}
+
+	if s.Count != o.Count {
+		return s.Count > o.Count
+	}
+
+	return s.Term < o.Term
+}
+
+func (i *Index) maxSuggestScan() int {
+	if i.config.MaxSuggestScan > 0 {
+		return i.config.MaxSuggestScan
+	}
+
+	return DefaultMaxSuggestScan
+}
+
+// addSuggestion inserts `s` in the ranked list `top`, keeping at most
+// `size` suggestions.
+func addSuggestion(top []Suggestion, s Suggestion, size int) []Suggestion {
+	pos := len(top)
+
+	for pos > 0 && s.better(top[pos-1]) {
+		pos--
+	}
+
+	if pos >= size {
+		return top
+	}
+
+	if len(top) < size {
+		top = append(top, Suggestion{})
+	}
+
+	copy(top[pos+1:], top[pos:])
+	top[pos] = s
+	return top
+}
+
+// Suggest returns up to `size` terms of field `field` starting with
+// `prefix`, ranked by the number of documents having the term. If
+// `fuzziness` is greater than zero, terms whose prefix are within that
+// edit distance of `prefix` are suggested too (ranked after the closer
+// ones). Fuzzy suggestions expect the first character to be right,
+// then only that part of the dictionary is visited. At most
+// Config.MaxSuggestScan terms are visited, in the order of the
+// dictionary, then the suggestions are approximate when there are more
+// terms: they're the best of the first terms visited and a more frequent
+// term after them isn't suggested.
+func (i *Index) Suggest(field, prefix []byte, size, fuzziness int) ([]Suggestion, error) {
+	return i.SuggestContext(context.Background(), field, prefix, size, fuzziness)
+}
+
+// SuggestContext is like Suggest, but stops when `ctx` is done and returns
+// the error of `ctx`.
+func (i *Index) SuggestContext(ctx context.Context, field, prefix []byte, size, fuzziness int) ([]Suggestion, error) {
+	var (
+		top     []Suggestion
+		visited int
+		maxScan = i.maxSuggestScan()
+	)
+
+	if size <= 0 {
+		size = DefaultSuggestSize
+	}
+
+	if fuzziness < 0 || fuzziness > MaxFuzziness {
+		return nil, fmt.Errorf("Invalid fuzziness %d. Should be between 0 and %d", fuzziness, MaxFuzziness)
+	}
+
+	query := []byte(strings.ToLower(string(prefix)))
+	queryRunes := []rune(string(query))
+	seek := query
+
+	if fuzziness > 0 && len(query) > 0 {
+		_, runeLen := utf8.DecodeRune(query)
+		seek = query[:runeLen]
+	}
+
+	storekv, err := i.engine.AcquireStore(i.Name, stringStorage(field))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	for it.Seek(seek); it.Valid() && visited < maxScan; it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		key := it.Key()
+
+		if !bytes.HasPrefix(key, seek) {
+			break
+		}
+
+		visited++
+
+		s := Suggestion{
+			Term:  string(key),
+			Count: uint64(len(it.Value()) / 8),
+		}
+
+		if fuzziness > 0 && !bytes.HasPrefix(key, query) {
+			s.Distance = prefixDistance(queryRunes, []rune(s.Term), fuzziness)
+
+			if s.Distance > fuzziness {
+				continue
+			}
+		}
+
+		top = addSuggestion(top, s, size)
+	}
+
+	if err := it.GetError(); err != nil {
+		return nil, err
+	}
+
+	return top, nil
+}
+
+// byFrequency ranks spelling suggestions by the number of documents,
+// then by the edit distance.
+type byFrequency []Suggestion
+
+func (s byFrequency) Len() int      { return len(s) }
+func (s byFrequency) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byFrequency) Less(i, j int) bool {
+	if s[i].Count != s[j].Count {
+		return s[i].Count > s[j].Count
+	}
+
+	return s[i].better(s[j])
+}
+
+// SpellSuggest returns up to `size` terms of field `field` within
+// `maxDistance` edits of `term` ("Did you mean?"), ranked by the number
+// of documents having the term. Only terms more frequent than `term`
+// itself are suggested, then a correctly spelled term yields no
+// suggestions unless a very similar term is more popular. Like the
+// fuzzy suggestions, the candidates must start with the same character
+// of `term` and at most Config.MaxSuggestScan terms are visited, then
+// the suggestions are approximate when there are more candidates.
+func (i *Index) SpellSuggest(field, term []byte, size, maxDistance int) ([]Suggestion, error) {
+	return i.SpellSuggestContext(context.Background(), field, term, size, maxDistance)
+}
+
+// SpellSuggestContext is like SpellSuggest, but stops when `ctx` is done
+// and returns the error of `ctx`.
+func (i *Index) SpellSuggestContext(ctx context.Context, field, term []byte, size, maxDistance int) ([]Suggestion, error) {
+	var (
+		candidates []Suggestion
+		termCount  uint64
+		visited    int
+		maxScan    = i.maxSuggestScan()
+	)
+
+	if size <= 0 {
+		size = DefaultSuggestSize
+	}
+
+	if maxDistance <= 0 {
+		maxDistance = DefaultSpellDistance
+	}
+
+	query := []byte(strings.ToLower(strings.Trim(string(term), " ")))
+
+	if len(query) == 0 {
+		return nil, nil
+	}
+
+	queryRunes := []rune(string(query))
+	_, runeLen := utf8.DecodeRune(query)
+	seek := query[:runeLen]
+
+	storekv, err := i.engine.AcquireStore(i.Name, stringStorage(field))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer i.engine.ReleaseStore(storekv)
+
+	it := storekv.GetIterator()
+
+	defer it.Close()
+
+	for it.Seek(seek); it.Valid() && visited < maxScan; it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		key := it.Key()
+
+		if !bytes.HasPrefix(key, seek) {
+			break
+		}
+
+		visited++
+
+		count := uint64(len(it.Value()) / 8)
+
+		if bytes.Equal(key, query) {
+			termCount = count
+			continue
+		}
+
+		distance := levenshtein(queryRunes, []rune(string(key)), maxDistance)
+
+		if distance > maxDistance {
+			continue
+		}
+
+		candidates = append(candidates, Suggestion{
+			Term:     string(key),
+			Count:    count,
+			Distance: distance,
+		})
+	}
+
+	if err := it.GetError(); err != nil {
+		return nil, err
+	}
+
+	suggestions := candidates[:0]
+
+	for _, s := range candidates {
+		if s.Count > termCount {
+			suggestions = append(suggestions, s)
+		}
+	}
+
+	sort.Sort(byFrequency(suggestions))
+
+	if len(suggestions) > size {
+		suggestions = suggestions[:size]
+	}
+
+	if len(suggestions) == 0 {
+		return nil, nil
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,230 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestEditDistance(t *testing.T) {
+	for _, table := range []struct {
+		a, b         string
+		max          int
+		distance     int
+		prefixLength int
+	}{
+		{"neoway", "neoway", 2, 0, 0},
+		{"neoway", "neowey", 2, 1, 1},
+		{"neoway", "noway", 2, 1, 1},
+		{"neo", "neoway", 2, 3, 0},
+		{"nwo", "neoway", 2, 3, 1},
+		{"facebook", "google", 2, 3, 3},
+		{"", "abc", 3, 3, 0},
+	} {
+		if d := levenshtein([]rune(table.a), []rune(table.b), table.max); d != table.distance &&
+			!(d > table.max && table.distance > table.max) {
+			t.Errorf("levenshtein(%s, %s) = %d != %d", table.a, table.b, d, table.distance)
+		}
+
+		if d := prefixDistance([]rune(table.a), []rune(table.b), table.max); d != table.prefixLength &&
+			!(d > table.max && table.prefixLength > table.max) {
+			t.Errorf("prefixDistance(%s, %s) = %d != %d", table.a, table.b, d, table.prefixLength)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	var (
+		indexName   = "test-suggest"
+		indexDir    = DataDirTmp + "/" + indexName
+		suggestions []Suggestion
+		ctx         context.Context
+		cancel      context.CancelFunc
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "neoway"}`,
+		`{"name": "neoway"}`,
+		`{"name": "neosearch"}`,
+		`{"name": "nerd"}`,
+		`{"name": "neoway"}`,
+		`{"name": "neosearch"}`,
+		`{"name": "newsletter"}`,
+		`{"name": "google"}`,
+	} {
+		err = index.Add(uint64(id+1), []byte(doc), nil)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	suggestions, err = index.Suggest([]byte("name"), []byte("Neo"), 0, 0)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(suggestions, []Suggestion{
+		{Term: "neoway", Count: 3},
+		{Term: "neosearch", Count: 2},
+	}) {
+		t.Errorf("Unexpected suggestions: %+v", suggestions)
+	}
+
+	suggestions, err = index.Suggest([]byte("name"), []byte("ne"), 3, 0)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(suggestions, []Suggestion{
+		{Term: "neoway", Count: 3},
+		{Term: "neosearch", Count: 2},
+		{Term: "nerd", Count: 1},
+	}) {
+		t.Errorf("Unexpected suggestions: %+v", suggestions)
+	}
+
+	suggestions, err = index.Suggest([]byte("name"), []byte("neow"), 10, 1)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(suggestions, []Suggestion{
+		{Term: "neoway", Count: 3},
+		{Term: "neosearch", Count: 2, Distance: 1},
+		{Term: "newsletter", Count: 1, Distance: 1},
+	}) {
+		t.Errorf("Unexpected fuzzy suggestions: %+v", suggestions)
+	}
+
+	if _, err = index.Suggest([]byte("name"), []byte("neo"), 10, MaxFuzziness+1); err == nil {
+		t.Error("Invalid fuzziness should fail")
+	}
+
+	// the scan stops at the first MaxSuggestScan terms
+	index.config.MaxSuggestScan = 2
+
+	suggestions, err = index.Suggest([]byte("name"), []byte("ne"), 10, 1)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if !reflect.DeepEqual(suggestions, []Suggestion{
+		{Term: "neoway", Count: 3},
+		{Term: "neosearch", Count: 2},
+	}) {
+		t.Errorf("Unexpected suggestions of limited scan: %+v", suggestions)
+	}
+
+	if suggestions, err = index.SpellSuggest([]byte("name"), []byte("nerdy"), 10, 2); err != nil || suggestions != nil {
+		t.Errorf("Spelling suggestions visited too many terms: %+v (%v)", suggestions, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	if _, err = index.SuggestContext(ctx, []byte("name"), []byte("ne"), 10, 0); err != context.Canceled {
+		t.Errorf("Canceled suggest returned %v", err)
+	}
+
+	if _, err = index.SpellSuggestContext(ctx, []byte("name"), []byte("nerdy"), 10, 2); err != context.Canceled {
+		t.Errorf("Canceled spell suggest returned %v", err)
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
+
+func TestSpellSuggest(t *testing.T) {
+	var (
+		indexName   = "test-spell-suggest"
+		indexDir    = DataDirTmp + "/" + indexName
+		suggestions []Suggestion
+	)
+
+	index, err := createIndex(indexName, t)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, doc := range []string{
+		`{"name": "neoway"}`,
+		`{"name": "neoway"}`,
+		`{"name": "neoway"}`,
+		`{"name": "norway"}`,
+		`{"name": "neway"}`,
+		`{"name": "noway"}`,
+		`{"name": "noway"}`,
+		`{"name": "google"}`,
+	} {
+		err = index.Add(uint64(id+1), []byte(doc), nil)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	for _, table := range []struct {
+		term        string
+		size        int
+		maxDistance int
+		expected    []Suggestion
+	}{
+		{"neoway", 0, 0, nil},
+		{"Nooway", 0, 0, []Suggestion{
+			{Term: "neoway", Count: 3, Distance: 1},
+			{Term: "noway", Count: 2, Distance: 1},
+			{Term: "norway", Count: 1, Distance: 1},
+			{Term: "neway", Count: 1, Distance: 2},
+		}},
+		{"nooway", 2, 1, []Suggestion{
+			{Term: "neoway", Count: 3, Distance: 1},
+			{Term: "noway", Count: 2, Distance: 1},
+		}},
+		{"neway", 0, 1, []Suggestion{
+			{Term: "neoway", Count: 3, Distance: 1},
+			{Term: "noway", Count: 2, Distance: 1},
+		}},
+		{"gogle", 0, 0, []Suggestion{
+			{Term: "google", Count: 1, Distance: 1},
+		}},
+		{"xyz", 0, 0, nil},
+	} {
+		suggestions, err = index.SpellSuggest([]byte("name"), []byte(table.term), table.size, table.maxDistance)
+
+		if err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+
+		if !reflect.DeepEqual(suggestions, table.expected) {
+			t.Errorf("Unexpected suggestions for '%s': %+v", table.term, suggestions)
+		}
+	}
+
+cleanup:
+	index.Close()
+	os.RemoveAll(indexDir)
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -78,6 +79,44 @@ cleanup:
 	}
 }
 
+func TestIndexChanges(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Option(DataDir(DataDirTmp))
+	cfg.Option(Changes(true))
+
+	neo := New(cfg)
+
+	defer func() {
+		neo.Close()
+		os.RemoveAll(DataDirTmp + "/test-changes")
+	}()
+
+	ind, err := neo.CreateIndex("test-changes")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = ind.Add(1, []byte(`{"name": "neoway"}`), nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	reader, err := ind.Changes(0)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer reader.Close()
+
+	if change, err := reader.Next(); err != nil || change.Seq != 1 {
+		t.Errorf("Unexpected change %+v (%v)", change, err)
+	}
+}
+
 func TestOpenIndexCache(t *testing.T) {
 	var (
 		err  error
@@ -141,6 +180,138 @@ cleanup:
 
 }
 
+func TestOpenIndexConcurrent(t *testing.T) {
+	var (
+		wg      sync.WaitGroup
+		indices = make([]*index.Index, 8)
+	)
+
+	cfg := NewConfig()
+	cfg.Option(DataDir(DataDirTmp))
+	cfg.Option(Debug(false))
+
+	neo := New(cfg)
+
+	_, err := neo.CreateIndex("test-open-concurrent")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// closes the index, then every goroutine tries to open it
+	neo.Close()
+
+	for g := range indices {
+		wg.Add(1)
+
+		go func(g int) {
+			defer wg.Done()
+
+			indx, err := neo.OpenIndex("test-open-concurrent")
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			_, _, err = indx.FilterTerm([]byte("name"), []byte("neoway"), 0)
+
+			if err != nil {
+				t.Error(err)
+			}
+
+			indices[g] = indx
+		}(g)
+	}
+
+	wg.Wait()
+
+	for g := range indices {
+		if indices[g] != indices[0] {
+			t.Error("OpenIndex returned different instances of the index")
+			break
+		}
+	}
+
+	if neo.GetIndices().Len() != 1 {
+		t.Errorf("Cache problem: %d indices open", neo.GetIndices().Len())
+	}
+
+	neo.DeleteIndex("test-open-concurrent")
+	neo.Close()
+}
+
+func TestAcquireIndexEviction(t *testing.T) {
+	var (
+		indx, other *index.Index
+		err         error
+	)
+
+	cfg := NewConfig()
+	cfg.Option(DataDir(DataDirTmp))
+	cfg.Option(Debug(false))
+	cfg.Option(MaxIndicesOpen(1))
+
+	neo := New(cfg)
+
+	if _, err = neo.CreateIndex("test-acquire-a"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	indx, err = neo.AcquireIndex("test-acquire-a")
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	// evicts test-acquire-a from the cache
+	if _, err = neo.CreateIndex("test-acquire-b"); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if err = indx.Add(1, []byte(`{"name": "neoway"}`), nil); err != nil {
+		t.Errorf("Acquired index closed on eviction: %s", err)
+		goto cleanup
+	}
+
+	if err = neo.DeleteIndex("test-acquire-a"); err == nil {
+		t.Error("Acquired index deleted")
+		goto cleanup
+	}
+
+	// reopened while acquired, the same instance is returned
+	other, err = neo.OpenIndex("test-acquire-a")
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if other != indx {
+		t.Error("Acquired index opened twice")
+	}
+
+	if err = neo.ReleaseIndex(indx); err != nil {
+		t.Error(err)
+	}
+
+	if err = neo.ReleaseIndex(indx); err == nil {
+		t.Error("Index released twice")
+	}
+
+cleanup:
+	neo.DeleteIndex("test-acquire-a")
+	neo.DeleteIndex("test-acquire-b")
+
+	if err = neo.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestDeleteIndex(t *testing.T) {
 	cfg := NewConfig()
 	cfg.Option(DataDir(DataDirTmp))
@@ -764,32 +935,27 @@ func TestBatchAdd(t *testing.T) {
 		return
 	}
 
-	index.Batch()
+	batch := index.NewBatch()
 
-	err = index.Add(1, []byte(`{"id": 1, "name": "Neoway Business Solution"}`), nil)
+	err = batch.Add(1, []byte(`{"id": 1, "name": "Neoway Business Solution"}`), nil)
 
 	if err != nil {
 		t.Error(err)
 	}
 
-	if _, err := os.Stat(indexDir + "/document.db"); os.IsNotExist(err) {
-		t.Errorf("no such file or directory: %s", indexDir+"/document.db")
-		return
-	}
-
-	err = index.Add(2, []byte(`{"id": 2, "name": "Google Inc."}`), nil)
+	err = batch.Add(2, []byte(`{"id": 2, "name": "Google Inc."}`), nil)
 
 	if err != nil {
 		t.Error(err)
 	}
 
-	err = index.Add(3, []byte(`{"id": 3, "name": "Facebook Company"}`), nil)
+	err = batch.Add(3, []byte(`{"id": 3, "name": "Facebook Company"}`), nil)
 
 	if err != nil {
 		t.Error(err)
 	}
 
-	err = index.Add(4, []byte(`{"id": 4, "name": "Neoway Teste"}`), nil)
+	err = batch.Add(4, []byte(`{"id": 4, "name": "Neoway Teste"}`), nil)
 
 	if err != nil {
 		t.Error(err)
@@ -805,7 +971,14 @@ func TestBatchAdd(t *testing.T) {
 		t.Errorf("Failed!!! Batch mode doesnt working")
 	}
 
-	index.FlushBatch()
+	if err = batch.Commit(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := os.Stat(indexDir + "/document.db"); os.IsNotExist(err) {
+		t.Errorf("no such file or directory: %s", indexDir+"/document.db")
+		return
+	}
 
 	batchWork := false
 
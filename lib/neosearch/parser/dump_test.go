@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/index"
+)
+
+func TestDumpRestore(t *testing.T) {
+	var (
+		indexName          = "test-dump-restore"
+		dump, restoredDump bytes.Buffer
+		ncommands          int
+		restored           *index.Index
+		restorer           *index.Restorer
+		metadata           = index.Metadata{
+			"count":    index.Metadata{"type": "uint"},
+			"score":    index.Metadata{"type": "int"},
+			"active":   index.Metadata{"type": "bool"},
+			"code":     index.Metadata{"type": "keyword"},
+			"location": index.Metadata{"type": "geo_point"},
+			"born": index.Metadata{
+				"type":   "date",
+				"format": "2006-01-02",
+			},
+		}
+	)
+
+	dataDir, err := ioutil.TempDir("/tmp", "neosearch-parser-dump")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dataDir)
+
+	if err = os.Mkdir(dataDir+"/restored", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := index.New(indexName, index.Config{DataDir: dataDir}, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, doc := range []string{
+		`{"_id": "ext-1", "name": "it's a \"quoted\"\nname\tand \\ 'más'", "count": 18446744073709551615, "score": -42, "active": true, "code": "A;B", "born": "1971-11-03", "location": {"lat": -27.5954, "lon": -48.5480}, "rank": 0.1}`,
+		`{"name": "control \u0001 bytes", "count": 0, "score": 9223372036854775807, "active": false, "tags": ["uint(1)", "x"], "rank": -1.5e+300}`,
+	} {
+		if _, err = idx.AddDocument([]byte(doc), metadata); err != nil {
+			t.Error(err)
+			goto cleanup
+		}
+	}
+
+	if err = idx.Dump(&dump); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	// restores in an index with the same name, then the dumps are equal
+	restored, err = index.New(indexName, index.Config{DataDir: dataDir + "/restored"}, true)
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	restorer = restored.NewRestorer()
+
+	err = FromReaderFunc(strings.NewReader(dump.String()), func(cmd engine.Command) error {
+		ncommands++
+		return restorer.Execute(cmd)
+	})
+
+	if closeErr := restorer.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if ncommands != strings.Count(dump.String(), "\n") {
+		t.Errorf("Parsed %d commands from a dump of %d lines", ncommands, strings.Count(dump.String(), "\n"))
+		goto cleanup
+	}
+
+	if err = restored.Dump(&restoredDump); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if dump.String() != restoredDump.String() {
+		t.Errorf("Restored index differs:\n%s\n!==\n%s", restoredDump.String(), dump.String())
+	}
+
+cleanup:
+	idx.Close()
+
+	if restored != nil {
+		restored.Close()
+	}
+}
@@ -0,0 +1,846 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/index"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+	"github.com/iNamik/go_lexer"
+)
+
+type parserState struct {
+	IsUsing              bool
+	IsCommand            bool
+	IsValue              bool
+	IsDoubleQuotedString bool
+	IsSingleQuotedString bool
+	IsCastOpen           bool
+	IsCastValue          bool
+	IsBase64             bool
+	IsLimit              bool
+	KVType               uint8
+}
+
+// We define our lexer tokens starting from the pre-defined EOF token
+const (
+	TokenEOF = lexer.TokenTypeEOF
+	TokenNil = lexer.TokenTypeEOF + iota
+	TokenSpace
+	TokenNewline
+	TokenDoubleQuotedString
+	TokenSingleQuotedString
+	TokenEscapeSequence
+	TokenSemiColon
+	TokenWord
+	TokenNumbers
+	TokenCastValue
+	TokenUsing
+	TokenSet
+	TokenGet
+	TokenMergeSet
+	TokenDelete
+)
+
+var bytesNonWord = []byte{' ', '\t', '\f', '\v', '\n', '\r', ';', '"', '\'', '\\', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9'}
+
+// bytesWordEnd are the bytes ending a word. Digits are allowed after the
+// first byte, like in index and database names.
+var bytesWordEnd = []byte{' ', '\t', '\f', '\v', '\n', '\r', ';', '"', '\'', '\\'}
+
+var bytesIntegers = []byte{'0', '1', '2', '3', '4', '5', '6', '7', '8', '9'}
+
+var bytesSpace = []byte{' ', '\t', '\f', '\v'}
+
+var bytesDoubleQuotedStrings = []byte{'"'}
+
+var bytesSingleQuotedStrings = []byte{'\''}
+
+// castPrefixes are the type casts of keys and values, like uint(10). The
+// binary keys and values are hex or base64 literals, like hex(00ff), and
+// the dates are RFC 3339 literals, like date(1971-11-03T00:00:00Z).
+var castPrefixes = []string{"uint(", "int(", "float(", "bool(", "date(", "hex(", "base64("}
+
+const charEscape = '\\'
+
+const charNewLine = '\n'
+
+const charReturn = '\r'
+
+const charSemicolon = ';'
+
+var commandsAvailable = []string{
+	"set",
+	"mergeset",
+	"mergedel",
+	"get",
+	"delete",
+	"batch",
+	"flushbatch",
+	"scan",
+	"prefix",
+	"count",
+	"first",
+	"last",
+}
+
+// Checks if the given command is valid.
+func isValidCommand(cmd string) bool {
+	for i := 0; i < len(commandsAvailable); i++ {
+		if cmd == commandsAvailable[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func setQuotedString(token string, command *engine.Command, pState *parserState) {
+	if pState.IsUsing {
+		command.Index += token
+	} else if pState.IsCommand {
+		command.Key = []byte(string(command.Key) + token)
+		command.KeyType = engine.TypeString
+	} else if pState.IsValue {
+		command.Value = []byte(string(command.Value) + token)
+		command.ValueType = engine.TypeString
+	}
+}
+
+// castType returns the type of the cast `token` starts with or zero if it
+// isn't a cast.
+func castType(token string) uint8 {
+	switch {
+	case strings.HasPrefix(token, "uint("):
+		return engine.TypeUint
+	case strings.HasPrefix(token, "int("):
+		return engine.TypeInt
+	case strings.HasPrefix(token, "float("):
+		return engine.TypeFloat
+	case strings.HasPrefix(token, "bool("):
+		return engine.TypeBool
+	case strings.HasPrefix(token, "date("):
+		return engine.TypeDate
+	case strings.HasPrefix(token, "hex("), strings.HasPrefix(token, "base64("):
+		return engine.TypeBinary
+	}
+
+	return 0
+}
+
+// openCast starts the cast `token`, like uint( or base64(.
+func openCast(token string, kvType uint8, pState *parserState) {
+	pState.KVType = kvType
+	pState.IsCastOpen = true
+	pState.IsCastValue = false
+	pState.IsBase64 = strings.HasPrefix(token, "base64(")
+}
+
+// castBytes converts the literal `value` of a cast of type `kvType`.
+func castBytes(value string, kvType uint8) ([]byte, error) {
+	switch kvType {
+	case engine.TypeUint:
+		v, err := strconv.ParseUint(value, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert %s to unsigned integer", value)
+		}
+
+		return utils.Uint64ToBytes(v), nil
+	case engine.TypeInt:
+		v, err := strconv.ParseInt(value, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert %s to integer", value)
+		}
+
+		return utils.Int64ToBytes(v), nil
+	case engine.TypeFloat:
+		v, err := strconv.ParseFloat(value, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert %s to float", value)
+		}
+
+		return utils.Float64ToBytes(v), nil
+	case engine.TypeBool:
+		v, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert %s to bool", value)
+		}
+
+		return utils.BoolToBytes(v), nil
+	case engine.TypeDate:
+		v, err := time.Parse(time.RFC3339Nano, value)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert %s to date", value)
+		}
+
+		return utils.Int64ToBytes(v.UnixNano()), nil
+	case engine.TypeBinary:
+		v, err := hex.DecodeString(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert %s to binary", value)
+		}
+
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("Invalid cast: %s", value)
+}
+
+// castValue converts the literal `value` of the cast open in `pState`.
+func castValue(value string, pState *parserState) ([]byte, error) {
+	if pState.KVType == engine.TypeBinary && pState.IsBase64 {
+		v, err := base64.StdEncoding.DecodeString(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert %s to binary", value)
+		}
+
+		return v, nil
+	}
+
+	return castBytes(value, pState.KVType)
+}
+
+// setCastValue sets the literal `data` of the cast open in `pState` as the
+// key or the value of the command.
+func setCastValue(data []byte, tokenValue string, command *engine.Command, pState *parserState) error {
+	pState.IsCastValue = true
+
+	if pState.IsCommand {
+		command.Key = data
+		command.KeyType = pState.KVType
+		pState.IsCommand = false
+		pState.IsValue = true
+
+		return nil
+	}
+
+	if isMerge(*command) {
+		if pState.KVType == engine.TypeInt && utils.BytesToInt64(data) >= 0 {
+			data = utils.Uint64ToBytes(uint64(utils.BytesToInt64(data)))
+		} else if pState.KVType != engine.TypeUint {
+			return fmt.Errorf("Failed to parse command. "+
+				"%s value shall be a unsigned integer "+
+				"value: %v", command.Command, tokenValue)
+		}
+
+		pState.KVType = engine.TypeUint
+	}
+
+	command.Value = data
+	command.ValueType = pState.KVType
+	pState.IsValue = false
+
+	return nil
+}
+
+// unescape returns the byte of the escape sequence `seq` of a quoted
+// string: \n, \r, \t, \xHH or a backslash followed by the escaped
+// character.
+func unescape(seq string) (string, error) {
+	if len(seq) < 2 {
+		return "", errors.New("Invalid escape sequence at end of input")
+	}
+
+	switch seq[1] {
+	case 'n':
+		return "\n", nil
+	case 'r':
+		return "\r", nil
+	case 't':
+		return "\t", nil
+	case 'x':
+		b, err := strconv.ParseUint(seq[2:], 16, 8)
+
+		if err != nil || len(seq) != 4 {
+			return "", fmt.Errorf("Invalid escape sequence: %s", seq)
+		}
+
+		return string([]byte{byte(b)}), nil
+	}
+
+	return seq[1:], nil
+}
+
+// isMerge returns true if the value of the command is a document id of an
+// ordered set, like in mergeset and mergedel.
+func isMerge(cmd engine.Command) bool {
+	return cmd.Command == "mergeset" || cmd.Command == "mergedel"
+}
+
+func validateBatch(cmd engine.Command) bool {
+	if cmd.Command == "batch" && cmd.Index != "" &&
+		cmd.Key == nil && cmd.Value == nil {
+		return true
+	}
+
+	return false
+}
+
+func validateFlushBatch(cmd engine.Command) bool {
+	if cmd.Command == "flushbatch" && cmd.Index != "" &&
+		cmd.Key == nil && cmd.Value == nil {
+		return true
+	}
+
+	return false
+}
+
+func validateSetters(cmd engine.Command) bool {
+	if cmd.Command == "set" || cmd.Command == "mergeset" ||
+		cmd.Command == "mergedel" {
+		if cmd.Index != "" && cmd.Key != nil &&
+			cmd.Value != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateGetters(cmd engine.Command) bool {
+	if cmd.Command == "get" || cmd.Command == "delete" {
+		if cmd.Index != "" && cmd.Key != nil &&
+			cmd.Value == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateScan(cmd engine.Command) bool {
+	if cmd.Command == "scan" && cmd.Index != "" &&
+		cmd.Key != nil && cmd.Value != nil {
+		return true
+	}
+
+	return false
+}
+
+func validatePrefix(cmd engine.Command) bool {
+	if cmd.Command == "prefix" && cmd.Index != "" &&
+		cmd.Key != nil && cmd.Value == nil {
+		return true
+	}
+
+	return false
+}
+
+// validateStoreCommand validates the commands without key and value, like
+// count.
+func validateStoreCommand(cmd engine.Command) bool {
+	if cmd.Index != "" && cmd.Key == nil && cmd.Value == nil &&
+		cmd.Limit == 0 {
+		return true
+	}
+
+	return false
+}
+
+// isLimit returns true if the word `token` is the LIMIT keyword after
+// the keys of a scan or prefix command.
+func isLimit(token string, cmd engine.Command, pState *parserState) bool {
+	if strings.ToLower(token) != "limit" || pState.IsCastOpen {
+		return false
+	}
+
+	return (cmd.Command == "scan" && cmd.Value != nil) ||
+		(cmd.Command == "prefix" && cmd.Key != nil)
+}
+
+func validateCommand(cmd engine.Command) bool {
+	if cmd.Command == "set" {
+		return validateSetters(cmd)
+	} else if cmd.Command == "get" {
+		return validateGetters(cmd)
+	} else if cmd.Command == "mergeset" || cmd.Command == "mergedel" {
+		return validateSetters(cmd)
+	} else if cmd.Command == "delete" {
+		return validateGetters(cmd)
+	} else if cmd.Command == "batch" {
+		return validateBatch(cmd)
+	} else if cmd.Command == "flushbatch" {
+		return validateFlushBatch(cmd)
+	} else if cmd.Command == "scan" {
+		return validateScan(cmd)
+	} else if cmd.Command == "prefix" {
+		return validatePrefix(cmd)
+	} else if cmd.Command == "count" || cmd.Command == "first" ||
+		cmd.Command == "last" {
+		return validateStoreCommand(cmd)
+	}
+
+	return false
+}
+
+// FromString parses the cmdline string and returns an array of engine.Command
+func FromString(cmdline string, listCommands *[]engine.Command) error {
+	return FromReader(strings.NewReader(cmdline), listCommands)
+}
+
+// FromReader parse the file
+func FromReader(file io.Reader, listCommands *[]engine.Command) error {
+	return FromReaderFunc(file, func(command engine.Command) error {
+		*listCommands = append(*listCommands, command)
+		return nil
+	})
+}
+
+// FromReaderFunc parse the file and calls `fn` for each command parsed,
+// without keeping the commands in memory. Parsing stops at the first
+// error returned by `fn`.
+func FromReaderFunc(file io.Reader, fn func(command engine.Command) error) error {
+	var command engine.Command
+
+	pState := parserState{}
+
+	// Create our lexer
+	// NewSize(startState, reader, readerBufLen, channelCap)
+	lex := lexer.NewSize(lexFunc, file, 100, 1)
+	// Process lexer-emitted tokens
+	for t := lex.NextToken(); lexer.TokenTypeEOF != t.Type(); t = lex.NextToken() {
+		switch t.Type() {
+		case TokenWord:
+			tokenValue := string(t.Bytes())
+
+			// TokenWord is a double or single quoted string?
+			if pState.IsDoubleQuotedString || pState.IsSingleQuotedString {
+				if !pState.IsUsing && !pState.IsCommand && !pState.IsValue {
+					return errors.New("Invalid quoted string: " + tokenValue)
+				}
+
+				setQuotedString(tokenValue, &command, &pState)
+
+				// TokenWord is the Index name?
+				// using <TokenWord> ...
+			} else if pState.IsUsing {
+				indexDbParts := strings.Split(tokenValue, ".")
+
+				if len(indexDbParts) < 2 {
+					return fmt.Errorf("Invalid USING <index>.<database>: %s", tokenValue)
+				}
+
+				command.Index = indexDbParts[0]
+				command.Database = strings.Join(indexDbParts[1:], ".")
+				pState.IsUsing = false
+
+				// TokenWord closes an empty literal, like hex()?
+			} else if pState.IsCastOpen && !pState.IsCastValue &&
+				(pState.IsCommand || pState.IsValue) && strings.HasPrefix(tokenValue, ")") {
+				if pState.KVType != engine.TypeBinary {
+					return errors.New("Empty cast value: " + tokenValue)
+				}
+
+				if err := setCastValue([]byte{}, tokenValue, &command, &pState); err != nil {
+					return err
+				}
+
+				pState.IsCastOpen = false
+				pState.KVType = 0
+
+				// TokenWord is the LIMIT of a scan or prefix?
+				// using name.idx prefix neo <TokenWord> 10
+			} else if isLimit(tokenValue, command, &pState) {
+				pState.IsLimit = true
+				pState.IsValue = false
+
+				// TokenWord is the key of command?
+				// using document.db mergeset <TokenWord> ...
+			} else if pState.IsCommand {
+				if kvType := castType(tokenValue); kvType != 0 {
+					openCast(tokenValue, kvType, &pState)
+				} else {
+					command.Key = []byte(tokenValue)
+					command.KeyType = engine.TypeString
+					pState.IsCommand = false
+					pState.IsValue = true
+				}
+
+				// TokenWord is the command value?
+				// using document.db mergeset name <TokenWord>
+			} else if pState.IsValue {
+				if tokenValue == ")" && pState.IsCastOpen {
+					pState.IsCastOpen = false
+				} else if kvType := castType(tokenValue); kvType != 0 {
+					openCast(tokenValue, kvType, &pState)
+				} else {
+					command.Value = []byte(tokenValue)
+					command.ValueType = engine.TypeString
+					pState.IsValue = false
+				}
+			} else {
+				// Here we handle the available KEYWORDS
+
+				if pState.IsCastOpen && strings.HasPrefix(tokenValue, ")") {
+					pState.IsCastOpen = false
+					pState.KVType = 0
+
+					// Keyword USING
+				} else if !pState.IsUsing && strings.ToLower(tokenValue) == "using" {
+					pState.IsUsing = true
+				} else if !pState.IsCommand {
+					// Must be a command KEYWORD
+					// see commandsAvailable
+
+					if !isValidCommand(strings.ToLower(tokenValue)) {
+						return fmt.Errorf("Invalid keyword '"+tokenValue+"': %s", command)
+					}
+
+					pState.IsCommand = true
+					pState.IsUsing = false
+					command.Command = strings.ToLower(tokenValue)
+				}
+			}
+		case TokenDoubleQuotedString:
+			if pState.IsDoubleQuotedString {
+				// the empty string
+				setQuotedString("", &command, &pState)
+
+				if pState.IsCommand {
+					pState.IsCommand = false
+					pState.IsValue = true
+				} else if pState.IsUsing {
+					pState.IsUsing = false
+				} else if pState.IsValue {
+					pState.IsValue = false
+				}
+			}
+
+			if pState.IsSingleQuotedString {
+				setQuotedString(string(t.Bytes()), &command, &pState)
+			} else {
+				pState.IsDoubleQuotedString = !pState.IsDoubleQuotedString
+			}
+		case TokenSingleQuotedString:
+			if pState.IsSingleQuotedString {
+				// the empty string
+				setQuotedString("", &command, &pState)
+
+				if pState.IsCommand {
+					pState.IsCommand = false
+					pState.IsValue = true
+				} else if pState.IsUsing {
+					pState.IsUsing = false
+				} else if pState.IsValue {
+					pState.IsValue = false
+				}
+			}
+
+			if pState.IsDoubleQuotedString {
+				setQuotedString(string(t.Bytes()), &command, &pState)
+			} else {
+				pState.IsSingleQuotedString = !pState.IsSingleQuotedString
+			}
+
+		case TokenEscapeSequence:
+			if !pState.IsSingleQuotedString && !pState.IsDoubleQuotedString {
+				return errors.New("Escape sequence outside of quoted string: " + string(t.Bytes()))
+			}
+
+			value, err := unescape(string(t.Bytes()))
+
+			if err != nil {
+				return err
+			}
+
+			setQuotedString(value, &command, &pState)
+		case TokenCastValue:
+			tokenValue := string(t.Bytes())
+
+			if pState.IsSingleQuotedString || pState.IsDoubleQuotedString {
+				setQuotedString(tokenValue, &command, &pState)
+				break
+			}
+
+			if !pState.IsCastOpen || (!pState.IsCommand && !pState.IsValue) {
+				return errors.New("Unexpected cast value: " + tokenValue)
+			}
+
+			data, err := castValue(tokenValue, &pState)
+
+			if err != nil {
+				return err
+			}
+
+			if err = setCastValue(data, tokenValue, &command, &pState); err != nil {
+				return err
+			}
+		case TokenSpace:
+			// Spaces only makes difference inside quotes
+			if pState.IsDoubleQuotedString || pState.IsSingleQuotedString {
+				setQuotedString(string(t.Bytes()), &command, &pState)
+			}
+
+		case TokenNewline:
+			// New lines only makes difference inside quotes
+			if pState.IsDoubleQuotedString || pState.IsSingleQuotedString {
+				setQuotedString(string(t.Bytes()), &command, &pState)
+			}
+		case TokenSemiColon:
+			if pState.IsSingleQuotedString || pState.IsDoubleQuotedString {
+				setQuotedString(string(t.Bytes()), &command, &pState)
+			} else if pState.IsLimit {
+				return fmt.Errorf("LIMIT without the number of keys: %v", command)
+			} else {
+				if err := fn(command); err != nil {
+					return err
+				}
+
+				command = engine.Command{}
+				pState = parserState{}
+			}
+		case TokenNumbers:
+			tokenValue := string(t.Bytes())
+
+			if pState.IsSingleQuotedString || pState.IsDoubleQuotedString {
+				setQuotedString(tokenValue, &command, &pState)
+			} else if pState.IsLimit {
+				limit, err := strconv.ParseUint(tokenValue, 10, 64)
+
+				if err != nil {
+					return fmt.Errorf("Failed to convert %s to limit", tokenValue)
+				}
+
+				command.Limit = limit
+				pState.IsLimit = false
+			} else if pState.IsUsing {
+				if index.ValidateIndexName(tokenValue) {
+					command.Index = tokenValue
+					pState.IsUsing = false
+
+					// TokenNumbers is the key of command?
+					// using document.db mergeset <TokenNumbers> ...
+				}
+			} else if pState.IsCommand {
+				var (
+					keyBytes []byte
+					keyType  uint8
+				)
+
+				if strings.Contains(tokenValue, ".") {
+					tokenFloatValue, err := strconv.ParseFloat(tokenValue, 64)
+
+					if err != nil {
+						return fmt.Errorf("Failed to convert %s to float", tokenValue)
+					}
+
+					keyBytes = utils.Float64ToBytes(tokenFloatValue)
+					keyType = engine.TypeFloat
+				} else {
+					tokenIntValue, err := strconv.Atoi(tokenValue)
+
+					if err != nil {
+						return fmt.Errorf("Failed to convert %s to integer", tokenValue)
+					}
+
+					if pState.KVType == engine.TypeUint {
+						keyBytes = utils.Uint64ToBytes(uint64(tokenIntValue))
+						keyType = engine.TypeUint
+					} else if pState.KVType == engine.TypeFloat {
+						keyBytes = utils.Float64ToBytes(float64(tokenIntValue))
+						keyType = engine.TypeFloat
+					} else {
+						keyBytes = utils.Int64ToBytes(int64(tokenIntValue))
+						keyType = engine.TypeInt
+					}
+				}
+
+				command.Key = keyBytes
+				command.KeyType = keyType
+				pState.IsCommand = false
+				pState.IsValue = true
+
+				pState.KVType = 0
+
+				// TokenNumbers is the command value?
+				// using document.db mergeset name <TokenNumbers>
+			} else if pState.IsValue {
+				var (
+					valueBytes      []byte
+					valueType       uint8
+					tokenIntValue   int64
+					tokenFloatValue float64
+					err             error
+				)
+
+				if strings.Contains(tokenValue, ".") {
+					tokenFloatValue, err = strconv.ParseFloat(tokenValue, 64)
+
+					if err != nil {
+						return fmt.Errorf("Failed to convert %s to float", tokenValue)
+					}
+
+					valueBytes = utils.Float64ToBytes(tokenFloatValue)
+					valueType = engine.TypeFloat
+				} else {
+					tokenInt, err := strconv.Atoi(tokenValue)
+
+					if err != nil {
+						return fmt.Errorf("Failed to convert %s to integer", tokenValue)
+					}
+
+					tokenIntValue = int64(tokenInt)
+					valueBytes = utils.Int64ToBytes(int64(tokenIntValue))
+					valueType = engine.TypeInt
+				}
+
+				if isMerge(command) {
+					if valueType == engine.TypeFloat {
+						return fmt.Errorf("Failed to parse command. "+
+							"%s value shall be a unsigned integer "+
+							"value: %v", command.Command, tokenValue)
+					}
+
+					command.Value = utils.Uint64ToBytes(uint64(tokenIntValue))
+					command.ValueType = engine.TypeUint
+				} else {
+					command.Value = valueBytes
+					command.ValueType = valueType
+				}
+
+				pState.IsValue = false
+			}
+		default:
+			return errors.New("Failed to parse line at '" + string(t.Bytes()) + "'")
+		}
+	}
+
+	// Checks if the last command was correctly parsed but
+	// doesn't have the semicolon at the end...
+	if validateCommand(command) && !pState.IsLimit {
+		return fn(command)
+	}
+
+	// Checks if exists a invalid partial command
+	if command.Index != "" || command.Command != "" ||
+		command.Key != nil || command.Value != nil {
+		return fmt.Errorf("The last command wasn't correctly finished nor have the semicolon at end: %v", command)
+	}
+
+	return nil
+}
+
+func lexFunc(l lexer.Lexer) lexer.StateFn {
+	// EOF
+	if l.MatchEOF() {
+		l.EmitEOF()
+		return nil // We're done here
+	}
+
+	if charEscape == l.PeekRune(0) {
+		l.NextRune()
+
+		if l.NextRune() == 'x' {
+			l.NextRune()
+			l.NextRune()
+		}
+
+		l.EmitTokenWithBytes(TokenEscapeSequence)
+
+	} else if l.MatchMinMaxBytes(bytesDoubleQuotedStrings, 1, 1) {
+		l.EmitTokenWithBytes(TokenDoubleQuotedString)
+
+	} else if l.MatchMinMaxBytes(bytesSingleQuotedStrings, 1, 1) {
+		l.EmitTokenWithBytes(TokenSingleQuotedString)
+
+	} else if size := castPrefixSize(l); size > 0 {
+		for ; size > 0; size-- {
+			l.NextRune()
+		}
+
+		l.EmitTokenWithBytes(TokenWord)
+		return lexCastValue
+
+	} else if l.NonMatchOneOrMoreBytes(bytesNonWord) {
+		l.NonMatchOneOrMoreBytes(bytesWordEnd)
+		l.EmitTokenWithBytes(TokenWord)
+
+	} else if l.MatchOneOrMoreBytes(bytesIntegers) {
+		l.EmitTokenWithBytes(TokenNumbers)
+
+		// Space run
+	} else if l.MatchOneOrMoreBytes(bytesSpace) {
+		l.EmitTokenWithBytes(TokenSpace)
+
+		// Line Feed
+
+	} else if charNewLine == l.PeekRune(0) {
+		l.NextRune()
+		l.EmitTokenWithBytes(TokenNewline)
+		l.NewLine()
+
+		// Carriage-Return with optional line-feed immediately following
+	} else if charReturn == l.PeekRune(0) {
+		l.NextRune()
+		if charNewLine == l.PeekRune(0) {
+			l.NextRune()
+		}
+		l.EmitTokenWithBytes(TokenNewline)
+		l.NewLine()
+	} else if charSemicolon == l.PeekRune(0) {
+		l.NextRune()
+		l.EmitTokenWithBytes(TokenSemiColon)
+	} else {
+		panic("Failed to parse line at '" + string(l.PeekRune(0)))
+	}
+
+	return lexFunc
+}
+
+// castPrefixSize returns the size of the cast prefix at the lexer position
+// or zero if there is none.
+func castPrefixSize(l lexer.Lexer) int {
+	for _, prefix := range castPrefixes {
+		matched := true
+
+		for idx, r := range prefix {
+			if l.PeekRune(idx) != r {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return len(prefix)
+		}
+	}
+
+	return 0
+}
+
+// lexCastValue lexes the literal after a cast prefix, like the -1.5 of
+// float(-1.5).
+func lexCastValue(l lexer.Lexer) lexer.StateFn {
+	var size int
+
+	for r := l.PeekRune(0); isCastValueRune(r); r = l.PeekRune(0) {
+		l.NextRune()
+		size++
+	}
+
+	if size > 0 {
+		l.EmitTokenWithBytes(TokenCastValue)
+	}
+
+	return lexFunc
+}
+
+func isCastValueRune(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') ||
+		(r >= 'A' && r <= 'Z') || r == '.' || r == '-' || r == '+' ||
+		r == ':' || r == '/' || r == '='
+}
@@ -0,0 +1,466 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+func TestCliParserFromReader(t *testing.T) {
+	commands := []engine.Command{}
+	error := FromReader(strings.NewReader("using sample.TEST mergeset a 1;"), &commands)
+
+	if error != nil {
+		t.Error(error)
+	}
+
+	compareCommand(commands[0], engine.Command{
+		Index:     "sample",
+		Database:  "TEST",
+		Command:   "mergeset",
+		Key:       []byte("a"),
+		KeyType:   engine.TypeString,
+		Value:     utils.Uint64ToBytes(1),
+		ValueType: engine.TypeUint,
+	}, t)
+
+	compareArray(`using sample.test.idx mergeset a 2;
+             using sample.document.db set 1 "{id: 1, name: \"teste\"}";
+             using sample.lalala set hello "world";
+             using sample.mimimi get hello;
+             using sample.lelele delete "teste";
+             using sample.bleh.idx get uint(1);
+             using sample.aaaa.bbb set uint(10000) int(10);
+             using sample.bbbb.ccc mergeset "hellooooooooooooooooo" uint(102999299112211223);
+             using sample.aaa delete "bbb"
+        `, []engine.Command{
+		engine.Command{
+			Index:     "sample",
+			Database:  "test.idx",
+			Command:   "mergeset",
+			Key:       []byte("a"),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(2),
+			ValueType: engine.TypeUint,
+		},
+		engine.Command{
+			Index:     "sample",
+			Database:  "document.db",
+			Command:   "set",
+			Key:       utils.Int64ToBytes(1),
+			KeyType:   engine.TypeInt,
+			Value:     []byte("{id: 1, name: \"teste\"}"),
+			ValueType: engine.TypeString,
+		},
+		engine.Command{
+			Index:     "sample",
+			Database:  "lalala",
+			Command:   "set",
+			Key:       []byte("hello"),
+			KeyType:   engine.TypeString,
+			Value:     []byte("world"),
+			ValueType: engine.TypeString,
+		},
+		engine.Command{
+			Index:    "sample",
+			Database: "mimimi",
+			Command:  "get",
+			Key:      []byte("hello"),
+			KeyType:  engine.TypeString,
+		},
+		engine.Command{
+			Index:    "sample",
+			Database: "lelele",
+			Command:  "delete",
+			Key:      []byte("teste"),
+			KeyType:  engine.TypeString,
+		},
+		engine.Command{
+			Index:    "sample",
+			Database: "bleh.idx",
+			Command:  "get",
+			Key:      utils.Uint64ToBytes(1),
+			KeyType:  engine.TypeUint,
+		},
+		engine.Command{
+			Index:     "sample",
+			Database:  "aaaa.bbb",
+			Command:   "set",
+			Key:       utils.Uint64ToBytes(10000),
+			KeyType:   engine.TypeUint,
+			Value:     utils.Int64ToBytes(10),
+			ValueType: engine.TypeInt,
+		},
+		engine.Command{
+			Index:     "sample",
+			Database:  "bbbb.ccc",
+			Command:   "mergeset",
+			Key:       []byte("hellooooooooooooooooo"),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(102999299112211223),
+			ValueType: engine.TypeUint,
+		},
+		engine.Command{
+			Index:    "sample",
+			Database: "aaa",
+			Command:  "delete",
+			Key:      []byte("bbb"),
+			KeyType:  engine.TypeString,
+		},
+	}, t)
+
+	// underscore in the index name should pass
+	commands = []engine.Command{}
+	error = FromReader(strings.NewReader(`using sample.user_password set admin "s3cr3t"`),
+		&commands)
+
+	if error != nil {
+		t.Error(error)
+	}
+
+	compareCommand(commands[0], engine.Command{
+		Index:     "sample",
+		Database:  "user_password",
+		Command:   "set",
+		Key:       []byte("admin"),
+		KeyType:   engine.TypeString,
+		Value:     []byte("s3cr3t"),
+		ValueType: engine.TypeString,
+	}, t)
+
+	// invalid keyword "usinga"
+	shouldThrowError(`
+             usinga sample.test.idx set "hello" "world";
+        `, t)
+
+	compareArray(`using sample.name.idx mergedel neoway 2;
+             using sample.name.idx mergedel "neo way" uint(3)`, []engine.Command{
+		{
+			Index:     "sample",
+			Database:  "name.idx",
+			Command:   "mergedel",
+			Key:       []byte("neoway"),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(2),
+			ValueType: engine.TypeUint,
+		},
+		{
+			Index:     "sample",
+			Database:  "name.idx",
+			Command:   "mergedel",
+			Key:       []byte("neo way"),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(3),
+			ValueType: engine.TypeUint,
+		},
+	}, t)
+
+	// the value of mergedel is a document id
+	shouldThrowError(`using sample.name.idx mergedel neoway 2.5;`, t)
+
+}
+
+func TestCliParserReverse(t *testing.T) {
+	for _, cmd := range []engine.Command{
+		{
+			Index:     "sample2",
+			Database:  "name2_string.idx",
+			Command:   "set",
+			Key:       []byte("it's a \\ \"test\";\n\ttab"),
+			KeyType:   engine.TypeString,
+			Value:     []byte("florianópolis uint(1) \x00\xff\r"),
+			ValueType: engine.TypeString,
+		},
+		{
+			Index:     "sample",
+			Database:  "document.db",
+			Command:   "set",
+			Key:       utils.Uint64ToBytes(18446744073709551615),
+			KeyType:   engine.TypeUint,
+			Value:     []byte(""),
+			ValueType: engine.TypeString,
+		},
+		{
+			Index:     "sample",
+			Database:  "price_float.idx",
+			Command:   "set",
+			Key:       utils.Float64ToBytes(-27.545198),
+			KeyType:   engine.TypeFloat,
+			Value:     utils.Int64ToBytes(-9223372036854775808),
+			ValueType: engine.TypeInt,
+		},
+		{
+			Index:     "sample",
+			Database:  "active_bool.idx",
+			Command:   "mergeset",
+			Key:       utils.BoolToBytes(true),
+			KeyType:   engine.TypeBool,
+			Value:     utils.Uint64ToBytes(7),
+			ValueType: engine.TypeUint,
+		},
+		{
+			Index:    "sample",
+			Database: "name_string.idx",
+			Command:  "delete",
+			Key:      []byte(""),
+			KeyType:  engine.TypeString,
+		},
+		{
+			Index:     "sample",
+			Database:  "name_string.idx",
+			Command:   "mergedel",
+			Key:       []byte("neoway"),
+			KeyType:   engine.TypeString,
+			Value:     utils.Uint64ToBytes(3),
+			ValueType: engine.TypeUint,
+		},
+		{
+			Index:    "sample",
+			Database: "name_string.idx",
+			Command:  "flushbatch",
+		},
+		{
+			Index:     "sample",
+			Database:  "document.db",
+			Command:   "scan",
+			Key:       utils.Uint64ToBytes(1),
+			KeyType:   engine.TypeUint,
+			Value:     utils.Uint64ToBytes(10),
+			ValueType: engine.TypeUint,
+			Limit:     5,
+		},
+		{
+			Index:    "sample",
+			Database: "name_string.idx",
+			Command:  "prefix",
+			Key:      []byte("limit"),
+			KeyType:  engine.TypeString,
+		},
+		{
+			Index:    "sample",
+			Database: "name_string.idx",
+			Command:  "count",
+		},
+		{
+			Index:     "sample",
+			Database:  "blob.db",
+			Command:   "set",
+			Key:       []byte{0, 0xff, ')', ';'},
+			KeyType:   engine.TypeBinary,
+			Value:     []byte{},
+			ValueType: engine.TypeBinary,
+		},
+		{
+			Index:     "sample",
+			Database:  "born_date.idx",
+			Command:   "mergeset",
+			Key:       utils.Int64ToBytes(-1234567890123456789),
+			KeyType:   engine.TypeDate,
+			Value:     utils.Uint64ToBytes(2),
+			ValueType: engine.TypeUint,
+		},
+	} {
+		commands := []engine.Command{}
+
+		if err := FromString(cmd.Reverse(), &commands); err != nil {
+			t.Errorf("Failed to parse %s: %s", cmd.Reverse(), err)
+			continue
+		}
+
+		if len(commands) != 1 {
+			t.Errorf("Failed to parse %s: %v", cmd.Reverse(), commands)
+			continue
+		}
+
+		compareCommand(commands[0], cmd, t)
+	}
+
+	// invalid escape sequence
+	shouldThrowError(`using sample.test.idx set 'a\xzz' 'b';`, t)
+}
+
+func TestCliParserQueries(t *testing.T) {
+	compareArray(`using sample.name.idx scan "a" "c" limit 10;
+             using sample.name.idx scan a c;
+             using sample.document.db scan uint(1) uint(3) LIMIT 2;
+             using sample.name.idx prefix neo limit 3;
+             using sample.price.idx prefix float(1.5) limit 1;
+             using sample.name.idx count;
+             using sample.name.idx first;
+             using sample.name.idx last
+        `, []engine.Command{
+		{
+			Index:     "sample",
+			Database:  "name.idx",
+			Command:   "scan",
+			Key:       []byte("a"),
+			KeyType:   engine.TypeString,
+			Value:     []byte("c"),
+			ValueType: engine.TypeString,
+			Limit:     10,
+		},
+		{
+			Index:     "sample",
+			Database:  "name.idx",
+			Command:   "scan",
+			Key:       []byte("a"),
+			KeyType:   engine.TypeString,
+			Value:     []byte("c"),
+			ValueType: engine.TypeString,
+		},
+		{
+			Index:     "sample",
+			Database:  "document.db",
+			Command:   "scan",
+			Key:       utils.Uint64ToBytes(1),
+			KeyType:   engine.TypeUint,
+			Value:     utils.Uint64ToBytes(3),
+			ValueType: engine.TypeUint,
+			Limit:     2,
+		},
+		{
+			Index:    "sample",
+			Database: "name.idx",
+			Command:  "prefix",
+			Key:      []byte("neo"),
+			KeyType:  engine.TypeString,
+			Limit:    3,
+		},
+		{
+			Index:    "sample",
+			Database: "price.idx",
+			Command:  "prefix",
+			Key:      utils.Float64ToBytes(1.5),
+			KeyType:  engine.TypeFloat,
+			Limit:    1,
+		},
+		{
+			Index:    "sample",
+			Database: "name.idx",
+			Command:  "count",
+		},
+		{
+			Index:    "sample",
+			Database: "name.idx",
+			Command:  "first",
+		},
+		{
+			Index:    "sample",
+			Database: "name.idx",
+			Command:  "last",
+		},
+	}, t)
+
+	shouldThrowError(`using sample.name.idx prefix neo limit;`, t)
+	shouldThrowError(`using sample.name.idx scan a c limit`, t)
+}
+
+func TestCliParserBinary(t *testing.T) {
+	compareArray(`using sample.blob.db set hex(00FF0a) base64(AP8K);
+             using sample.blob.db get hex();
+             using sample.blob.db set base64(+/8=) hex();
+             using sample.born.idx mergeset date(1971-11-03T00:00:00-02:00) 1`, []engine.Command{
+		{
+			Index:     "sample",
+			Database:  "blob.db",
+			Command:   "set",
+			Key:       []byte{0, 0xff, '\n'},
+			KeyType:   engine.TypeBinary,
+			Value:     []byte{0, 0xff, '\n'},
+			ValueType: engine.TypeBinary,
+		},
+		{
+			Index:    "sample",
+			Database: "blob.db",
+			Command:  "get",
+			Key:      []byte{},
+			KeyType:  engine.TypeBinary,
+		},
+		{
+			Index:     "sample",
+			Database:  "blob.db",
+			Command:   "set",
+			Key:       []byte{0xfb, 0xff},
+			KeyType:   engine.TypeBinary,
+			Value:     []byte{},
+			ValueType: engine.TypeBinary,
+		},
+		{
+			Index:     "sample",
+			Database:  "born.idx",
+			Command:   "mergeset",
+			Key:       utils.Int64ToBytes(57981600000000000),
+			KeyType:   engine.TypeDate,
+			Value:     utils.Uint64ToBytes(1),
+			ValueType: engine.TypeUint,
+		},
+	}, t)
+
+	shouldThrowError(`using sample.blob.db set hex(0g) 'a';`, t)
+	shouldThrowError(`using sample.blob.db set base64(A) 'a';`, t)
+	shouldThrowError(`using sample.blob.db set uint() 'a';`, t)
+	shouldThrowError(`using sample.name.idx mergeset a hex(01);`, t)
+}
+
+func compareCommand(cmd engine.Command, expected engine.Command, t *testing.T) {
+	if !reflect.DeepEqual(cmd, expected) {
+		t.Errorf("Unexpected parsed command: %v !== %v", cmd.Reverse(), expected.Reverse())
+		fmt.Printf("%v !== %v\n", cmd, expected)
+	}
+}
+
+func shouldThrowError(bufferCommands string, t *testing.T) {
+	resultCommands := []engine.Command{}
+
+	error := FromReader(strings.NewReader(bufferCommands), &resultCommands)
+
+	if error == nil {
+		t.Errorf("Test SHOULD fail: %v", resultCommands)
+		return
+	}
+}
+
+func compareArray(bufferCommands string, expectedCommands []engine.Command, t *testing.T) {
+	resultCommands := []engine.Command{}
+
+	error := FromReader(strings.NewReader(bufferCommands), &resultCommands)
+
+	if error != nil {
+		t.Error(error)
+		return
+	}
+
+	if len(resultCommands) != len(expectedCommands) {
+		t.Errorf("Failed to parse all of the cmdline tests:\n\t %v !== \n\t %v", resultCommands, expectedCommands)
+	}
+
+	for i := 0; i < len(resultCommands); i++ {
+		compareCommand(resultCommands[i], expectedCommands[i], t)
+	}
+}
+
+func TestCliParserFromReaderFunc(t *testing.T) {
+	var keys []string
+
+	err := FromReaderFunc(strings.NewReader("using sample.test set a 1; using sample.test set b 2; using sample.test set c 3;"), func(cmd engine.Command) error {
+		keys = append(keys, string(cmd.Key))
+
+		if len(keys) == 2 {
+			return fmt.Errorf("Stop at %s", cmd.Key)
+		}
+
+		return nil
+	})
+
+	if err == nil || err.Error() != "Stop at b" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Errorf("Parsing didn't stop at the error: %v", keys)
+	}
+}
@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// ReadStatement reads from `r` one statement ended by an unquoted
+// semicolon, like:
+//
+//	USING sample.test.idx SET "a;b" 1;
+//
+// and returns it with the semicolon. The semicolons inside quoted strings
+// and escaped by a backslash don't end the statement. At the end of the
+// input it returns the text read, possibly empty, and io.EOF. Statements
+// larger than `maxSize` bytes return an error, if maxSize > 0.
+func ReadStatement(r *bufio.Reader, maxSize int) (string, error) {
+	var (
+		stmt   []byte
+		quote  byte
+		escape bool
+	)
+
+	for {
+		c, err := r.ReadByte()
+
+		if err != nil {
+			return string(stmt), err
+		}
+
+		if maxSize > 0 && len(stmt) >= maxSize {
+			return "", fmt.Errorf("Statement larger than %d bytes", maxSize)
+		}
+
+		stmt = append(stmt, c)
+
+		switch {
+		case escape:
+			escape = false
+		case c == charEscape:
+			escape = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == charSemicolon:
+			return string(stmt), nil
+		}
+	}
+}
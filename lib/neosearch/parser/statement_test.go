@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadStatement(t *testing.T) {
+	input := `using sample.test.idx set "a;b" 1; using sample.test.idx set 'c;"' 2;` +
+		"\nusing sample.test.idx get a\\;b;\n  using sample.test.idx get x"
+
+	expected := []string{
+		`using sample.test.idx set "a;b" 1;`,
+		` using sample.test.idx set 'c;"' 2;`,
+		"\nusing sample.test.idx get a\\;b;",
+		"\n  using sample.test.idx get x",
+	}
+
+	reader := bufio.NewReader(strings.NewReader(input))
+
+	for i, exp := range expected {
+		stmt, err := ReadStatement(reader, 0)
+
+		if i == len(expected)-1 {
+			if err != io.EOF {
+				t.Errorf("Last statement returned %v", err)
+			}
+		} else if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if stmt != exp {
+			t.Errorf("Statement %d: %q != %q", i, stmt, exp)
+		}
+	}
+
+	if stmt, err := ReadStatement(reader, 0); stmt != "" || err != io.EOF {
+		t.Errorf("Read after the end: %q (%v)", stmt, err)
+	}
+
+	reader = bufio.NewReader(strings.NewReader("using sample.test.idx get aaaaaaaa;"))
+
+	if _, err := ReadStatement(reader, 16); err == nil {
+		t.Error("Statement larger than the maximum size read")
+	}
+}
@@ -3,8 +3,10 @@ package search
 import (
 	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch/index"
+	"golang.org/x/net/context"
 )
 
 type (
@@ -15,11 +17,113 @@ type (
 
 func (d DSL) Map() map[string]interface{} { return map[string]interface{}(d) }
 
+// Options of a search.
+type Options struct {
+	// Limit is the maximum number of documents returned. Zero means
+	// no limit.
+	Limit uint
+
+	// Suggest enables the spelling suggestions. If nil, no suggestion
+	// is made.
+	Suggest *SuggestOptions
+
+	// Sort is the order of the documents. If nil, documents are
+	// returned in the order of their ids.
+	Sort *Sort
+
+	// Aggregations computed over the documents found, by name.
+	Aggregations map[string]Aggregation
+}
+
+// Sort specifies the order of the documents of a search. The field
+// `Field` must be a keyword, or a geo_point if `Origin` is set.
+type Sort struct {
+	Field string
+	Desc  bool
+
+	// Origin sorts the documents by the distance of the geo_point
+	// field `Field` to this point.
+	Origin *index.GeoPoint
+}
+
+// Aggregation is a terms aggregation: the `Size` most frequent values
+// of the keyword field `Field` among the documents found.
+type Aggregation struct {
+	Field string `json:"field"`
+	Size  int    `json:"size"`
+}
+
+// SuggestOptions configures the spelling suggestions ("Did you mean?")
+// of a search. The zero value uses the defaults.
+type SuggestOptions struct {
+	// Size is the maximum number of suggestions for each term.
+	Size int `json:"size"`
+
+	// MaxDistance is the maximum edit distance of the suggestions.
+	MaxDistance int `json:"maxDistance"`
+
+	// MaxHits is the maximum number of hits of the search to return
+	// suggestions. With the default of zero, suggestions are returned
+	// only when nothing was found.
+	MaxHits uint64 `json:"maxHits"`
+}
+
+// TermSuggestions are the spelling suggestions of the term `Text`
+// searched in the field `Field`.
+type TermSuggestions struct {
+	Field   string             `json:"field"`
+	Text    string             `json:"text"`
+	Options []index.Suggestion `json:"options"`
+}
+
+// termClause is a clause filtering documents by a single term.
+type termClause struct {
+	field, value string
+}
+
+// Results of a search.
+type Results struct {
+	Docs        []string
+	Total       uint64
+	Suggestions []TermSuggestions
+
+	Aggregations map[string][]index.Bucket
+}
+
+// Search the index `ind` for documents matching `dsl` and returns upto
+// `limit` documents and the total of documents found.
 func Search(ind *index.Index, dsl DSL, limit uint) ([]string, uint64, error) {
+	return SearchContext(context.Background(), ind, dsl, limit)
+}
+
+// SearchContext is like Search, but stops when `ctx` is done and returns
+// the error of `ctx`.
+func SearchContext(ctx context.Context, ind *index.Index, dsl DSL, limit uint) ([]string, uint64, error) {
+	results, err := SearchWithOptionsContext(ctx, ind, dsl, Options{Limit: limit})
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return results.Docs, results.Total, nil
+}
+
+// SearchWithOptions is like Search, but returns the spelling suggestions
+// of the term clauses too, if enabled in `opts`.
+func SearchWithOptions(ind *index.Index, dsl DSL, opts Options) (*Results, error) {
+	return SearchWithOptionsContext(context.Background(), ind, dsl, opts)
+}
+
+// SearchWithOptionsContext is like SearchWithOptions, but stops when
+// `ctx` is done, between the clauses or while walking the terms and
+// reading the documents, and returns the error of `ctx`.
+func SearchWithOptionsContext(ctx context.Context, ind *index.Index, dsl DSL, opts Options) (*Results, error) {
 	var (
 		listOp        []interface{}
 		hasAnd, hasOr bool
 		resultDocIDs  []uint64
+		terms         []termClause
+		first         = true
 	)
 
 	listOp, hasAnd = dsl["$and"].([]interface{})
@@ -29,46 +133,300 @@ func Search(ind *index.Index, dsl DSL, limit uint) ([]string, uint64, error) {
 	}
 
 	if !hasAnd && !hasOr {
-		return nil, 0, errors.New("Invalid search DSL. No $and or $or clause found.")
+		return nil, errors.New("Invalid search DSL. No $and or $or clause found.")
 	}
 
 	for _, clause := range listOp {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		filter, ok := clause.(map[string]interface{})
 
 		if !ok {
-			return nil, 0, fmt.Errorf("Invalid clause '%s'.", clause)
+			return nil, fmt.Errorf("Invalid clause '%s'.", clause)
 		}
 
 		field, value := getFieldValue(filter)
 
 		if field == "" || value == nil {
-			return nil, 0, fmt.Errorf("Invalid clause '%s'.", clause)
+			return nil, fmt.Errorf("Invalid clause '%s'.", clause)
 		}
 
-		strValue, ok := value.(string)
+		docIDs, err := filterClause(ctx, ind, field, value)
 
-		if !ok {
-			return nil, 0, fmt.Errorf("Invalid field value: %s", value)
+		if err != nil {
+			return nil, err
 		}
 
-		docIDs, _, err := ind.FilterTermID([]byte(field), []byte(strValue), 0)
-
-		if err != nil {
-			return nil, 0, err
+		if term, ok := value.(string); ok {
+			terms = append(terms, termClause{field, term})
 		}
 
-		if len(resultDocIDs) == 0 {
+		// the result of the first clause, even if empty, seeds
+		// resultDocIDs, then an empty first clause of $and yields an
+		// empty intersection
+		if first {
 			resultDocIDs = docIDs
+			first = false
 			continue
 		}
 
 		if hasAnd {
 			resultDocIDs = and(resultDocIDs, docIDs)
+		} else {
+			resultDocIDs = or(resultDocIDs, docIDs)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.Sort != nil {
+		if err := sortDocs(ctx, ind, resultDocIDs, opts.Sort); err != nil {
+			return nil, err
+		}
+	}
+
+	docs, err := ind.GetDocsContext(ctx, resultDocIDs, opts.Limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := &Results{
+		Docs:  docs,
+		Total: uint64(len(resultDocIDs)),
+	}
+
+	for name, agg := range opts.Aggregations {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if results.Aggregations == nil {
+			results.Aggregations = make(map[string][]index.Bucket)
+		}
+
+		// nil means every document for TermsAggregation
+		aggDocIDs := resultDocIDs
+
+		if aggDocIDs == nil {
+			aggDocIDs = []uint64{}
+		}
+
+		results.Aggregations[name], err = ind.TermsAggregationContext(ctx, []byte(agg.Field), aggDocIDs, agg.Size)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Suggest != nil && results.Total <= opts.Suggest.MaxHits {
+		results.Suggestions, err = suggest(ctx, ind, terms, opts.Suggest)
+	}
+
+	return results, err
+}
+
+// suggest returns the spelling suggestions of the term clauses `terms`.
+func suggest(ctx context.Context, ind *index.Index, terms []termClause, opts *SuggestOptions) ([]TermSuggestions, error) {
+	var suggestions []TermSuggestions
+
+	for _, term := range terms {
+		options, err := ind.SpellSuggestContext(ctx, []byte(term.field), []byte(term.value), opts.Size, opts.MaxDistance)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(options) > 0 {
+			suggestions = append(suggestions, TermSuggestions{
+				Field:   term.field,
+				Text:    term.value,
+				Options: options,
+			})
+		}
+	}
+
+	return suggestions, nil
+}
+
+// filterClause returns the ids of documents matching a single clause.
+// The clause value could be a string (term filter) or an object with
+// one operator, like: {"name": {"$prefix": "neo"}}
+func filterClause(ctx context.Context, ind *index.Index, field string, value interface{}) ([]uint64, error) {
+	switch v := value.(type) {
+	case string:
+		docIDs, _, err := ind.FilterTermIDContext(ctx, []byte(field), []byte(v), 0)
+		return docIDs, err
+	case map[string]interface{}:
+		op, arg := getFieldValue(v)
+
+		if op == "" || len(v) != 1 {
+			return nil, fmt.Errorf("Invalid operator clause for field '%s': %v", field, value)
+		}
+
+		return filterOperator(ctx, ind, field, op, arg)
+	}
+
+	return nil, fmt.Errorf("Invalid field value: %s", value)
+}
+
+func filterOperator(ctx context.Context, ind *index.Index, field, op string, arg interface{}) ([]uint64, error) {
+	switch op {
+	case "$geo_distance":
+		return filterGeoDistance(ctx, ind, field, arg)
+	case "$geo_bbox":
+		return filterGeoBoundingBox(ctx, ind, field, arg)
+	case "$elem_match":
+		return filterElemMatch(ctx, ind, field, arg)
+	case "$exists":
+		exists, ok := arg.(bool)
+
+		if !ok {
+			return nil, fmt.Errorf("Invalid argument for operator '$exists': %v", arg)
+		}
+
+		return ind.ExistsIDContext(ctx, []byte(field), exists)
+	}
+
+	strArg, ok := arg.(string)
+
+	if !ok {
+		return nil, fmt.Errorf("Invalid argument for operator '%s': %v", op, arg)
+	}
+
+	switch op {
+	case "$prefix":
+		return ind.MatchPrefixIDContext(ctx, []byte(field), []byte(strArg))
+	case "$wildcard":
+		return ind.MatchWildcardIDContext(ctx, []byte(field), []byte(strArg))
+	case "$regex":
+		return ind.MatchRegexIDContext(ctx, []byte(field), []byte(strArg))
+	case "$contains":
+		return ind.ContainsIDContext(ctx, []byte(field), []byte(strArg))
+	case "$keyword":
+		return ind.FilterKeywordIDContext(ctx, []byte(field), []byte(strArg))
+	}
+
+	return nil, fmt.Errorf("Unknown operator '%s'", op)
+}
+
+// filterElemMatch filters documents having an element of the array
+// `field` matching every condition, like:
+// {"contacts": {"$elem_match": {"type": {"$keyword": "email"}, "value": "neoway"}}}
+func filterElemMatch(ctx context.Context, ind *index.Index, field string, arg interface{}) ([]uint64, error) {
+	var (
+		conds     []index.ElemCondition
+		subfields []string
+	)
+
+	obj, ok := arg.(map[string]interface{})
+
+	if !ok || len(obj) == 0 {
+		return nil, fmt.Errorf("Invalid argument for operator '$elem_match': %v", arg)
+	}
+
+	for subfield := range obj {
+		subfields = append(subfields, subfield)
+	}
+
+	sort.Strings(subfields)
+
+	for _, subfield := range subfields {
+		cond := index.ElemCondition{
+			Field: field + "." + subfield,
+			Op:    index.ElemTerm,
 		}
+
+		switch v := obj[subfield].(type) {
+		case string:
+			cond.Value = []byte(v)
+		case map[string]interface{}:
+			op, value := getFieldValue(v)
+			strValue, ok := value.(string)
+
+			if len(v) != 1 || !ok {
+				return nil, fmt.Errorf("Invalid $elem_match condition for field '%s': %v", subfield, v)
+			}
+
+			switch op {
+			case "$keyword":
+				cond.Op = index.ElemKeyword
+			case "$prefix":
+				cond.Op = index.ElemPrefix
+			default:
+				return nil, fmt.Errorf("Operator '%s' isn't supported in $elem_match", op)
+			}
+
+			cond.Value = []byte(strValue)
+		default:
+			return nil, fmt.Errorf("Invalid $elem_match condition for field '%s': %v", subfield, v)
+		}
+
+		conds = append(conds, cond)
 	}
 
-	results, err := ind.GetDocs(resultDocIDs, limit)
-	return results, uint64(len(resultDocIDs)), err
+	return ind.ElemMatchIDContext(ctx, conds)
+}
+
+// filterGeoDistance filters documents near a point, like:
+// {"location": {"$geo_distance": {"lat": -27.59, "lon": -48.54, "distance": "10km"}}}
+func filterGeoDistance(ctx context.Context, ind *index.Index, field string, arg interface{}) ([]uint64, error) {
+	obj, ok := arg.(map[string]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("Invalid argument for operator '$geo_distance': %v", arg)
+	}
+
+	center, err := index.ParseGeoPoint(obj)
+
+	if err != nil {
+		return nil, err
+	}
+
+	distance, err := index.ParseDistance(obj["distance"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ind.GeoDistanceIDContext(ctx, []byte(field), center, distance)
+}
+
+// filterGeoBoundingBox filters documents inside a box, like:
+// {"location": {"$geo_bbox": {"top_left": "-27.5,-48.6", "bottom_right": "-27.7,-48.4"}}}
+func filterGeoBoundingBox(ctx context.Context, ind *index.Index, field string, arg interface{}) ([]uint64, error) {
+	obj, ok := arg.(map[string]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("Invalid argument for operator '$geo_bbox': %v", arg)
+	}
+
+	topLeft, err := index.ParseGeoPoint(obj["top_left"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	bottomRight, err := index.ParseGeoPoint(obj["bottom_right"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ind.GeoBoundingBoxIDContext(ctx, []byte(field), topLeft, bottomRight)
+}
+
+// sortDocs sorts `docIDs` as specified by `order`.
+func sortDocs(ctx context.Context, ind *index.Index, docIDs []uint64, order *Sort) error {
+	if order.Origin == nil {
+		return ind.SortByKeywordContext(ctx, []byte(order.Field), docIDs, order.Desc)
+	}
+
+	return ind.SortByDistanceContext(ctx, []byte(order.Field), docIDs, *order.Origin, order.Desc)
 }
 
 // TODO: we need benchmark this algorithm and optimize
@@ -105,6 +463,31 @@ func and(a, b []uint64) []uint64 {
 	return result[0:resIdx]
 }
 
+// or returns the union of the sorted ids `a` and `b`.
+func or(a, b []uint64) []uint64 {
+	var (
+		i, j   int
+		result = make([]uint64, 0, len(a)+len(b))
+	)
+
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			result = append(result, a[i])
+			i++
+			j++
+		} else if a[i] < b[j] {
+			result = append(result, a[i])
+			i++
+		} else {
+			result = append(result, b[j])
+			j++
+		}
+	}
+
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
 func getFieldValue(filter map[string]interface{}) (string, interface{}) {
 	for field, value := range filter {
 		return field, value
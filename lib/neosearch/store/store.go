@@ -1,6 +1,9 @@
 package store
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // KVStore is the key/value store interface for other backend kv stores.
 type KVStore interface {
@@ -9,17 +12,48 @@ type KVStore interface {
 	Get([]byte) ([]byte, error)
 	Set([]byte, []byte) error
 	MergeSet([]byte, uint64) error
+
+	// MergeDel removes the value from the ordered set of integers stored
+	// in the key and deletes the key when the set becomes empty
+	MergeDel([]byte, uint64) error
+
 	Delete([]byte) error
 	Close()
 
 	GetIterator() KVIterator
-	StartBatch()
-	FlushBatch() error
 
-	IsBatch() bool
+	// NewBatch returns an empty batch of writes of the store
+	NewBatch() Batch
+
 	IsOpen() bool
 }
 
+// Batch is a group of writes applied to a store at once by Commit. The
+// writes aren't visible before the commit. A Batch isn't safe for
+// concurrent use, but many batches of the same store can be filled in
+// parallel.
+type Batch interface {
+	Put([]byte, []byte)
+	Delete([]byte)
+
+	// Merge adds the value to the ordered set of integers stored in the
+	// key, like KVStore.MergeSet
+	Merge([]byte, uint64)
+
+	// MergeDel removes the value from the ordered set of integers stored
+	// in the key, like KVStore.MergeDel
+	MergeDel([]byte, uint64)
+
+	// Len returns the number of writes in the batch
+	Len() int
+
+	// Commit applies the writes and empties the batch
+	Commit() error
+
+	// Discard empties the batch without applying the writes
+	Discard()
+}
+
 // KVIterator expose the interface for database iterators.
 // This was Based on leveldb interface
 type KVIterator interface {
@@ -41,6 +75,122 @@ type KVConfig struct {
 	DataDir     string
 	EnableCache bool
 	CacheSize   int
+
+	// Tuning of the stores
+	Tuning
+}
+
+// Defaults of the Tuning options
+const (
+	DefaultCompression     = "snappy"
+	DefaultBlockSize       = 4 << 10
+	DefaultWriteBufferSize = 4 << 20
+	DefaultBloomFilterBits = 10
+	DefaultMaxOpenFiles    = 1000
+)
+
+// Tuning configures the tables and the reads and writes of the stores.
+// The zero values use the Default* constants. The boolean options are
+// pointers, then nil means not set and false could override true.
+type Tuning struct {
+	// Compression of the blocks: "snappy" or "none"
+	Compression string `yaml:"compression"`
+
+	// BlockSize is the size of the blocks of the tables, in bytes
+	BlockSize int `yaml:"blockSize"`
+
+	// WriteBufferSize is the size of the writes buffered in memory
+	// before written to a table, in bytes
+	WriteBufferSize int `yaml:"writeBufferSize"`
+
+	// BloomFilterBits is the number of bits per key of the bloom
+	// filters, that save the disk reads of missing keys. A negative
+	// value disables the filters.
+	BloomFilterBits int `yaml:"bloomFilterBits"`
+
+	// MaxOpenFiles is the number of files open by each store
+	MaxOpenFiles int `yaml:"maxOpenFiles"`
+
+	// DisableFillCache disables the caching of the blocks read by the
+	// gets. The iterators never fill the cache.
+	DisableFillCache *bool `yaml:"disableFillCache"`
+
+	// SyncWrites syncs the writes to disk before returning
+	SyncWrites *bool `yaml:"syncWrites"`
+}
+
+// Bool returns a pointer to `v`, to set the boolean options of Tuning.
+func Bool(v bool) *bool {
+	return &v
+}
+
+// boolValue returns the value of the boolean option `b`, false if not
+// set.
+func boolValue(b *bool) bool {
+	return b != nil && *b
+}
+
+// Validate returns an error if an option is out of range.
+func (t Tuning) Validate() error {
+	switch {
+	case t.Compression != "" && t.Compression != "snappy" && t.Compression != "none":
+		return fmt.Errorf("Invalid compression '%s'. Should be snappy or none", t.Compression)
+	case t.BlockSize != 0 && (t.BlockSize < 1<<10 || t.BlockSize > 64<<20):
+		return fmt.Errorf("Invalid block size %d. Should be between 1KB and 64MB", t.BlockSize)
+	case t.WriteBufferSize != 0 && (t.WriteBufferSize < 64<<10 || t.WriteBufferSize > 1<<30):
+		return fmt.Errorf("Invalid write buffer size %d. Should be between 64KB and 1GB", t.WriteBufferSize)
+	case t.BloomFilterBits > 32:
+		return fmt.Errorf("Invalid bloom filter bits %d. Should be at most 32", t.BloomFilterBits)
+	case t.MaxOpenFiles != 0 && t.MaxOpenFiles < 64:
+		return fmt.Errorf("Invalid max open files %d. Should be at least 64", t.MaxOpenFiles)
+	}
+
+	return nil
+}
+
+// Override returns the tuning `t` with the options set in `o`.
+func (t Tuning) Override(o Tuning) Tuning {
+	if o.Compression != "" {
+		t.Compression = o.Compression
+	}
+
+	if o.BlockSize != 0 {
+		t.BlockSize = o.BlockSize
+	}
+
+	if o.WriteBufferSize != 0 {
+		t.WriteBufferSize = o.WriteBufferSize
+	}
+
+	if o.BloomFilterBits != 0 {
+		t.BloomFilterBits = o.BloomFilterBits
+	}
+
+	if o.MaxOpenFiles != 0 {
+		t.MaxOpenFiles = o.MaxOpenFiles
+	}
+
+	if o.DisableFillCache != nil {
+		t.DisableFillCache = o.DisableFillCache
+	}
+
+	if o.SyncWrites != nil {
+		t.SyncWrites = o.SyncWrites
+	}
+
+	return t
+}
+
+// withDefaults returns the tuning with the defaults of the options not
+// set.
+func (t Tuning) withDefaults() Tuning {
+	return Tuning{
+		Compression:     DefaultCompression,
+		BlockSize:       DefaultBlockSize,
+		WriteBufferSize: DefaultWriteBufferSize,
+		BloomFilterBits: DefaultBloomFilterBits,
+		MaxOpenFiles:    DefaultMaxOpenFiles,
+	}.Override(t)
 }
 
 type KVFuncConstructor func(*KVConfig) (KVStore, error)
@@ -6,8 +6,11 @@ package store
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"sync"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
 	"github.com/jmhodges/levigo"
@@ -41,13 +44,17 @@ func init() {
 
 // LVDB is the leveldb interface exposed by NeoSearch
 type LVDB struct {
-	Config        *KVConfig
-	isBatch       bool
+	Config *KVConfig
+
+	// serializes the read-modify-write of MergeSet and of the merges of
+	// batches
+	mu sync.Mutex
+
 	_opts         *levigo.Options
 	_db           *levigo.DB
 	_readOptions  *levigo.ReadOptions
+	_iterOptions  *levigo.ReadOptions
 	_writeOptions *levigo.WriteOptions
-	_writeBatch   *levigo.WriteBatch
 }
 
 // NewLVDB creates a new leveldb instance
@@ -56,6 +63,10 @@ func NewLVDB(config *KVConfig) (*LVDB, error) {
 		Config: config,
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	lvdb.setup()
 
 	return &lvdb, nil
@@ -75,9 +86,31 @@ func (lvdb *LVDB) setup() {
 
 	lvdb._opts.SetCreateIfMissing(true)
 
-	// TODO: export this configuration options
+	tuning := lvdb.Config.Tuning.withDefaults()
+
+	if tuning.Compression == "none" {
+		lvdb._opts.SetCompression(levigo.NoCompression)
+	} else {
+		lvdb._opts.SetCompression(levigo.SnappyCompression)
+	}
+
+	lvdb._opts.SetBlockSize(tuning.BlockSize)
+	lvdb._opts.SetWriteBufferSize(tuning.WriteBufferSize)
+	lvdb._opts.SetMaxOpenFiles(tuning.MaxOpenFiles)
+
+	if tuning.BloomFilterBits > 0 {
+		lvdb._opts.SetFilterPolicy(levigo.NewBloomFilter(tuning.BloomFilterBits))
+	}
+
 	lvdb._readOptions = levigo.NewReadOptions()
+	lvdb._readOptions.SetFillCache(!boolValue(tuning.DisableFillCache))
 	lvdb._writeOptions = levigo.NewWriteOptions()
+	lvdb._writeOptions.SetSync(boolValue(tuning.SyncWrites))
+
+	// iterators don't fill the cache. The options are shared by every
+	// iterator, then they're never changed after setup.
+	lvdb._iterOptions = levigo.NewReadOptions()
+	lvdb._iterOptions.SetFillCache(false)
 }
 
 // Open the database
@@ -108,12 +141,13 @@ func (lvdb *LVDB) IsOpen() bool {
 
 // Set put or update the key with the given value
 func (lvdb *LVDB) Set(key []byte, value []byte) error {
-	if lvdb.isBatch {
-		// isBatch == true, we can safely access _writeBatch pointer
-		lvdb._writeBatch.Put(key, value)
-		return nil
-	}
+	lvdb.mu.Lock()
+	defer lvdb.mu.Unlock()
+
+	return lvdb.set(key, value)
+}
 
+func (lvdb *LVDB) set(key []byte, value []byte) error {
 	return lvdb._db.Put(lvdb._writeOptions, key, value)
 }
 
@@ -133,6 +167,9 @@ func (lvdb *LVDB) MergeSet(key []byte, value uint64) error {
 		inserted bool
 	)
 
+	lvdb.mu.Lock()
+	defer lvdb.mu.Unlock()
+
 	data, err := lvdb.Get(key)
 
 	if err != nil {
@@ -155,7 +192,7 @@ func (lvdb *LVDB) MergeSet(key []byte, value uint64) error {
 			return nil
 		}
 
-		if value < v {
+		if !inserted && value < v {
 			err = binary.Write(buf, binary.BigEndian, value)
 			if err != nil {
 				return err
@@ -177,7 +214,33 @@ func (lvdb *LVDB) MergeSet(key []byte, value uint64) error {
 		}
 	}
 
-	return lvdb.Set(key, buf.Bytes())
+	return lvdb.set(key, buf.Bytes())
+}
+
+// MergeDel removes value from the ordered set of integers stored in key.
+// The key is deleted when the set becomes empty.
+func (lvdb *LVDB) MergeDel(key []byte, value uint64) error {
+	lvdb.mu.Lock()
+	defer lvdb.mu.Unlock()
+
+	data, err := lvdb.Get(key)
+
+	if err != nil {
+		return err
+	}
+
+	kept := mergeDel(data, []uint64{value})
+
+	// value isn't on the key
+	if len(kept) == len(data) {
+		return nil
+	}
+
+	if len(kept) == 0 {
+		return lvdb.DeleteCustom(lvdb._writeOptions, key)
+	}
+
+	return lvdb.set(key, kept)
 }
 
 // Get returns the value of the given key
@@ -192,10 +255,8 @@ func (lvdb *LVDB) GetCustom(opt *levigo.ReadOptions, key []byte) ([]byte, error)
 
 // Delete remove the given key
 func (lvdb *LVDB) Delete(key []byte) error {
-	if lvdb.isBatch {
-		lvdb._writeBatch.Delete(key)
-		return nil
-	}
+	lvdb.mu.Lock()
+	defer lvdb.mu.Unlock()
 
 	return lvdb._db.Delete(lvdb._writeOptions, key)
 }
@@ -205,54 +266,154 @@ func (lvdb *LVDB) DeleteCustom(opt *levigo.WriteOptions, key []byte) error {
 	return lvdb._db.Delete(opt, key)
 }
 
-// StartBatch start a new batch write processing
-func (lvdb *LVDB) StartBatch() {
-	if lvdb._writeBatch == nil {
-		lvdb._writeBatch = levigo.NewWriteBatch()
-	} else {
-		lvdb._writeBatch.Clear()
+// NewBatch returns an empty batch of writes of the database
+func (lvdb *LVDB) NewBatch() Batch {
+	return &lvdbBatch{lvdb: lvdb}
+}
+
+// Close the database
+func (lvdb *LVDB) Close() {
+	lvdb.mu.Lock()
+	defer lvdb.mu.Unlock()
+
+	if lvdb._db != nil {
+		lvdb._db.Close()
+		lvdb._db = nil
 	}
+}
+
+// GetIterator returns a new KVIterator
+func (lvdb *LVDB) GetIterator() KVIterator {
+	return lvdb._db.NewIterator(lvdb._iterOptions)
+}
+
+const (
+	batchPut = iota
+	batchDelete
+	batchMerge
+	batchMergeDel
+)
 
-	lvdb.isBatch = true
+type batchOp struct {
+	kind  int
+	key   []byte
+	value []byte
+	id    uint64
 }
 
-// IsBatch returns true if LVDB is in batch mode
-func (lvdb *LVDB) IsBatch() bool {
-	return lvdb.isBatch
+// lvdbBatch is the Batch of LVDB. The writes are kept in memory until
+// Commit, that computes the merges and writes everything in a single
+// leveldb WriteBatch.
+type lvdbBatch struct {
+	lvdb *LVDB
+	ops  []batchOp
 }
 
-// FlushBatch writes the batch to disk
-func (lvdb *LVDB) FlushBatch() error {
-	var err error
-	if lvdb._writeBatch != nil {
-		err = lvdb._db.Write(lvdb._writeOptions, lvdb._writeBatch)
-		// After flush, release the writeBatch for future uses
-		lvdb._writeBatch.Clear()
-		lvdb.isBatch = false
-	}
+// Put sets the key with the given value on commit
+func (b *lvdbBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, batchOp{kind: batchPut, key: key, value: value})
+}
 
-	return err
+// Delete removes the key on commit
+func (b *lvdbBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{kind: batchDelete, key: key})
 }
 
-// Close the database
-func (lvdb *LVDB) Close() {
-	if lvdb._db != nil {
-		lvdb._db.Close()
-		lvdb._db = nil
+// Merge adds value to the ordered set of integers stored in key on commit
+func (b *lvdbBatch) Merge(key []byte, value uint64) {
+	b.ops = append(b.ops, batchOp{kind: batchMerge, key: key, id: value})
+}
+
+// MergeDel removes value from the ordered set of integers stored in key
+// on commit
+func (b *lvdbBatch) MergeDel(key []byte, value uint64) {
+	b.ops = append(b.ops, batchOp{kind: batchMergeDel, key: key, id: value})
+}
+
+// Len returns the number of writes in the batch
+func (b *lvdbBatch) Len() int {
+	return len(b.ops)
+}
+
+// Discard empties the batch
+func (b *lvdbBatch) Discard() {
+	b.ops = nil
+}
+
+// Commit writes the batch to disk. The values merged are read and
+// written with the database locked, like MergeSet, and the ids merged in
+// the same key are written once.
+func (b *lvdbBatch) Commit() error {
+	var (
+		lvdb   = b.lvdb
+		values = make(map[string][]byte)
+		merges = make(map[string][]mergeOp)
+	)
+
+	defer b.Discard()
+
+	if len(b.ops) == 0 {
+		return nil
 	}
 
-	if lvdb._writeBatch != nil {
-		lvdb._writeBatch.Close()
-		lvdb._writeBatch = nil
-		lvdb.isBatch = false
+	lvdb.mu.Lock()
+	defer lvdb.mu.Unlock()
+
+	if lvdb._db == nil {
+		return errors.New("Database not open")
 	}
-}
 
-// GetIterator returns a new KVIterator
-func (lvdb *LVDB) GetIterator() KVIterator {
-	var ro = lvdb._readOptions
+	writeBatch := levigo.NewWriteBatch()
+	defer writeBatch.Close()
+
+	for _, op := range b.ops {
+		key := string(op.key)
+
+		switch op.kind {
+		case batchPut:
+			// overrides the merges before it
+			delete(merges, key)
+			values[key] = op.value
+			writeBatch.Put(op.key, op.value)
+		case batchDelete:
+			delete(merges, key)
+			values[key] = nil
+			writeBatch.Delete(op.key)
+		case batchMerge:
+			merges[key] = append(merges[key], mergeOp{id: op.id})
+		case batchMergeDel:
+			merges[key] = append(merges[key], mergeOp{id: op.id, del: true})
+		}
+	}
+
+	keys := make([]string, 0, len(merges))
+
+	for key := range merges {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		data, ok := values[key]
+
+		if !ok {
+			var err error
+
+			if data, err = lvdb.Get([]byte(key)); err != nil {
+				return err
+			}
+		}
+
+		merged := applyMerges(data, merges[key])
+
+		// the set became empty
+		if len(merged) == 0 {
+			writeBatch.Delete([]byte(key))
+		} else {
+			writeBatch.Put([]byte(key), merged)
+		}
+	}
 
-	ro.SetFillCache(false)
-	it := lvdb._db.NewIterator(ro)
-	return it
+	return lvdb._db.Write(lvdb._writeOptions, writeBatch)
 }
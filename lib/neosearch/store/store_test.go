@@ -1,6 +1,7 @@
 package store
 
 import (
+	"encoding/binary"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -219,30 +220,25 @@ func TestBatchWrite(t *testing.T) {
 	os.Mkdir(DataDirTmp+string(filepath.Separator)+"sample-batch-write", 0755)
 	store = openDatabase(t, "sample-batch-write", testDb)
 
-	store.StartBatch()
+	batch := store.NewBatch()
+	batch.Put(key, value)
 
-	if store.IsBatch() == false {
-		t.Error("StartBatch not setting isBatch = true")
-		return
-	}
-
-	if err = store.Set(key, value); err != nil {
-		t.Error(err)
-		return
+	if batch.Len() != 1 {
+		t.Errorf("Batch with %d writes, expected 1", batch.Len())
 	}
 
-	// should returns nil, nil because the key is in the batch cache
+	// should returns nil, nil because the key is in the batch
 	if data, err = store.Get(key); err != nil || data != nil {
-		t.Error("Key set before wasn't in the write batch cache." +
-			" Batch mode isnt working")
+		t.Error("Key set before wasn't in the write batch." +
+			" Batch isnt working")
 	}
 
-	if err = store.FlushBatch(); err != nil {
+	if err = batch.Commit(); err != nil {
 		t.Error(err)
 	}
 
-	if store.IsBatch() == true {
-		t.Error("FlushBatch doesnt reset the isBatch")
+	if batch.Len() != 0 {
+		t.Error("Commit doesnt empty the batch")
 	}
 
 	if data, err = store.Get(key); err != nil {
@@ -271,7 +267,7 @@ func TestBatchMultiWrite(t *testing.T) {
 	os.Mkdir(DataDirTmp+string(filepath.Separator)+"sample-batch-multi-write", 0755)
 	store = openDatabase(t, "sample-batch-multi-write", testDb)
 
-	store.StartBatch()
+	batch := store.NewBatch()
 
 	type kvTest struct {
 		key   []byte
@@ -296,17 +292,15 @@ func TestBatchMultiWrite(t *testing.T) {
 	}
 
 	for _, kv := range shouldPass {
-		if err = store.Set(kv.key, kv.value); err != nil {
-			t.Error(err)
-		}
+		batch.Put(kv.key, kv.value)
 
 		if data, err := store.Get(kv.key); err != nil || data != nil {
-			t.Error("Key set before wasn't in the write batch cache." +
-				" Batch mode isnt working")
+			t.Error("Key set before wasn't in the write batch." +
+				" Batch isnt working")
 		}
 	}
 
-	if err := store.FlushBatch(); err != nil {
+	if err = batch.Commit(); err != nil {
 		t.Error(err)
 	}
 
@@ -328,3 +322,336 @@ func TestBatchMultiWrite(t *testing.T) {
 
 	os.RemoveAll(DataDirTmp + "/" + testDb)
 }
+
+func TestMergeSet(t *testing.T) {
+	var (
+		testDb = "test_mergeset.db"
+		store  KVStore
+	)
+
+	os.Mkdir(DataDirTmp+string(filepath.Separator)+"sample-mergeset", 0755)
+	store = openDatabase(t, "sample-mergeset", testDb)
+
+	if store == nil {
+		return
+	}
+
+	defer func() {
+		store.Close()
+		os.RemoveAll(DataDirTmp + "/sample-mergeset")
+	}()
+
+	for _, v := range []uint64{5, 7, 3, 6, 7, 1, 9} {
+		if err := store.MergeSet([]byte("key"), v); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	data, err := store.Get([]byte("key"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var values []uint64
+
+	for i := 0; i+8 <= len(data); i += 8 {
+		values = append(values, binary.BigEndian.Uint64(data[i:i+8]))
+	}
+
+	expected := []uint64{1, 3, 5, 6, 7, 9}
+
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("MergeSet stored %v != %v", values, expected)
+	}
+}
+
+func TestBatchMerge(t *testing.T) {
+	var (
+		testDb = "test_batch-merge.db"
+		store  KVStore
+	)
+
+	os.Mkdir(DataDirTmp+string(filepath.Separator)+"sample-batch-merge", 0755)
+	store = openDatabase(t, "sample-batch-merge", testDb)
+
+	if store == nil {
+		return
+	}
+
+	defer func() {
+		store.Close()
+		os.RemoveAll(DataDirTmp + "/sample-batch-merge")
+	}()
+
+	if err := store.MergeSet([]byte("key"), 4); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// two batches filled at once, merging in the same keys
+	first, second := store.NewBatch(), store.NewBatch()
+
+	for _, v := range []uint64{5, 7, 3, 4} {
+		first.Merge([]byte("key"), v)
+	}
+
+	second.Merge([]byte("key"), 1)
+	second.Merge([]byte("key"), 7)
+
+	// the merges before a put are overridden
+	first.Merge([]byte("other"), 1)
+	first.Put([]byte("other"), binaryValue(8))
+	first.Merge([]byte("other"), 2)
+
+	// the merges after a delete start an empty set
+	second.Delete([]byte("deleted"))
+	second.Merge([]byte("deleted"), 6)
+
+	for _, batch := range []Batch{first, second} {
+		if err := batch.Commit(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	for key, expected := range map[string][]uint64{
+		"key":     {1, 3, 4, 5, 7},
+		"other":   {2, 8},
+		"deleted": {6},
+	} {
+		data, err := store.Get([]byte(key))
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		var values []uint64
+
+		for i := 0; i+8 <= len(data); i += 8 {
+			values = append(values, binary.BigEndian.Uint64(data[i:i+8]))
+		}
+
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("Batch merged %v != %v in %s", values, expected, key)
+		}
+	}
+
+	discarded := store.NewBatch()
+	discarded.Put([]byte("discarded"), []byte("value"))
+	discarded.Discard()
+
+	if err := discarded.Commit(); err != nil {
+		t.Error(err)
+	}
+
+	if data, err := store.Get([]byte("discarded")); err != nil || data != nil {
+		t.Errorf("Discarded write committed: %v (%v)", data, err)
+	}
+}
+
+func TestMergeDel(t *testing.T) {
+	var (
+		testDb = "test_mergedel.db"
+		store  KVStore
+	)
+
+	os.Mkdir(DataDirTmp+string(filepath.Separator)+"sample-mergedel", 0755)
+	store = openDatabase(t, "sample-mergedel", testDb)
+
+	if store == nil {
+		return
+	}
+
+	defer func() {
+		store.Close()
+		os.RemoveAll(DataDirTmp + "/sample-mergedel")
+	}()
+
+	for _, key := range []string{"key", "batch", "emptied"} {
+		for _, v := range []uint64{1, 3, 5} {
+			if err := store.MergeSet([]byte(key), v); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}
+
+	// 4 isn't on the key
+	for _, v := range []uint64{3, 4} {
+		if err := store.MergeDel([]byte("key"), v); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	batch := store.NewBatch()
+	batch.MergeDel([]byte("batch"), 1)
+	batch.Merge([]byte("batch"), 7)
+	batch.MergeDel([]byte("batch"), 5)
+
+	for _, v := range []uint64{5, 1, 3} {
+		batch.MergeDel([]byte("emptied"), v)
+	}
+
+	if err := batch.Commit(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	for key, expected := range map[string][]uint64{
+		"key":   {1, 5},
+		"batch": {3, 7},
+	} {
+		data, err := store.Get([]byte(key))
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		var values []uint64
+
+		for i := 0; i+8 <= len(data); i += 8 {
+			values = append(values, binary.BigEndian.Uint64(data[i:i+8]))
+		}
+
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("MergeDel kept %v != %v in %s", values, expected, key)
+		}
+	}
+
+	// the keys are deleted when the set becomes empty
+	for _, v := range []uint64{1, 5} {
+		if err := store.MergeDel([]byte("key"), v); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	for _, key := range []string{"key", "emptied"} {
+		if data, err := store.Get([]byte(key)); err != nil || data != nil {
+			t.Errorf("Empty set not deleted in %s: %v (%v)", key, data, err)
+		}
+	}
+}
+
+func binaryValue(v uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, v)
+	return data
+}
+
+func TestTuning(t *testing.T) {
+	shouldPass := []Tuning{
+		{},
+		{Compression: "none", BlockSize: 1 << 10, BloomFilterBits: -1},
+		{Compression: "snappy", WriteBufferSize: 64 << 20, MaxOpenFiles: 64},
+		{BloomFilterBits: 32, DisableFillCache: Bool(true), SyncWrites: Bool(true)},
+	}
+
+	shouldFail := []Tuning{
+		{Compression: "zlib"},
+		{BlockSize: 512},
+		{BlockSize: 128 << 20},
+		{WriteBufferSize: -1},
+		{WriteBufferSize: 2 << 30},
+		{BloomFilterBits: 33},
+		{MaxOpenFiles: 10},
+	}
+
+	for _, tuning := range shouldPass {
+		if err := tuning.Validate(); err != nil {
+			t.Errorf("Tuning %+v should pass: %s", tuning, err)
+		}
+	}
+
+	for _, tuning := range shouldFail {
+		if err := tuning.Validate(); err == nil {
+			t.Errorf("Tuning %+v should fail", tuning)
+		}
+
+		cfg := KVConfig{
+			DataDir: DataDirTmp,
+			Tuning:  tuning,
+		}
+
+		if _, err := New(&cfg); err == nil {
+			t.Errorf("Store with tuning %+v should fail", tuning)
+		}
+	}
+
+	defaults := Tuning{}.withDefaults()
+	expected := Tuning{
+		Compression:     DefaultCompression,
+		BlockSize:       DefaultBlockSize,
+		WriteBufferSize: DefaultWriteBufferSize,
+		BloomFilterBits: DefaultBloomFilterBits,
+		MaxOpenFiles:    DefaultMaxOpenFiles,
+	}
+
+	if !reflect.DeepEqual(defaults, expected) {
+		t.Errorf("Unexpected defaults: %+v", defaults)
+	}
+
+	tuning := Tuning{BlockSize: 8 << 10, SyncWrites: Bool(true)}.Override(Tuning{Compression: "none", BlockSize: 16 << 10})
+
+	if tuning.Compression != "none" || tuning.BlockSize != 16<<10 || !boolValue(tuning.SyncWrites) {
+		t.Errorf("Unexpected override: %+v", tuning)
+	}
+
+	tuning = Tuning{DisableFillCache: Bool(true), SyncWrites: Bool(true)}.Override(Tuning{SyncWrites: Bool(false)})
+
+	if !boolValue(tuning.DisableFillCache) || tuning.SyncWrites == nil || *tuning.SyncWrites {
+		t.Errorf("Override of true by false returned %+v", tuning)
+	}
+}
+
+func TestStoreTuned(t *testing.T) {
+	var (
+		err   error
+		store KVStore
+		value []byte
+	)
+
+	cfg := KVConfig{
+		DataDir: DataDirTmp,
+		Tuning: Tuning{
+			Compression:      "none",
+			BlockSize:        8 << 10,
+			WriteBufferSize:  1 << 20,
+			BloomFilterBits:  -1,
+			MaxOpenFiles:     100,
+			DisableFillCache: Bool(true),
+			SyncWrites:       Bool(true),
+		},
+	}
+
+	os.Mkdir(DataDirTmp+string(filepath.Separator)+"sample-tuned", 0755)
+
+	if store, err = New(&cfg); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = store.Open("sample-tuned", "test.db"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = store.Set([]byte("key"), []byte("value")); err != nil {
+		t.Error(err)
+		goto cleanup
+	}
+
+	if value, err = store.Get([]byte("key")); err != nil || string(value) != "value" {
+		t.Errorf("Get returned %s (%v)", value, err)
+	}
+
+cleanup:
+	store.Close()
+	os.RemoveAll(DataDirTmp + "/sample-tuned")
+}
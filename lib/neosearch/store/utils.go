@@ -2,7 +2,10 @@ package store
 
 import (
 	"regexp"
+	"sort"
 	"strings"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
 )
 
 func validateDatabaseName(name string) bool {
@@ -30,3 +33,97 @@ func validateDatabaseName(name string) bool {
 
 	return true
 }
+
+// mergeSet returns the ordered set of integers `data` (as stored by
+// MergeSet) with the values `values` added.
+func mergeSet(data []byte, values []uint64) []byte {
+	sort.Sort(utils.Uint64Slice(values))
+
+	merged := make([]byte, 0, len(data)+len(values)*8)
+	last, hasLast := uint64(0), false
+
+	appendValue := func(v uint64) {
+		if hasLast && v == last {
+			return
+		}
+
+		merged = append(merged, utils.Uint64ToBytes(v)...)
+		last, hasLast = v, true
+	}
+
+	for len(data) >= 8 || len(values) > 0 {
+		if len(data) < 8 {
+			appendValue(values[0])
+			values = values[1:]
+			continue
+		}
+
+		v := utils.BytesToUint64(data[:8])
+
+		if len(values) > 0 && values[0] < v {
+			appendValue(values[0])
+			values = values[1:]
+			continue
+		}
+
+		appendValue(v)
+		data = data[8:]
+	}
+
+	return merged
+}
+
+// mergeDel returns the ordered set of integers `data` (as stored by
+// MergeSet) without the values `values`.
+func mergeDel(data []byte, values []uint64) []byte {
+	sort.Sort(utils.Uint64Slice(values))
+
+	kept := make([]byte, 0, len(data))
+
+	for ; len(data) >= 8; data = data[8:] {
+		v := utils.BytesToUint64(data[:8])
+
+		for len(values) > 0 && values[0] < v {
+			values = values[1:]
+		}
+
+		if len(values) > 0 && values[0] == v {
+			continue
+		}
+
+		kept = append(kept, data[:8]...)
+	}
+
+	return kept
+}
+
+// mergeOp is a value added or removed from an ordered set of integers.
+type mergeOp struct {
+	id  uint64
+	del bool
+}
+
+// applyMerges returns the ordered set of integers `data` with the values
+// of `ops` added or removed, in order.
+func applyMerges(data []byte, ops []mergeOp) []byte {
+	for len(ops) > 0 {
+		var (
+			del    = ops[0].del
+			values []uint64
+		)
+
+		// the consecutive ops of the same kind are applied at once
+		for len(ops) > 0 && ops[0].del == del {
+			values = append(values, ops[0].id)
+			ops = ops[1:]
+		}
+
+		if del {
+			data = mergeDel(data, values)
+		} else {
+			data = mergeSet(data, values)
+		}
+	}
+
+	return data
+}
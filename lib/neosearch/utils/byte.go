@@ -108,9 +108,9 @@ func GetUint64Array(data []byte) []uint64 {
 	lenBytes := uint64(len(data))
 	uints := make([]uint64, lenBytes/8)
 
-	for i = 0; i < lenBytes; i += 8 {
+	for i = 0; i+8 <= lenBytes; i += 8 {
 		v = BytesToUint64(data[i : i+8])
-		uints[i] = v
+		uints[i/8] = v
 	}
 
 	return uints
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/index"
+)
+
+// fsck checks the consistency of the indices `names`, printing the
+// problems found, and repair them if `repair` is true. Returns the exit
+// status: 0 if every index is consistent (or was repaired), 1 if problems
+// were found and 2 on errors.
+func fsck(cfg *neosearch.Config, names []string, metadataStr string, repair bool) int {
+	var (
+		metadata = index.Metadata{}
+		status   int
+	)
+
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: neosearch fsck [--repair] [--metadata <json>] <index>...")
+		return 2
+	}
+
+	if metadataStr != "" {
+		if err := json.Unmarshal([]byte(metadataStr), &metadata); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid metadata: %s\n", err)
+			return 2
+		}
+	}
+
+	search := neosearch.New(cfg)
+
+	defer search.Close()
+
+	for _, name := range names {
+		ind, err := search.OpenIndex(name)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			status = 2
+			continue
+		}
+
+		report, err := ind.Fsck(metadata, repair)
+
+		if report != nil {
+			for _, problem := range report.Problems {
+				fmt.Printf("%s: %s\n", name, problem)
+			}
+
+			fmt.Printf("%s: %d documents, %d databases, %d problems",
+				name, report.Documents, report.Databases, len(report.Problems))
+
+			if report.Repaired {
+				fmt.Print(" (repaired)")
+			}
+
+			fmt.Println()
+
+			if len(report.Problems) > 0 && !report.Repaired && status == 0 {
+				status = 1
+			}
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			status = 2
+		}
+	}
+
+	return status
+}
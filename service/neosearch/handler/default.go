@@ -4,12 +4,48 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
 )
 
 type DefaultHandler struct {
 	requestVars map[string]string
+
+	// Timeout is the maximum duration of the request context. Zero
+	// means no timeout.
+	Timeout time.Duration
+}
+
+// Context returns the context of the request, done when the client
+// disconnects or after h.Timeout. The cancel function must be called
+// when the request is served.
+func (h *DefaultHandler) Context(res http.ResponseWriter, req *http.Request) (context.Context, context.CancelFunc) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	if h.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), h.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	if notifier, ok := res.(http.CloseNotifier); ok {
+		closed := notifier.CloseNotify()
+
+		go func() {
+			select {
+			case <-closed:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	return ctx, cancel
 }
 
 func (h *DefaultHandler) Error(res http.ResponseWriter, errMessage string) {
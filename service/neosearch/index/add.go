@@ -6,12 +6,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch"
 	nsindex "github.com/NeowayLabs/neosearch/lib/neosearch/index"
 	"github.com/NeowayLabs/neosearch/service/neosearch/handler"
 	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
 )
 
 type AddHandler struct {
@@ -31,7 +31,7 @@ func (handler *AddHandler) ServeHTTP(res http.ResponseWriter, req *http.Request,
 		err      error
 		exists   bool
 		docID    string
-		docIntID int
+		id       uint64
 	)
 
 	handler.ProcessVars(ps)
@@ -55,26 +55,25 @@ func (handler *AddHandler) ServeHTTP(res http.ResponseWriter, req *http.Request,
 		goto error_fatal
 	}
 
-	docID = handler.GetDocumentID()
-	docIntID, err = strconv.Atoi(docID)
+	document, err = ioutil.ReadAll(req.Body)
 
 	if err != nil {
 		goto error_fatal
 	}
 
-	document, err = ioutil.ReadAll(req.Body)
+	docID = handler.GetDocumentID()
 
-	if err != nil {
-		goto error_fatal
+	if docID == "" {
+		id, err = handler.addAutoDocument(indexName, document)
+	} else {
+		id, err = handler.addDocumentByID(indexName, req, docID, document)
 	}
 
-	err = handler.addDocument(indexName, uint64(docIntID), document)
-
 	if err != nil {
 		goto error_fatal
 	}
 
-	handler.WriteJSON(res, []byte(fmt.Sprintf("{\"status\": \"Document %d indexed.\"}", docIntID)))
+	handler.WriteJSON(res, []byte(fmt.Sprintf("{\"status\": \"Document %d indexed.\", \"id\": %d}", id, id)))
 
 	return
 
@@ -86,13 +85,15 @@ error_fatal:
 	}
 }
 
-func (handler *AddHandler) addDocument(indexName string, id uint64, document []byte) error {
+// parseDocument returns the document and metadata of an add request,
+// like: {"doc": {...}, "metadata": {...}}
+func parseDocument(document []byte) ([]byte, nsindex.Metadata, error) {
 	docmeta := make(map[string]interface{})
 
 	err := json.Unmarshal(document, &docmeta)
 
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	metadata, ok := docmeta["metadata"].(map[string]interface{})
@@ -101,27 +102,90 @@ func (handler *AddHandler) addDocument(indexName string, id uint64, document []b
 		if docmeta["metadata"] == nil {
 			metadata = nsindex.Metadata{}
 		} else {
-			return fmt.Errorf("Invalid document metadata: %s", string(document))
+			return nil, nil, fmt.Errorf("Invalid document metadata: %s", string(document))
 		}
 	}
 
 	doc, ok := docmeta["doc"].(map[string]interface{})
 
 	if !ok {
-		return fmt.Errorf("Invalid document: %s", string(document))
+		return nil, nil, fmt.Errorf("Invalid document: %s", string(document))
+	}
+
+	docJSON, err := json.Marshal(doc)
+
+	if err != nil {
+		return nil, nil, err
 	}
 
-	index, err := handler.search.OpenIndex(indexName)
+	return docJSON, nsindex.Metadata(metadata), nil
+}
+
+func (handler *AddHandler) addDocument(indexName string, id uint64, document []byte) error {
+	docJSON, metadata, err := parseDocument(document)
 
 	if err != nil {
 		return err
 	}
 
-	docJSON, err := json.Marshal(doc)
+	index, err := handler.search.AcquireIndex(indexName)
 
 	if err != nil {
 		return err
 	}
 
-	return index.Add(id, docJSON, nsindex.Metadata(metadata))
+	defer handler.search.ReleaseIndex(index)
+
+	return index.Add(id, docJSON, metadata)
+}
+
+// addDocumentByID adds the document with the internal or external id
+// `docID` of the URL (see resolveID). Unknown external ids are mapped to
+// a new internal id.
+func (handler *AddHandler) addDocumentByID(indexName string, req *http.Request, docID string, document []byte) (uint64, error) {
+	docJSON, metadata, err := parseDocument(document)
+
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := handler.search.AcquireIndex(indexName)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer handler.search.ReleaseIndex(index)
+
+	id, found, err := resolveID(context.Background(), index, req, docID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if found {
+		return id, index.Add(id, docJSON, metadata)
+	}
+
+	return index.AddExternal(docID, docJSON, metadata)
+}
+
+// addAutoDocument adds a document without id in the URL. The document id
+// is given by its "_id" field or allocated from the index sequence.
+func (handler *AddHandler) addAutoDocument(indexName string, document []byte) (uint64, error) {
+	docJSON, metadata, err := parseDocument(document)
+
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := handler.search.AcquireIndex(indexName)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer handler.search.ReleaseIndex(index)
+
+	return index.AddDocument(docJSON, metadata)
 }
@@ -2,11 +2,11 @@ package index
 
 import (
 	"net/http"
-	"strconv"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch"
 	"github.com/NeowayLabs/neosearch/service/neosearch/handler"
 	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
 )
 
 type GetHandler struct {
@@ -43,26 +43,29 @@ func (handler *GetHandler) ServeHTTP(res http.ResponseWriter, req *http.Request,
 		return
 	}
 
-	docID := handler.GetDocumentID()
-
-	docIntID, err := strconv.Atoi(docID)
+	index, err := handler.search.AcquireIndex(indexName)
 
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
-		handler.Error(res, "Invalid document id")
+		handler.Error(res, err.Error())
 		return
 	}
 
-	index, err := handler.search.OpenIndex(indexName)
+	defer handler.search.ReleaseIndex(index)
 
-	if err != nil {
-		handler.Error(res, err.Error())
-		return
-	}
+	ctx, cancel := handler.Context(res, req)
+	defer cancel()
 
-	document, err = index.Get(uint64(docIntID))
+	docID, err := documentID(ctx, index, req, handler.GetDocumentID())
 
-	if err != nil {
+	if err == nil {
+		document, err = index.GetContext(ctx, docID)
+	}
+
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		res.WriteHeader(http.StatusServiceUnavailable)
+		handler.Error(res, "Get "+err.Error())
+		return
+	} else if err != nil {
 		res.WriteHeader(http.StatusBadRequest)
 		handler.Error(res, err.Error())
 		return
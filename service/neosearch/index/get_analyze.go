@@ -57,13 +57,15 @@ func (handler *GetAnalyseHandler) ServeHTTP(res http.ResponseWriter, req *http.R
 		return
 	}
 
-	index, err := handler.search.OpenIndex(indexName)
+	index, err := handler.search.AcquireIndex(indexName)
 
 	if err != nil {
 		handler.Error(res, err.Error())
 		return
 	}
 
+	defer handler.search.ReleaseIndex(index)
+
 	cmd, err = index.GetAnalyze(uint64(docIntID))
 
 	if err != nil {
@@ -72,5 +74,13 @@ func (handler *GetAnalyseHandler) ServeHTTP(res http.ResponseWriter, req *http.R
 		return
 	}
 
-	res.Write([]byte(cmd.Reverse()))
+	line, err := cmd.ReverseErr()
+
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		handler.Error(res, err.Error())
+		return
+	}
+
+	res.Write([]byte(line))
 }
@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch"
 	"github.com/julienschmidt/httprouter"
@@ -103,3 +104,52 @@ func TestGetDocumentsOK(t *testing.T) {
 	}
 
 }
+
+func TestGetTimeout(t *testing.T) {
+	handler := getGetHandler()
+
+	defer func() {
+		handler.search.DeleteIndex("test-get-timeout")
+		handler.search.Close()
+	}()
+
+	ind, err := handler.search.CreateIndex("test-get-timeout")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = ind.AddExternal("neoway", []byte(`{"name": "Neoway"}`), nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	router := httprouter.New()
+	router.Handle("GET", "/:index/:id", handler.ServeHTTP)
+
+	for _, table := range []struct {
+		timeout time.Duration
+		status  int
+	}{
+		{0, http.StatusOK},
+		{time.Minute, http.StatusOK},
+		{time.Nanosecond, http.StatusServiceUnavailable},
+	} {
+		handler.Timeout = table.timeout
+
+		req, err := http.NewRequest("GET", "/test-get-timeout/neoway", nil)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		if res.Code != table.status {
+			t.Errorf("Get with timeout %s returned %d != %d: %s", table.timeout, res.Code, table.status, res.Body.String())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package index
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	nsindex "github.com/NeowayLabs/neosearch/lib/neosearch/index"
+	"golang.org/x/net/context"
+)
+
+// resolveID returns the internal id of the document `docID` of the URL
+// and true, or false if `docID` is an unknown external id. The external
+// ids are looked up first, then numeric natural keys (eg. CNPJ) added as
+// external ids are never taken as internal ids. Unsigned integers
+// without an external id are internal ids, unless the query parameter
+// "external" is true. The query parameter "internal" set to true skips
+// the lookup of the external ids.
+func resolveID(ctx context.Context, index *nsindex.Index, req *http.Request, docID string) (uint64, bool, error) {
+	query := req.URL.Query()
+	id, err := strconv.ParseUint(docID, 10, 64)
+	numeric := err == nil
+
+	if query.Get("internal") == "true" {
+		if !numeric {
+			return 0, false, fmt.Errorf("Invalid internal id: %s", docID)
+		}
+
+		return id, true, nil
+	}
+
+	extID, found, err := index.LookupIDContext(ctx, docID)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	if found {
+		return extID, true, nil
+	}
+
+	if numeric && query.Get("external") != "true" {
+		return id, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// documentID returns the internal id of the document `docID` of the URL.
+// See resolveID.
+func documentID(ctx context.Context, index *nsindex.Index, req *http.Request, docID string) (uint64, error) {
+	id, found, err := resolveID(ctx, index, req, docID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !found {
+		return 0, fmt.Errorf("Document '%s' not found", docID)
+	}
+
+	return id, nil
+}
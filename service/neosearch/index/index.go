@@ -46,12 +46,14 @@ func (handler *IndexHandler) ServeHTTP(res http.ResponseWriter, req *http.Reques
 }
 
 func (handler *IndexHandler) serveIndex(name string) ([]byte, error) {
-	index, err := handler.search.OpenIndex(name)
+	index, err := handler.search.AcquireIndex(name)
 
 	if err != nil {
 		return nil, err
 	}
 
+	defer handler.search.ReleaseIndex(index)
+
 	body, err := json.Marshal(&index)
 
 	if err != nil {
@@ -2,14 +2,17 @@ package index
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch"
+	nsindex "github.com/NeowayLabs/neosearch/lib/neosearch/index"
 	"github.com/NeowayLabs/neosearch/lib/neosearch/search"
 	"github.com/NeowayLabs/neosearch/service/neosearch/handler"
 	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
 )
 
 type SearchHandler struct {
@@ -65,13 +68,15 @@ func (handler *SearchHandler) ServeHTTP(res http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	index, err := handler.search.OpenIndex(indexName)
+	index, err := handler.search.AcquireIndex(indexName)
 
 	if err != nil {
 		handler.Error(res, err.Error())
 		return
 	}
 
+	defer handler.search.ReleaseIndex(index)
+
 	if dsl["query"] == nil {
 		res.WriteHeader(http.StatusBadRequest)
 		handler.Error(res, "No query field specified")
@@ -86,10 +91,23 @@ func (handler *SearchHandler) ServeHTTP(res http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	output := make(map[string]interface{})
-	var total uint64
+	suggestOpts, err := parseSuggestOptions(dsl["suggest"])
+
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		handler.Error(res, err.Error())
+		return
+	}
+
+	sortOpts, err := parseSort(dsl["sort"])
+
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		handler.Error(res, err.Error())
+		return
+	}
 
-	docs, total, err := search.Search(index, query, 10)
+	aggs, err := parseAggregations(dsl["aggs"])
 
 	if err != nil {
 		res.WriteHeader(http.StatusBadRequest)
@@ -97,9 +115,31 @@ func (handler *SearchHandler) ServeHTTP(res http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	documents = make([]map[string]interface{}, len(docs))
+	output := make(map[string]interface{})
+
+	ctx, cancel := handler.Context(res, req)
+	defer cancel()
 
-	for idx, doc := range docs {
+	results, err := search.SearchWithOptionsContext(ctx, index, query, search.Options{
+		Limit:        10,
+		Suggest:      suggestOpts,
+		Sort:         sortOpts,
+		Aggregations: aggs,
+	})
+
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		res.WriteHeader(http.StatusServiceUnavailable)
+		handler.Error(res, "Search "+err.Error())
+		return
+	} else if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		handler.Error(res, err.Error())
+		return
+	}
+
+	documents = make([]map[string]interface{}, len(results.Docs))
+
+	for idx, doc := range results.Docs {
 		obj := make(map[string]interface{})
 		err = json.Unmarshal([]byte(doc), &obj)
 
@@ -111,9 +151,17 @@ func (handler *SearchHandler) ServeHTTP(res http.ResponseWriter, req *http.Reque
 		documents[idx] = obj
 	}
 
-	output["total"] = total
+	output["total"] = results.Total
 	output["results"] = documents
 
+	if len(results.Suggestions) > 0 {
+		output["suggestions"] = results.Suggestions
+	}
+
+	if results.Aggregations != nil {
+		output["aggregations"] = results.Aggregations
+	}
+
 	outputJSON, err = json.Marshal(output)
 
 	if err != nil {
@@ -132,3 +180,126 @@ error:
 		return
 	}
 }
+
+// parseSuggestOptions parses the "suggest" field of the search DSL.
+// The spelling suggestions are enabled by default and could be
+// disabled with "suggest": false or configured with an object like:
+//
+//	"suggest": {"size": 3, "maxDistance": 1, "maxHits": 5}
+func parseSuggestOptions(value interface{}) (*search.SuggestOptions, error) {
+	opts := &search.SuggestOptions{}
+
+	switch v := value.(type) {
+	case nil:
+		return opts, nil
+	case bool:
+		if !v {
+			return nil, nil
+		}
+
+		return opts, nil
+	case map[string]interface{}:
+		data, err := json.Marshal(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = json.Unmarshal(data, opts); err != nil {
+			return nil, fmt.Errorf("Invalid 'suggest' options: %s", err)
+		}
+
+		if opts.MaxDistance > nsindex.MaxFuzziness {
+			return nil, fmt.Errorf("Invalid 'suggest' maxDistance %d. Should be at most %d", opts.MaxDistance, nsindex.MaxFuzziness)
+		}
+
+		return opts, nil
+	}
+
+	return nil, fmt.Errorf("Invalid 'suggest' field: %v", value)
+}
+
+// parseSort parses the "sort" field of the search DSL, like:
+//
+//	"sort": {"field": "location", "order": "asc", "origin": "-27.59,-48.54"}
+func parseSort(value interface{}) (*search.Sort, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	obj, ok := value.(map[string]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("Invalid 'sort' field: %v", value)
+	}
+
+	field, ok := obj["field"].(string)
+
+	if !ok || field == "" {
+		return nil, errors.New("Field 'field' of 'sort' is required")
+	}
+
+	sortOpts := &search.Sort{Field: field}
+
+	switch obj["order"] {
+	case nil, "asc":
+	case "desc":
+		sortOpts.Desc = true
+	default:
+		return nil, fmt.Errorf("Invalid sort order: %v", obj["order"])
+	}
+
+	if obj["origin"] != nil {
+		origin, err := nsindex.ParseGeoPoint(obj["origin"])
+
+		if err != nil {
+			return nil, err
+		}
+
+		sortOpts.Origin = &origin
+	}
+
+	return sortOpts, nil
+}
+
+// parseAggregations parses the "aggs" field of the search DSL. Only terms
+// aggregations of keyword fields are supported, like:
+//
+//	"aggs": {"by_status": {"terms": {"field": "status", "size": 5}}}
+func parseAggregations(value interface{}) (map[string]search.Aggregation, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	obj, ok := value.(map[string]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("Invalid 'aggs' field: %v", value)
+	}
+
+	aggs := make(map[string]search.Aggregation)
+
+	for name, aggValue := range obj {
+		var agg search.Aggregation
+
+		aggObj, ok := aggValue.(map[string]interface{})
+
+		if !ok || len(aggObj) != 1 || aggObj["terms"] == nil {
+			return nil, fmt.Errorf("Invalid aggregation '%s'. Only 'terms' aggregations are supported", name)
+		}
+
+		data, err := json.Marshal(aggObj["terms"])
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = json.Unmarshal(data, &agg); err != nil || agg.Field == "" {
+			return nil, fmt.Errorf("Invalid terms aggregation '%s': %s", name, string(data))
+		}
+
+		aggs[name] = agg
+	}
+
+	return aggs, nil
+}
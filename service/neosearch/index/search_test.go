@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch"
 	"github.com/julienschmidt/httprouter"
@@ -240,3 +242,546 @@ func TestSimpleANDSearch(t *testing.T) {
 		t.Errorf("Invalid result: %+v", r)
 	}
 }
+
+func doSearch(t *testing.T, searchURL, dsl string) map[string]interface{} {
+	req, err := http.NewRequest("POST", searchURL, bytes.NewBufferString(dsl))
+
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+
+	content, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+
+	resObj := map[string]interface{}{}
+
+	err = json.Unmarshal(content, &resObj)
+
+	if err != nil {
+		t.Error(err)
+		t.Errorf("Returned value: %s", string(content))
+		return nil
+	}
+
+	return resObj
+}
+
+func TestPatternSearch(t *testing.T) {
+	handler, err := addDocumentsForSearch("pattern-search")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	router := httprouter.New()
+
+	router.Handle("POST", "/:index", handler.ServeHTTP)
+
+	ts := httptest.NewServer(router)
+
+	defer func() {
+		handler.search.DeleteIndex("pattern-search")
+		ts.Close()
+		handler.search.Close()
+	}()
+
+	searchURL := ts.URL + "/pattern-search"
+
+	for _, table := range []struct {
+		query string
+		total int
+	}{
+		{`{"$and": [{"name": {"$prefix": "goo"}}]}`, 1},
+		{`{"$and": [{"name": {"$wildcard": "*inc"}}]}`, 2},
+		{`{"$and": [{"name": {"$regex": "(face|goo).*"}}, {"name": "inc"}]}`, 2},
+	} {
+		resObj := doSearch(t, searchURL, `{"query": `+table.query+`}`)
+
+		if resObj == nil {
+			return
+		}
+
+		if resObj["error"] != nil {
+			t.Error(resObj["error"])
+			return
+		}
+
+		total, ok := resObj["total"].(float64)
+
+		if !ok || int(total) != table.total {
+			t.Errorf("Search problem for query %s. Returns %v but the correct is %d", table.query, resObj["total"], table.total)
+		}
+	}
+
+	resObj := doSearch(t, searchURL, `{"query": {"$and": [{"name": {"$unknown": "x"}}]}}`)
+
+	if resObj == nil || resObj["error"] == nil {
+		t.Errorf("Unknown operator should fail: %v", resObj)
+	}
+}
+
+func TestSearchTimeout(t *testing.T) {
+	handler, err := addDocumentsForSearch("search-timeout")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer func() {
+		handler.search.DeleteIndex("search-timeout")
+		handler.search.Close()
+	}()
+
+	router := httprouter.New()
+	router.Handle("POST", "/:index", handler.ServeHTTP)
+
+	for _, table := range []struct {
+		timeout time.Duration
+		status  int
+	}{
+		{0, http.StatusOK},
+		{time.Minute, http.StatusOK},
+		{time.Nanosecond, http.StatusServiceUnavailable},
+	} {
+		handler.Timeout = table.timeout
+
+		req, err := http.NewRequest("POST", "/search-timeout", bytes.NewBufferString(`{"query": {"$and": [{"name": {"$prefix": "goo"}}]}}`))
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		if res.Code != table.status {
+			t.Errorf("Search with timeout %s returned %d != %d: %s", table.timeout, res.Code, table.status, res.Body.String())
+		}
+	}
+}
+
+func TestSearchSuggestions(t *testing.T) {
+	handler, err := addDocumentsForSearch("search-suggestions")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	router := httprouter.New()
+
+	router.Handle("POST", "/:index", handler.ServeHTTP)
+
+	ts := httptest.NewServer(router)
+
+	defer func() {
+		handler.search.DeleteIndex("search-suggestions")
+		ts.Close()
+		handler.search.Close()
+	}()
+
+	searchURL := ts.URL + "/search-suggestions"
+
+	resObj := doSearch(t, searchURL, `{"query": {"$and": [{"name": "gogle"}]}}`)
+
+	if resObj == nil {
+		return
+	}
+
+	suggestions, err := json.Marshal(resObj["suggestions"])
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `[{"field":"name","options":[{"count":1,"distance":1,"term":"google"}],"text":"gogle"}]`
+
+	if string(suggestions) != expected {
+		t.Errorf("Unexpected suggestions: %s != %s", string(suggestions), expected)
+	}
+
+	for _, table := range []struct {
+		dsl            string
+		hasSuggestions bool
+	}{
+		{`{"query": {"$and": [{"name": "google"}]}}`, false},
+		{`{"query": {"$and": [{"name": "gogle"}]}, "suggest": false}`, false},
+		{`{"query": {"$and": [{"name": "gogle"}]}, "suggest": {"maxDistance": 1, "size": 1}}`, true},
+		{`{"query": {"$or": [{"name": "gogle"}, {"name": "inc"}]}, "suggest": {"maxHits": 1}}`, false},
+		{`{"query": {"$or": [{"name": "gogle"}, {"name": "inc"}]}, "suggest": {"maxHits": 2}}`, true},
+		{`{"query": {"$and": [{"name": "gogle"}, {"name": "inc"}]}}`, true},
+	} {
+		resObj = doSearch(t, searchURL, table.dsl)
+
+		if resObj == nil {
+			return
+		}
+
+		if (resObj["suggestions"] != nil) != table.hasSuggestions {
+			t.Errorf("Unexpected suggestions for %s: %v", table.dsl, resObj["suggestions"])
+		}
+	}
+
+	// a misspelled clause matching nothing empties the intersection
+	resObj = doSearch(t, searchURL, `{"query": {"$and": [{"name": "gogle"}, {"name": "inc"}]}}`)
+
+	if resObj == nil {
+		return
+	}
+
+	if total, ok := resObj["total"].(float64); !ok || total != 0 {
+		t.Errorf("Misspelled clause matched documents: %v", resObj)
+	}
+
+	resObj = doSearch(t, searchURL, `{"query": {"$or": [{"name": "gogle"}, {"name": "inc"}, {"name": "neoway"}]}, "suggest": false}`)
+
+	if resObj == nil {
+		return
+	}
+
+	if total, ok := resObj["total"].(float64); !ok || total != 3 {
+		t.Errorf("Unexpected total of $or: %v", resObj)
+	}
+
+	resObj = doSearch(t, searchURL, `{"query": {"$and": [{"name": "gogle"}]}, "suggest": {"maxDistance": 5}}`)
+
+	if resObj == nil || resObj["error"] == nil {
+		t.Errorf("Invalid maxDistance should fail: %v", resObj)
+	}
+}
+
+func TestGeoSearch(t *testing.T) {
+	handler := getSearchHandler()
+
+	defer func() {
+		handler.search.DeleteIndex("geo-search")
+		handler.search.Close()
+	}()
+
+	ind, err := handler.search.CreateIndex("geo-search")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"location": map[string]interface{}{"type": "geo_point"},
+	}
+
+	for i, doc := range []string{
+		`{"city": "Florianópolis", "location": {"lat": -27.5954, "lon": -48.5480}}`,
+		`{"city": "São Paulo", "location": "-23.5505,-46.6333"}`,
+		`{"city": "Rio de Janeiro", "location": {"lat": -22.9068, "lon": -43.1729}}`,
+	} {
+		err = ind.Add(uint64(i), []byte(doc), metadata)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	router := httprouter.New()
+
+	router.Handle("POST", "/:index", handler.ServeHTTP)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	searchURL := ts.URL + "/geo-search"
+
+	for _, table := range []struct {
+		dsl    string
+		cities []string
+	}{
+		{
+			`{"query": {"$and": [{"location": {"$geo_distance": {"lat": -23.55, "lon": -46.63, "distance": "400km"}}}]}}`,
+			[]string{"São Paulo", "Rio de Janeiro"},
+		},
+		{
+			`{"query": {"$and": [{"location": {"$geo_distance": {"lat": -23.55, "lon": -46.63, "distance": "500km"}}}]},
+			  "sort": {"field": "location", "origin": {"lat": -22, "lon": -43}}}`,
+			[]string{"Rio de Janeiro", "São Paulo", "Florianópolis"},
+		},
+		{
+			`{"query": {"$and": [{"location": {"$geo_bbox": {"top_left": "-20,-50", "bottom_right": "-30,-45"}}}]},
+			  "sort": {"field": "location", "origin": "-22,-43", "order": "desc"}}`,
+			[]string{"Florianópolis", "São Paulo"},
+		},
+	} {
+		resObj := doSearch(t, searchURL, table.dsl)
+
+		if resObj == nil {
+			return
+		}
+
+		if resObj["error"] != nil {
+			t.Error(resObj["error"])
+			return
+		}
+
+		results, _ := resObj["results"].([]interface{})
+		cities := make([]string, 0, len(results))
+
+		for _, result := range results {
+			if doc, ok := result.(map[string]interface{}); ok {
+				city, _ := doc["city"].(string)
+				cities = append(cities, city)
+			}
+		}
+
+		if !reflect.DeepEqual(cities, table.cities) {
+			t.Errorf("Search %s returned %v != %v", table.dsl, cities, table.cities)
+		}
+	}
+
+	for _, dsl := range []string{
+		`{"query": {"$and": [{"location": {"$geo_distance": {"lat": -23.55, "lon": -46.63}}}]}}`,
+		`{"query": {"$and": [{"location": {"$geo_bbox": {"top_left": "-20,-50"}}}]}}`,
+		`{"query": {"$and": [{"location": {"$geo_distance": "-23.55,-46.63"}}]}}`,
+		`{"query": {"$and": [{"city": "rio"}]}, "sort": {"field": "location", "order": "random"}}`,
+	} {
+		resObj := doSearch(t, searchURL, dsl)
+
+		if resObj == nil || resObj["error"] == nil {
+			t.Errorf("Search %s should fail: %v", dsl, resObj)
+		}
+	}
+}
+
+func TestKeywordSearch(t *testing.T) {
+	handler := getSearchHandler()
+
+	defer func() {
+		handler.search.DeleteIndex("keyword-search")
+		handler.search.Close()
+	}()
+
+	ind, err := handler.search.CreateIndex("keyword-search")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"status": map[string]interface{}{"type": "keyword"},
+		"city":   map[string]interface{}{"type": "keyword"},
+	}
+
+	for i, doc := range []string{
+		`{"name": "Neoway", "status": "ACTIVE", "city": "Florianópolis"}`,
+		`{"name": "Google", "status": "ACTIVE", "city": "Mountain View"}`,
+		`{"name": "Facebook", "status": "INACTIVE", "city": "Menlo Park"}`,
+	} {
+		err = ind.Add(uint64(i), []byte(doc), metadata)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	router := httprouter.New()
+
+	router.Handle("POST", "/:index", handler.ServeHTTP)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	resObj := doSearch(t, ts.URL+"/keyword-search", `{
+		"query": {"$and": [{"status": {"$keyword": "ACTIVE"}}]},
+		"sort": {"field": "city"},
+		"aggs": {"cities": {"terms": {"field": "city", "size": 1}}}
+	}`)
+
+	if resObj == nil {
+		return
+	}
+
+	if resObj["error"] != nil {
+		t.Error(resObj["error"])
+		return
+	}
+
+	output, err := json.Marshal(map[string]interface{}{
+		"results":      resObj["results"],
+		"aggregations": resObj["aggregations"],
+	})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"aggregations":{"cities":[{"count":1,"key":"Florianópolis"}]},` +
+		`"results":[{"city":"Florianópolis","name":"Neoway","status":"ACTIVE"},` +
+		`{"city":"Mountain View","name":"Google","status":"ACTIVE"}]}`
+
+	if string(output) != expected {
+		t.Errorf("Unexpected output: %s != %s", string(output), expected)
+	}
+
+	resObj = doSearch(t, ts.URL+"/keyword-search", `{
+		"query": {"$and": [{"status": {"$keyword": "active"}}]},
+		"aggs": {"cities": {"histogram": {"field": "city"}}}
+	}`)
+
+	if resObj == nil || resObj["error"] == nil {
+		t.Errorf("Unknown aggregation should fail: %v", resObj)
+	}
+}
+
+func TestExistsSearch(t *testing.T) {
+	handler := getSearchHandler()
+
+	defer func() {
+		handler.search.DeleteIndex("exists-search")
+		handler.search.Close()
+	}()
+
+	ind, err := handler.search.CreateIndex("exists-search")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i, doc := range []string{
+		`{"name": "Neoway", "email": "contact@neoway.com.br"}`,
+		`{"name": "Google", "email": null}`,
+		`{"name": "Facebook"}`,
+	} {
+		err = ind.Add(uint64(i), []byte(doc), nil)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	router := httprouter.New()
+
+	router.Handle("POST", "/:index", handler.ServeHTTP)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for _, table := range []struct {
+		query string
+		total int
+	}{
+		{`{"$and": [{"email": {"$exists": true}}]}`, 1},
+		{`{"$and": [{"email": {"$exists": false}}]}`, 2},
+		{`{"$and": [{"name": {"$exists": true}}]}`, 3},
+	} {
+		resObj := doSearch(t, ts.URL+"/exists-search", `{"query": `+table.query+`}`)
+
+		if resObj == nil {
+			return
+		}
+
+		if resObj["error"] != nil {
+			t.Error(resObj["error"])
+			return
+		}
+
+		total, ok := resObj["total"].(float64)
+
+		if !ok || int(total) != table.total {
+			t.Errorf("Search %s returned %v documents but the correct is %d", table.query, resObj["total"], table.total)
+		}
+	}
+
+	resObj := doSearch(t, ts.URL+"/exists-search", `{"query": {"$and": [{"email": {"$exists": "yes"}}]}}`)
+
+	if resObj == nil || resObj["error"] == nil {
+		t.Errorf("Non-boolean $exists should fail: %v", resObj)
+	}
+}
+
+func TestElemMatchSearch(t *testing.T) {
+	handler := getSearchHandler()
+
+	defer func() {
+		handler.search.DeleteIndex("elem-match-search")
+		handler.search.Close()
+	}()
+
+	ind, err := handler.search.CreateIndex("elem-match-search")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i, doc := range []string{
+		`{"name": "Neoway", "partners": [{"name": "maria", "role": "ceo"}, {"name": "joao", "role": "cto"}]}`,
+		`{"name": "Acme", "partners": [{"name": "joao", "role": "ceo"}, {"name": "maria", "role": "cfo"}]}`,
+	} {
+		err = ind.Add(uint64(i), []byte(doc), nil)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	router := httprouter.New()
+
+	router.Handle("POST", "/:index", handler.ServeHTTP)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for _, table := range []struct {
+		query string
+		total int
+	}{
+		{`{"$and": [{"partners.name": "joao"}, {"partners.role": "ceo"}]}`, 2},
+		{`{"$and": [{"partners": {"$elem_match": {"name": "joao", "role": "ceo"}}}]}`, 1},
+		{`{"$and": [{"partners": {"$elem_match": {"name": {"$prefix": "mar"}, "role": "cfo"}}}]}`, 1},
+		{`{"$and": [{"partners": {"$elem_match": {"name": "joao", "role": "cfo"}}}]}`, 0},
+	} {
+		resObj := doSearch(t, ts.URL+"/elem-match-search", `{"query": `+table.query+`}`)
+
+		if resObj == nil {
+			return
+		}
+
+		if resObj["error"] != nil {
+			t.Error(resObj["error"])
+			return
+		}
+
+		total, ok := resObj["total"].(float64)
+
+		if !ok || int(total) != table.total {
+			t.Errorf("Search %s returned %v documents but the correct is %d", table.query, resObj["total"], table.total)
+		}
+	}
+
+	resObj := doSearch(t, ts.URL+"/elem-match-search", `{"query": {"$and": [{"partners": {"$elem_match": {"name": {"$regex": "jo.*"}}}}]}}`)
+
+	if resObj == nil || resObj["error"] == nil {
+		t.Errorf("Unsupported $elem_match operator should fail: %v", resObj)
+	}
+}
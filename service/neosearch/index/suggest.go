@@ -0,0 +1,105 @@
+package index
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch"
+	nsindex "github.com/NeowayLabs/neosearch/lib/neosearch/index"
+	"github.com/NeowayLabs/neosearch/service/neosearch/handler"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
+)
+
+type SuggestHandler struct {
+	handler.DefaultHandler
+	search *neosearch.NeoSearch
+}
+
+func NewSuggestHandler(search *neosearch.NeoSearch) *SuggestHandler {
+	return &SuggestHandler{
+		search: search,
+	}
+}
+
+func (handler *SuggestHandler) ServeHTTP(res http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var (
+		err       error
+		exists    bool
+		size      int
+		fuzziness int
+	)
+
+	handler.ProcessVars(ps)
+	indexName := handler.GetIndexName()
+
+	if exists, err = handler.search.IndexExists(indexName); exists != true && err == nil {
+		response := map[string]string{
+			"error": "Index '" + indexName + "' doesn't exists.",
+		}
+
+		handler.WriteJSONObject(res, response)
+		return
+	} else if exists == false && err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		handler.Error(res, err.Error())
+		return
+	}
+
+	params := req.URL.Query()
+	field := params.Get("field")
+
+	if field == "" {
+		res.WriteHeader(http.StatusBadRequest)
+		handler.Error(res, "Parameter 'field' is required")
+		return
+	}
+
+	if sizeStr := params.Get("size"); sizeStr != "" {
+		if size, err = strconv.Atoi(sizeStr); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			handler.Error(res, "Invalid size: "+sizeStr)
+			return
+		}
+	}
+
+	if fuzzStr := params.Get("fuzziness"); fuzzStr != "" {
+		if fuzziness, err = strconv.Atoi(fuzzStr); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			handler.Error(res, "Invalid fuzziness: "+fuzzStr)
+			return
+		}
+	}
+
+	index, err := handler.search.AcquireIndex(indexName)
+
+	if err != nil {
+		handler.Error(res, err.Error())
+		return
+	}
+
+	defer handler.search.ReleaseIndex(index)
+
+	ctx, cancel := handler.Context(res, req)
+	defer cancel()
+
+	suggestions, err := index.SuggestContext(ctx, []byte(field), []byte(params.Get("prefix")), size, fuzziness)
+
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		res.WriteHeader(http.StatusServiceUnavailable)
+		handler.Error(res, "Suggest "+err.Error())
+		return
+	} else if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		handler.Error(res, err.Error())
+		return
+	}
+
+	if suggestions == nil {
+		suggestions = []nsindex.Suggestion{}
+	}
+
+	handler.WriteJSONObject(res, map[string]interface{}{
+		"suggestions": suggestions,
+	})
+}
@@ -0,0 +1,180 @@
+package index
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch"
+	"github.com/julienschmidt/httprouter"
+)
+
+func getSuggestHandler() *SuggestHandler {
+	cfg := neosearch.NewConfig()
+	cfg.Option(neosearch.DataDir("/tmp/"))
+	ns := neosearch.New(cfg)
+
+	return NewSuggestHandler(ns)
+}
+
+func TestSuggestHandler(t *testing.T) {
+	handler := getSuggestHandler()
+
+	defer func() {
+		handler.search.DeleteIndex("test-suggest-handler")
+		handler.search.Close()
+	}()
+
+	ind, err := handler.search.CreateIndex("test-suggest-handler")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i, doc := range []string{
+		`{"name": "Neoway"}`,
+		`{"name": "Neoway"}`,
+		`{"name": "NeoSearch"}`,
+		`{"name": "Google"}`,
+	} {
+		err = ind.Add(uint64(i+1), []byte(doc), nil)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	router := httprouter.New()
+	router.Handle("GET", "/:index/_suggest", handler.ServeHTTP)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for _, table := range []struct {
+		query    string
+		status   int
+		expected map[string]interface{}
+	}{
+		{
+			query:  "field=name&prefix=neo",
+			status: http.StatusOK,
+			expected: map[string]interface{}{
+				"suggestions": []interface{}{
+					map[string]interface{}{"term": "neoway", "count": float64(2)},
+					map[string]interface{}{"term": "neosearch", "count": float64(1)},
+				},
+			},
+		},
+		{
+			query:  "field=name&prefix=neo&size=1",
+			status: http.StatusOK,
+			expected: map[string]interface{}{
+				"suggestions": []interface{}{
+					map[string]interface{}{"term": "neoway", "count": float64(2)},
+				},
+			},
+		},
+		{
+			query:  "field=name&prefix=xyz",
+			status: http.StatusOK,
+			expected: map[string]interface{}{
+				"suggestions": []interface{}{},
+			},
+		},
+		{
+			query:    "prefix=neo",
+			status:   http.StatusBadRequest,
+			expected: map[string]interface{}{"error": "Parameter 'field' is required"},
+		},
+		{
+			query:    "field=name&prefix=neo&size=ten",
+			status:   http.StatusBadRequest,
+			expected: map[string]interface{}{"error": "Invalid size: ten"},
+		},
+	} {
+		res, err := http.Get(ts.URL + "/test-suggest-handler/_suggest?" + table.query)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		content, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if res.StatusCode != table.status {
+			t.Errorf("Unexpected status for '%s': %d != %d", table.query, res.StatusCode, table.status)
+		}
+
+		resObj := map[string]interface{}{}
+
+		if err = json.Unmarshal(content, &resObj); err != nil {
+			t.Errorf("Invalid response '%s': %s", string(content), err)
+			continue
+		}
+
+		if !reflect.DeepEqual(resObj, table.expected) {
+			t.Errorf("Unexpected response for '%s': %s", table.query, string(content))
+		}
+	}
+}
+
+func TestSuggestTimeout(t *testing.T) {
+	handler := getSuggestHandler()
+
+	defer func() {
+		handler.search.DeleteIndex("test-suggest-timeout")
+		handler.search.Close()
+	}()
+
+	ind, err := handler.search.CreateIndex("test-suggest-timeout")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = ind.Add(1, []byte(`{"name": "Neoway"}`), nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	router := httprouter.New()
+	router.Handle("GET", "/:index/_suggest", handler.ServeHTTP)
+
+	for _, table := range []struct {
+		timeout time.Duration
+		status  int
+	}{
+		{0, http.StatusOK},
+		{time.Minute, http.StatusOK},
+		{time.Nanosecond, http.StatusServiceUnavailable},
+	} {
+		handler.Timeout = table.timeout
+
+		req, err := http.NewRequest("GET", "/test-suggest-timeout/_suggest?field=name&prefix=neo", nil)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		if res.Code != table.status {
+			t.Errorf("Suggest with timeout %s returned %d != %d: %s", table.timeout, res.Code, table.status, res.Body.String())
+		}
+	}
+}
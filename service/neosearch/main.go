@@ -3,12 +3,15 @@ package main
 import (
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch"
+	"github.com/NeowayLabs/neosearch/service/neosearch/protocol"
 	"github.com/NeowayLabs/neosearch/service/neosearch/server"
 	"github.com/jteeuwen/go-pkg-optarg"
 )
@@ -16,21 +19,29 @@ import (
 const (
 	DefaultPort = uint16(9500)
 	DefaultHost = "0.0.0.0"
+
+	// DefaultRequestTimeout is the default maximum duration of the
+	// searches, suggestions and document reads.
+	DefaultRequestTimeout = 30 * time.Second
 )
 
 func main() {
 	var (
 		configOpt, dataDirOpt, hostOpt string
+		metadataOpt, protocolOpt       string
 		goProcsOpt                     uint64
 		portOpt                        uint16
-		helpOpt, debugOpt              bool
+		helpOpt, debugOpt, repairOpt   bool
 		err                            error
 		cfg                            *neosearch.Config
 		cfgServer                      *server.ServerConfig
+		cfgProtocol                    *protocol.ServerConfig
 	)
 
 	cfg = neosearch.NewConfig()
 	cfgServer = server.NewConfig()
+	cfgServer.RequestTimeout = DefaultRequestTimeout
+	cfgProtocol = protocol.NewConfig()
 
 	optarg.Header("General options")
 	optarg.Add("c", "config", "Configurations file", "")
@@ -38,8 +49,14 @@ func main() {
 	optarg.Add("g", "maximum-concurrence", "Set the maximum number of concurrent go routines", 0)
 	optarg.Add("t", "trace-debug", "Enable debug traces", false)
 	optarg.Add("s", "server-address", "Server host and port", "0.0.0.0:9500")
+	optarg.Add("p", "protocol-address", "Command protocol host and port (disabled if empty)", "")
+	optarg.Add("w", "request-timeout", "Maximum duration of the searches and reads, like 30s (0 disables)", DefaultRequestTimeout.String())
 	optarg.Add("h", "help", "Display this help", false)
 
+	optarg.Header("Consistency check (neosearch fsck <index>...)")
+	optarg.Add("r", "repair", "Repair the problems found", false)
+	optarg.Add("m", "metadata", "Metadata used to index the documents", "")
+
 	for opt := range optarg.Parse() {
 		switch opt.ShortName {
 		case "c":
@@ -66,6 +83,17 @@ func main() {
 				hostOpt = addrParts[0]
 				portOpt = DefaultPort
 			}
+		case "p":
+			protocolOpt = opt.String()
+		case "w":
+			timeout, err := time.ParseDuration(opt.String())
+
+			if err != nil || timeout < 0 {
+				log.Fatalf("Invalid request timeout: %s", opt.String())
+				return
+			}
+
+			cfgServer.RequestTimeout = timeout
 		case "t":
 			debugOpt = opt.Bool()
 		case "g":
@@ -80,6 +108,10 @@ func main() {
 			goProcsOpt = uint64(goProcsInt)
 		case "h":
 			helpOpt = true
+		case "r":
+			repairOpt = true
+		case "m":
+			metadataOpt = opt.String()
 		}
 	}
 
@@ -118,9 +150,32 @@ func main() {
 	cfg.Option(neosearch.DataDir(dataDirOpt))
 	cfg.Option(neosearch.Debug(debugOpt))
 
+	if len(optarg.Remainder) > 0 && optarg.Remainder[0] == "fsck" {
+		os.Exit(fsck(cfg, optarg.Remainder[1:], metadataOpt, repairOpt))
+	}
+
 	cfgServer.Host = hostOpt
 	cfgServer.Port = portOpt
 
+	if protocolOpt != "" {
+		host, port, err := net.SplitHostPort(protocolOpt)
+
+		if err != nil {
+			log.Fatalf("Invalid protocol address: %s (%s)", protocolOpt, err)
+			return
+		}
+
+		portInt, err := strconv.ParseUint(port, 10, 16)
+
+		if err != nil {
+			log.Fatalf("Invalid port number: %s (%s)", port, err)
+			return
+		}
+
+		cfgProtocol.Host = host
+		cfgProtocol.Port = uint16(portInt)
+	}
+
 	search := neosearch.New(cfg)
 
 	defer func() {
@@ -136,6 +191,21 @@ func main() {
 		return
 	}
 
+	if protocolOpt != "" {
+		protocolServer, err := protocol.New(search, cfgProtocol)
+
+		if err != nil {
+			log.Fatal(err.Error())
+			return
+		}
+
+		go func() {
+			if err := protocolServer.Start(); err != nil {
+				log.Fatalf("Failed to start protocol server: %s", err.Error())
+			}
+		}()
+	}
+
 	// Wait for a SIGINT (perhaps triggered by user with CTRL-C)
 	// Run cleanup when signal is received
 	signalChan := make(chan os.Signal, 1)
@@ -143,7 +213,11 @@ func main() {
 	go func() {
 		for _ = range signalChan {
 			fmt.Println("\nReceived an interrupt, closing indexes...\n")
-			search.Close()
+
+			if err := search.Close(); err != nil {
+				log.Println(err.Error())
+			}
+
 			os.Exit(0)
 		}
 	}()
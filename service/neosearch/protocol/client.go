@@ -0,0 +1,78 @@
+package protocol
+
+import (
+	"bufio"
+	"net"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+)
+
+// Client is a connection to a neosearch server. A Client isn't safe for
+// concurrent use.
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// Dial connects to the server listening on `address` (host:port).
+func Dial(address string) (*Client, error) {
+	conn, err := net.Dial("tcp", address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}, nil
+}
+
+// Execute sends the commands pipelined and returns their replies. The
+// errors of the commands are error replies, the error returned is an
+// error of the connection.
+func (c *Client) Execute(commands []engine.Command) ([]Reply, error) {
+	for _, cmd := range commands {
+		line, err := cmd.ReverseErr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = c.writer.WriteString(line + "\n"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]Reply, 0, len(commands))
+
+	for range commands {
+		reply, err := ReadReply(c.reader)
+
+		if err != nil {
+			return replies, err
+		}
+
+		replies = append(replies, reply)
+	}
+
+	return replies, nil
+}
+
+// Close sends QUIT and closes the connection. The batches pending are
+// discarded by the server.
+func (c *Client) Close() error {
+	c.writer.WriteString("QUIT;\n")
+
+	if err := c.writer.Flush(); err == nil {
+		ReadReply(c.reader)
+	}
+
+	return c.conn.Close()
+}
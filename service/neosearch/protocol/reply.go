@@ -0,0 +1,185 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+)
+
+// The types of the replies
+const (
+	ReplyStatus  = '+'
+	ReplyError   = '-'
+	ReplyInteger = ':'
+	ReplyBulk    = '$'
+	ReplyArray   = '*'
+)
+
+// Reply is a reply of the server. Str is the message of the status and
+// error replies, Int the number of the integer replies, Bulk the value
+// of the bulk replies (nil if not found) and Array the replies of the
+// array replies.
+type Reply struct {
+	Type  byte
+	Str   string
+	Int   uint64
+	Bulk  []byte
+	Array []Reply
+}
+
+// Err returns the error of an error reply, or nil.
+func (r Reply) Err() error {
+	if r.Type != ReplyError {
+		return nil
+	}
+
+	return errors.New(r.Str)
+}
+
+// Pairs returns the key/value pairs of the array reply of a query.
+func (r Reply) Pairs() ([]engine.KeyValue, error) {
+	if r.Type != ReplyArray {
+		return nil, fmt.Errorf("Reply isn't an array: %c", r.Type)
+	}
+
+	pairs := make([]engine.KeyValue, 0, len(r.Array))
+
+	for _, pair := range r.Array {
+		if pair.Type != ReplyArray || len(pair.Array) != 2 {
+			return nil, errors.New("Reply isn't an array of key/value pairs")
+		}
+
+		pairs = append(pairs, engine.KeyValue{
+			Key:   pair.Array[0].Bulk,
+			Value: pair.Array[1].Bulk,
+		})
+	}
+
+	return pairs, nil
+}
+
+func writeStatus(w *bufio.Writer, status string) {
+	w.WriteString("+" + status + "\r\n")
+}
+
+func writeError(w *bufio.Writer, err error) {
+	// the message is a single line
+	msg := strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+	w.WriteString("-ERR " + msg + "\r\n")
+}
+
+func writeInteger(w *bufio.Writer, n uint64) {
+	w.WriteString(":" + strconv.FormatUint(n, 10) + "\r\n")
+}
+
+func writeBulk(w *bufio.Writer, data []byte) {
+	if data == nil {
+		w.WriteString("$-1\r\n")
+		return
+	}
+
+	w.WriteString("$" + strconv.Itoa(len(data)) + "\r\n")
+	w.Write(data)
+	w.WriteString("\r\n")
+}
+
+func writePairs(w *bufio.Writer, pairs []engine.KeyValue) {
+	w.WriteString("*" + strconv.Itoa(len(pairs)) + "\r\n")
+
+	for _, pair := range pairs {
+		w.WriteString("*2\r\n")
+		writeBulk(w, pair.Key)
+		writeBulk(w, pair.Value)
+	}
+}
+
+// ReadReply reads a reply of the server from `r`.
+func ReadReply(r *bufio.Reader) (Reply, error) {
+	line, err := readLine(r)
+
+	if err != nil {
+		return Reply{}, err
+	}
+
+	if len(line) == 0 {
+		return Reply{}, errors.New("Empty reply")
+	}
+
+	reply := Reply{Type: line[0]}
+	arg := line[1:]
+
+	switch reply.Type {
+	case ReplyStatus:
+		reply.Str = arg
+	case ReplyError:
+		reply.Str = strings.TrimPrefix(arg, "ERR ")
+	case ReplyInteger:
+		if reply.Int, err = strconv.ParseUint(arg, 10, 64); err != nil {
+			return Reply{}, fmt.Errorf("Invalid integer reply: %s", arg)
+		}
+	case ReplyBulk:
+		if arg == "-1" {
+			return reply, nil
+		}
+
+		size, err := strconv.Atoi(arg)
+
+		if err != nil || size < 0 {
+			return Reply{}, fmt.Errorf("Invalid bulk reply size: %s", arg)
+		}
+
+		reply.Bulk = make([]byte, size+2)
+
+		if _, err = io.ReadFull(r, reply.Bulk); err != nil {
+			return Reply{}, err
+		}
+
+		if string(reply.Bulk[size:]) != "\r\n" {
+			return Reply{}, errors.New("Bulk reply not ended by CRLF")
+		}
+
+		reply.Bulk = reply.Bulk[:size]
+	case ReplyArray:
+		size, err := strconv.Atoi(arg)
+
+		if err != nil || size < 0 {
+			return Reply{}, fmt.Errorf("Invalid array reply size: %s", arg)
+		}
+
+		reply.Array = make([]Reply, 0, size)
+
+		for i := 0; i < size; i++ {
+			elem, err := ReadReply(r)
+
+			if err != nil {
+				return Reply{}, err
+			}
+
+			reply.Array = append(reply.Array, elem)
+		}
+	default:
+		return Reply{}, fmt.Errorf("Invalid reply type: %c", reply.Type)
+	}
+
+	return reply, nil
+}
+
+// readLine reads a line ended by CRLF and returns it without the CRLF.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errors.New("Reply line not ended by CRLF")
+	}
+
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,441 @@
+// Package protocol implements the network command protocol of neosearch.
+//
+// The clients send the statements of neosearch-cli, like:
+//
+//	USING sample.document.db GET uint(1);
+//
+// over TCP, and the server replies each command in the order received,
+// like the Redis protocol:
+//
+//	+OK\r\n                        status of set, delete, batch, ...
+//	-ERR <message>\r\n             error of the command
+//	:<number>\r\n                  result of count
+//	$<size>\r\n<bytes>\r\n         value of get, or $-1\r\n if not found
+//	*<n>\r\n<replies>              key/value pairs of scan, prefix, first
+//	                               and last, each one an array of two
+//	                               values
+//
+// A statement that can't be parsed has one error reply. The clients can
+// send many statements without waiting for the replies (pipelining). The
+// batch and flushbatch commands start and commit batches of the
+// connection, and the batches pending are discarded when the connection
+// is closed. The QUIT statement closes the connection.
+//
+// The scan and prefix commands return at most ServerConfig.MaxQueryLimit
+// pairs, even without LIMIT or with a greater one, and the connections
+// idle for ServerConfig.IdleTimeout are closed.
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/index"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/parser"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/utils"
+)
+
+const (
+	// MaxStatementSize is the maximum size of a statement, in bytes.
+	// The connections sending larger statements are closed.
+	MaxStatementSize = 64 * 1024 * 1024
+
+	// DefaultMaxQueryLimit is the default maximum number of pairs
+	// returned by a query
+	DefaultMaxQueryLimit = 10000
+
+	// DefaultIdleTimeout is the default duration of the reads and
+	// writes of the connections
+	DefaultIdleTimeout = 5 * time.Minute
+)
+
+type ServerConfig struct {
+	Host string
+	Port uint16
+
+	// MaxQueryLimit is the maximum number of pairs returned by the
+	// scan and prefix commands. Zero means no limit.
+	MaxQueryLimit uint64
+
+	// IdleTimeout is the maximum duration of each read or write of the
+	// connections, then the idle connections are closed. Zero means
+	// no timeout.
+	IdleTimeout time.Duration
+}
+
+// Server serves the commands of the indices of a NeoSearch.
+type Server struct {
+	config *ServerConfig
+	search *neosearch.NeoSearch
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// connection is a client connection, with the indices acquired and the
+// batches of the client.
+type connection struct {
+	server  *Server
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	indices map[string]*connIndex
+}
+
+type connIndex struct {
+	index   *index.Index
+	session *engine.Session
+}
+
+// NewConfig returns a config with the default limit and timeout.
+func NewConfig() *ServerConfig {
+	return &ServerConfig{
+		MaxQueryLimit: DefaultMaxQueryLimit,
+		IdleTimeout:   DefaultIdleTimeout,
+	}
+}
+
+func New(search *neosearch.NeoSearch, config *ServerConfig) (*Server, error) {
+	if search == nil {
+		return nil, errors.New("No NeoSearch to serve")
+	}
+
+	return &Server{
+		config: config,
+		search: search,
+		conns:  make(map[net.Conn]bool),
+	}, nil
+}
+
+// Start listens on the address of the configuration and serves the
+// connections until Close.
+func (server *Server) Start() error {
+	hostPort := server.config.Host + ":" + strconv.Itoa(int(server.config.Port))
+	listener, err := net.Listen("tcp", hostPort)
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Listening commands on %s", hostPort)
+	return server.Serve(listener)
+}
+
+// Serve accepts the connections of `listener` until Close. It returns nil
+// when closed.
+func (server *Server) Serve(listener net.Listener) error {
+	server.mu.Lock()
+
+	if server.closed {
+		server.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+
+	server.listener = listener
+	server.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			if server.isClosed() {
+				return nil
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+
+			return err
+		}
+
+		if !server.track(conn) {
+			conn.Close()
+			return nil
+		}
+
+		go server.serve(conn)
+	}
+}
+
+// Close stops the server, closes the connections and waits the commands
+// being executed. The batches pending are discarded.
+func (server *Server) Close() error {
+	var err error
+
+	server.mu.Lock()
+	server.closed = true
+
+	if server.listener != nil {
+		err = server.listener.Close()
+	}
+
+	for conn := range server.conns {
+		conn.Close()
+	}
+
+	server.mu.Unlock()
+
+	server.wg.Wait()
+	return err
+}
+
+func (server *Server) isClosed() bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.closed
+}
+
+// track adds the connection to the connections served, unless closed.
+func (server *Server) track(conn net.Conn) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if server.closed {
+		return false
+	}
+
+	server.conns[conn] = true
+	server.wg.Add(1)
+	return true
+}
+
+func (server *Server) untrack(conn net.Conn) {
+	server.mu.Lock()
+	delete(server.conns, conn)
+	server.mu.Unlock()
+
+	server.wg.Done()
+}
+
+func (server *Server) serve(conn net.Conn) {
+	dc := deadlineConn{conn, server.config.IdleTimeout}
+
+	c := &connection{
+		server:  server,
+		conn:    conn,
+		writer:  bufio.NewWriter(dc),
+		indices: make(map[string]*connIndex),
+	}
+
+	c.reader = bufio.NewReader(flushReader{dc, c.writer})
+
+	defer server.untrack(conn)
+	defer c.close()
+
+	for {
+		stmt, err := parser.ReadStatement(c.reader, MaxStatementSize)
+
+		if err != nil && err != io.EOF {
+			writeError(c.writer, err)
+			c.writer.Flush()
+			return
+		}
+
+		if !c.execute(stmt) {
+			c.writer.Flush()
+			return
+		}
+
+		if err == io.EOF {
+			c.writer.Flush()
+			return
+		}
+	}
+}
+
+// deadlineConn sets the deadline of each read and write of the
+// connection, if the timeout isn't zero.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c deadlineConn) Read(p []byte) (int, error) {
+	if c.timeout > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+			return 0, err
+		}
+	}
+
+	return c.Conn.Read(p)
+}
+
+func (c deadlineConn) Write(p []byte) (int, error) {
+	if c.timeout > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+			return 0, err
+		}
+	}
+
+	return c.Conn.Write(p)
+}
+
+// flushReader flushes the replies written before reading more statements
+// from the connection, then the replies of pipelined statements are sent
+// together.
+type flushReader struct {
+	conn   net.Conn
+	writer *bufio.Writer
+}
+
+func (r flushReader) Read(p []byte) (int, error) {
+	if r.writer.Buffered() > 0 {
+		if err := r.writer.Flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	return r.conn.Read(p)
+}
+
+// execute the statement `stmt` and writes the replies. It returns false
+// if the connection must be closed.
+func (c *connection) execute(stmt string) bool {
+	stmt = strings.TrimSpace(stmt)
+
+	if stmt == "" {
+		return true
+	}
+
+	if strings.ToLower(strings.TrimRight(stmt, "; \t\r\n")) == "quit" {
+		writeStatus(c.writer, "OK")
+		return false
+	}
+
+	commands, err := parse(stmt)
+
+	if err != nil {
+		writeError(c.writer, err)
+		return true
+	}
+
+	if len(commands) == 0 {
+		writeError(c.writer, errors.New("Empty statement"))
+		return true
+	}
+
+	for _, cmd := range commands {
+		c.executeCommand(cmd)
+	}
+
+	return true
+}
+
+func (c *connection) executeCommand(cmd engine.Command) {
+	indx, err := c.index(cmd.Index)
+
+	if err != nil {
+		writeError(c.writer, err)
+		return
+	}
+
+	if cmd.Database == "" || cmd.Database == "." || cmd.Database == ".." ||
+		strings.ContainsAny(cmd.Database, "/\\") {
+		writeError(c.writer, fmt.Errorf("Invalid database name: %s", cmd.Database))
+		return
+	}
+
+	if cmd.IsQuery() {
+		if max := c.server.config.MaxQueryLimit; max > 0 && (cmd.Limit == 0 || cmd.Limit > max) {
+			cmd.Limit = max
+		}
+
+		pairs, err := indx.index.Engine().Query(cmd)
+
+		if err != nil {
+			writeError(c.writer, err)
+			return
+		}
+
+		writePairs(c.writer, pairs)
+		return
+	}
+
+	data, err := indx.session.Execute(cmd)
+
+	if err != nil {
+		writeError(c.writer, err)
+		return
+	}
+
+	switch cmd.Command {
+	case "get":
+		writeBulk(c.writer, data)
+	case "count":
+		writeInteger(c.writer, utils.BytesToUint64(data))
+	default:
+		writeStatus(c.writer, "OK")
+	}
+}
+
+// index returns the index `name`, acquired until the connection is closed.
+func (c *connection) index(name string) (*connIndex, error) {
+	if indx, ok := c.indices[name]; ok {
+		return indx, nil
+	}
+
+	if !index.ValidateIndexName(name) {
+		return nil, fmt.Errorf("Invalid index name: %s", name)
+	}
+
+	indx, err := c.server.search.AcquireIndex(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ci := &connIndex{
+		index:   indx,
+		session: indx.Engine().NewSession(),
+	}
+
+	c.indices[name] = ci
+	return ci, nil
+}
+
+// close discards the batches pending, releases the indices and closes
+// the connection.
+func (c *connection) close() {
+	for name, indx := range c.indices {
+		indx.session.Discard()
+
+		if err := c.server.search.ReleaseIndex(indx.index); err != nil {
+			log.Printf("Failed to release the index %s: %s", name, err)
+		}
+
+		delete(c.indices, name)
+	}
+
+	c.conn.Close()
+}
+
+// parse returns the commands of the statements `stmts`. The lexer of the
+// parser panics on invalid characters, then it's an error here.
+func parse(stmts string) (commands []engine.Command, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			commands = nil
+			err = fmt.Errorf("Invalid statement: %v", r)
+		}
+	}()
+
+	err = parser.FromString(stmts, &commands)
+	return commands, err
+}
@@ -0,0 +1,255 @@
+package protocol
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NeowayLabs/neosearch/lib/neosearch"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/engine"
+	"github.com/NeowayLabs/neosearch/lib/neosearch/parser"
+)
+
+// startServer serves a NeoSearch with the index `name` on a local port,
+// with the configuration `config` (or the default one, if nil).
+func startServer(name string, config *ServerConfig, t *testing.T) (*Server, *neosearch.NeoSearch, string) {
+	cfg := neosearch.NewConfig()
+	cfg.Option(neosearch.DataDir("/tmp/"))
+	search := neosearch.New(cfg)
+
+	if _, err := search.CreateIndex(name); err != nil {
+		search.Close()
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		search.DeleteIndex(name)
+		search.Close()
+		t.Fatal(err)
+	}
+
+	if config == nil {
+		config = NewConfig()
+	}
+
+	server, _ := New(search, config)
+	go server.Serve(listener)
+
+	return server, search, listener.Addr().String()
+}
+
+func TestServerPipelining(t *testing.T) {
+	server, search, address := startServer("test-protocol", nil, t)
+
+	defer func() {
+		server.Close()
+		search.DeleteIndex("test-protocol")
+		search.Close()
+	}()
+
+	conn, err := net.Dial("tcp", address)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer conn.Close()
+
+	// all the statements are sent before reading the replies
+	_, err = conn.Write([]byte(`USING test-protocol.name.db SET "a;b" "1";
+USING test-protocol.name.db SET c "2"; USING test-protocol.name.db GET "a;b";
+USING test-protocol.name.db GET d;
+USING test-protocol.name.db COUNT;
+USING test-protocol.name.db SCAN "a" "z";
+USING test-protocol.name.db GET uint(x);
+USING test-protocol.name.db FOO a;
+USING ../etc.passwd GET a;
+QUIT;
+`))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	var replies []Reply
+
+	for {
+		reply, err := ReadReply(reader)
+
+		if err != nil {
+			break
+		}
+
+		replies = append(replies, reply)
+	}
+
+	if len(replies) != 10 {
+		t.Errorf("Unexpected replies: %+v", replies)
+		return
+	}
+
+	for i, typ := range []byte{'+', '+', '$', '$', ':', '*', '-', '-', '-', '+'} {
+		if replies[i].Type != typ {
+			t.Errorf("Reply %d: %+v isn't %c", i, replies[i], typ)
+		}
+	}
+
+	if string(replies[2].Bulk) != "1" || replies[3].Bulk != nil {
+		t.Errorf("Unexpected values: %+v %+v", replies[2], replies[3])
+	}
+
+	if replies[4].Int != 2 {
+		t.Errorf("Unexpected count: %d", replies[4].Int)
+	}
+
+	pairs, err := replies[5].Pairs()
+
+	if err != nil || len(pairs) != 2 || string(pairs[0].Key) != "a;b" || string(pairs[1].Value) != "2" {
+		t.Errorf("Unexpected pairs: %+v (%v)", pairs, err)
+	}
+}
+
+func TestServerBatches(t *testing.T) {
+	server, search, address := startServer("test-protocol-batch", nil, t)
+
+	defer func() {
+		server.Close()
+		search.DeleteIndex("test-protocol-batch")
+		search.Close()
+	}()
+
+	client, err := Dial(address)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	other, err := Dial(address)
+
+	if err != nil {
+		client.Close()
+		t.Error(err)
+		return
+	}
+
+	defer other.Close()
+
+	execute := func(c *Client, stmts string) []Reply {
+		var commands []engine.Command
+
+		if err := parser.FromString(stmts, &commands); err != nil {
+			t.Fatal(err)
+		}
+
+		replies, err := c.Execute(commands)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, reply := range replies {
+			if err := reply.Err(); err != nil {
+				t.Error(err)
+			}
+		}
+
+		return replies
+	}
+
+	execute(client, `USING test-protocol-batch.name.db BATCH;
+USING test-protocol-batch.name.db SET a "1";`)
+
+	// the batch is pending on the connection only
+	if replies := execute(other, "USING test-protocol-batch.name.db GET a;"); replies[0].Bulk != nil {
+		t.Errorf("Batched write visible before flushbatch: %s", replies[0].Bulk)
+	}
+
+	execute(client, `USING test-protocol-batch.name.db FLUSHBATCH;
+USING test-protocol-batch.name.db BATCH;
+USING test-protocol-batch.name.db SET b "2";`)
+
+	// the batches pending are discarded when the connection is closed
+	client.Close()
+
+	replies := execute(other, `USING test-protocol-batch.name.db GET a;
+USING test-protocol-batch.name.db GET b;`)
+
+	if string(replies[0].Bulk) != "1" {
+		t.Errorf("Batch not flushed: %+v", replies[0])
+	}
+
+	if replies[1].Bulk != nil {
+		t.Errorf("Batch of a closed connection committed: %+v", replies[1])
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	config := NewConfig()
+	config.MaxQueryLimit = 2
+	config.IdleTimeout = 100 * time.Millisecond
+
+	server, search, address := startServer("test-protocol-limits", config, t)
+
+	defer func() {
+		server.Close()
+		search.DeleteIndex("test-protocol-limits")
+		search.Close()
+	}()
+
+	client, err := Dial(address)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer client.Close()
+
+	var commands []engine.Command
+
+	err = parser.FromString(`USING test-protocol-limits.name.db SET a "1";
+USING test-protocol-limits.name.db SET b "2";
+USING test-protocol-limits.name.db SET c "3";
+USING test-protocol-limits.name.db SCAN "a" "z";
+USING test-protocol-limits.name.db PREFIX "" LIMIT 100;
+USING test-protocol-limits.name.db SCAN "a" "z" LIMIT 1;`, &commands)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	replies, err := client.Execute(commands)
+
+	if err != nil || len(replies) != 6 {
+		t.Errorf("Unexpected replies: %+v (%v)", replies, err)
+		return
+	}
+
+	for i, expected := range []int{2, 2, 1} {
+		pairs, err := replies[3+i].Pairs()
+
+		if err != nil || len(pairs) != expected {
+			t.Errorf("Query %d returned %d pairs (%v) != %d", i, len(pairs), err, expected)
+		}
+	}
+
+	// the idle connection is closed by the server, after the error of
+	// the timeout
+	time.Sleep(3 * config.IdleTimeout)
+
+	if replies, err = client.Execute(commands[:1]); err == nil && replies[0].Err() == nil {
+		t.Errorf("Idle connection not closed: %+v", replies)
+	}
+
+	if replies, err = client.Execute(commands[:1]); err == nil {
+		t.Errorf("Idle connection not closed: %+v", replies)
+	}
+}
@@ -1,9 +1,13 @@
 package server
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/NeowayLabs/neosearch/lib/neosearch"
 	"github.com/NeowayLabs/neosearch/service/neosearch/home"
@@ -14,6 +18,10 @@ import (
 type ServerConfig struct {
 	Host string
 	Port uint16
+
+	// RequestTimeout is the maximum duration of the searches,
+	// suggestions and document reads. Zero means no timeout.
+	RequestTimeout time.Duration
 }
 
 type HTTPServer struct {
@@ -43,20 +51,65 @@ func (server *HTTPServer) createRoutes() {
 	createIndexHandler := index.NewCreateHandler(server.search)
 	deleteIndexHandler := index.NewDeleteHandler(server.search)
 	getIndexHandler := index.NewGetHandler(server.search)
+	getIndexHandler.Timeout = server.config.RequestTimeout
 	getAnalyzeIndexHandler := index.NewGetAnalyzeHandler(server.search)
 	addIndexHandler := index.NewAddHandler(server.search)
 	searchIndexHandler := index.NewSearchHandler(server.search)
+	searchIndexHandler.Timeout = server.config.RequestTimeout
+	suggestIndexHandler := index.NewSuggestHandler(server.search)
+	suggestIndexHandler.Timeout = server.config.RequestTimeout
 
 	server.router.Handle("GET", "/", homeHandler.ServeHTTP)
 	server.router.Handle("GET", "/:index", indexHandler.ServeHTTP)
 	server.router.Handle("PUT", "/:index", createIndexHandler.ServeHTTP)
 	server.router.Handle("DELETE", "/:index", deleteIndexHandler.ServeHTTP)
-	server.router.Handle("POST", "/:index", searchIndexHandler.ServeHTTP)
-	server.router.Handle("GET", "/:index/:id", getIndexHandler.ServeHTTP)
+	// POST /:index searches the index, or adds a document without id
+	// if the body is a document.
+	server.router.Handle("POST", "/:index", func(res http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		body, err := ioutil.ReadAll(req.Body)
+
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		if isDocument(body) {
+			addIndexHandler.ServeHTTP(res, req, ps)
+		} else {
+			searchIndexHandler.ServeHTTP(res, req, ps)
+		}
+	})
+	// httprouter doesn't allow static paths conflicting with the
+	// :id wildcard, then the index actions are dispatched here.
+	server.router.Handle("GET", "/:index/:id", func(res http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		switch ps.ByName("id") {
+		case "_suggest":
+			suggestIndexHandler.ServeHTTP(res, req, ps)
+		default:
+			getIndexHandler.ServeHTTP(res, req, ps)
+		}
+	})
 	server.router.Handle("GET", "/:index/:id/_analyze", getAnalyzeIndexHandler.ServeHTTP)
 	server.router.Handle("POST", "/:index/:id", addIndexHandler.ServeHTTP)
 }
 
+// isDocument returns true if `body` is a request to add a document, like:
+// {"doc": {...}, "metadata": {...}}
+func isDocument(body []byte) bool {
+	var request map[string]json.RawMessage
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return false
+	}
+
+	_, hasDoc := request["doc"]
+	_, hasQuery := request["query"]
+
+	return hasDoc && !hasQuery
+}
+
 func (server *HTTPServer) GetRoutes() *httprouter.Router {
 	return server.router
 }
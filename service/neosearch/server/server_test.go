@@ -246,3 +246,186 @@ func TestRESTGetDocuments(t *testing.T) {
 
 	deleteIndex(t, search, "company")
 }
+
+func postJSON(t *testing.T, url, body string) map[string]interface{} {
+	res, err := http.Post(url, "application/json", bytes.NewBufferString(body))
+
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+
+	content, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+
+	resObj := map[string]interface{}{}
+
+	err = json.Unmarshal(content, &resObj)
+
+	if err != nil {
+		t.Errorf("Failed to unmarshal json response: %s", string(content))
+		return nil
+	}
+
+	return resObj
+}
+
+func TestRESTAddWithoutID(t *testing.T) {
+	ts, search, _ := getServer(t)
+	defer func() {
+		deleteIndex(t, search, "autoid")
+		ts.Close()
+		search.Close()
+	}()
+
+	_, err := search.CreateIndex("autoid")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	indexURL := ts.URL + "/autoid"
+
+	for i, table := range []struct {
+		doc string
+		id  float64
+	}{
+		{`{"doc": {"name": "neoway"}}`, 1},
+		{`{"doc": {"name": "facebook"}}`, 2},
+		{`{"doc": {"_id": 10, "name": "google"}}`, 10},
+		{`{"doc": {"name": "github"}}`, 11},
+		{`{"doc": {"_id": "00.000.000-0001-91", "name": "acme"}}`, 12},
+		{`{"doc": {"_id": "00.000.000-0001-91", "name": "acme inc"}}`, 12},
+	} {
+		resObj := postJSON(t, indexURL, table.doc)
+
+		if resObj == nil {
+			return
+		}
+
+		if resObj["error"] != nil {
+			t.Error(resObj["error"])
+			return
+		}
+
+		if resObj["id"] != table.id {
+			t.Errorf("Document %d added with id %v but the expected is %v", i, resObj["id"], table.id)
+		}
+	}
+
+	res, err := http.Get(indexURL + "/00.000.000-0001-91")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	content, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	doc := map[string]interface{}{}
+
+	if err = json.Unmarshal(content, &doc); err != nil || doc["name"] != "acme inc" {
+		t.Errorf("Invalid document: %s", string(content))
+	}
+
+	resObj := postJSON(t, indexURL, `{"query": {"$and": [{"name": "neoway"}]}}`)
+
+	if resObj == nil || resObj["total"] != float64(1) {
+		t.Errorf("Search should find 1 document: %v", resObj)
+	}
+}
+
+func TestRESTExternalID(t *testing.T) {
+	ts, search, _ := getServer(t)
+	defer func() {
+		deleteIndex(t, search, "externalid")
+		ts.Close()
+		search.Close()
+	}()
+
+	_, err := search.CreateIndex("externalid")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	indexURL := ts.URL + "/externalid"
+
+	for _, table := range []struct {
+		url string
+		doc string
+		id  float64
+	}{
+		{indexURL + "/5", `{"doc": {"name": "neoway"}}`, 5},
+		{indexURL + "/f47ac10b-58cc", `{"doc": {"name": "uuid"}}`, 6},
+		{indexURL + "/11222333000181?external=true", `{"doc": {"name": "cnpj"}}`, 7},
+		// the numeric external id is found before the internal ids
+		{indexURL + "/11222333000181", `{"doc": {"name": "cnpj"}}`, 7},
+	} {
+		resObj := postJSON(t, table.url, table.doc)
+
+		if resObj == nil {
+			return
+		}
+
+		if resObj["error"] != nil {
+			t.Error(resObj["error"])
+			return
+		}
+
+		if resObj["id"] != table.id {
+			t.Errorf("Document %s added with id %v but the expected is %v", table.url, resObj["id"], table.id)
+		}
+	}
+
+	for url, name := range map[string]string{
+		indexURL + "/5":                            "neoway",
+		indexURL + "/6":                            "uuid",
+		indexURL + "/f47ac10b-58cc":                "uuid",
+		indexURL + "/11222333000181?external=true": "cnpj",
+		indexURL + "/11222333000181":               "cnpj",
+		indexURL + "/7?internal=true":              "cnpj",
+		indexURL + "/unknown":                      "",
+		indexURL + "/unknown?internal=true":        "",
+	} {
+		res, err := http.Get(url)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		content, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		doc := map[string]interface{}{}
+
+		if err = json.Unmarshal(content, &doc); err != nil {
+			t.Errorf("Invalid response: %s", string(content))
+			continue
+		}
+
+		if name == "" {
+			if doc["error"] == nil {
+				t.Errorf("Get %s should fail", url)
+			}
+		} else if doc["name"] != name {
+			t.Errorf("Get %s returned %v != %s", url, doc, name)
+		}
+	}
+}